@@ -0,0 +1,97 @@
+package bpo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"crosscut-contracts/openapi"
+)
+
+func TestSpecParses(t *testing.T) {
+	if _, err := openapi.Parse(Spec); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestClientCoversSpec catches an operation added to openapi.yaml without
+// regenerating api.gen.go
+func TestClientCoversSpec(t *testing.T) {
+	doc, err := openapi.Parse(Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := reflect.TypeOf((*ClientInterface)(nil)).Elem()
+	for path, item := range doc.Paths.Map() {
+		for method, op := range item.Operations() {
+			name := strings.ToUpper(op.OperationID[:1]) + op.OperationID[1:]
+			if _, ok := client.MethodByName(name); !ok {
+				t.Errorf("%s %s: the client has no %s, run go generate", method, path, name)
+			}
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.EscapedPath(), r.Header.Get("Authorization")
+		gotBody = nil
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		switch r.URL.Path {
+		case "/v1/execute-workflow":
+			w.Write([]byte(`{"status": "success", "workflow_id": "wf-1", "message": "done"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "workflow_not_found", "message": "Workflow wf/2 is not known"}`))
+		}
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL+"/", WithToken("secret-token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	response, err := Decode[WorkflowResponse](client.ExecuteWorkflow(ctx, nil, WorkflowRequest{
+		TriggerEvent: "schematic.released",
+		Payload:      map[string]interface{}{"product_name": "ROUTER-100"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.WorkflowID != "wf-1" || response.Status != "success" {
+		t.Errorf("response = %+v", response)
+	}
+	if gotAuth != "Bearer secret-token" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+	wantBody := map[string]interface{}{
+		"trigger_event": "schematic.released",
+		"payload":       map[string]interface{}{"product_name": "ROUTER-100"},
+	}
+	if !reflect.DeepEqual(gotBody, wantBody) {
+		t.Errorf("body = %v, want %v", gotBody, wantBody)
+	}
+
+	_, err = Decode[WorkflowResponse](client.CancelWorkflow(ctx, "wf/2", OperationRequest{}))
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want *Error", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Code != "workflow_not_found" {
+		t.Errorf("error = %+v", apiErr)
+	}
+	if gotPath != "/v1/admin/workflows/wf%2F2/cancel" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if len(gotBody) != 0 {
+		t.Errorf("an operation without a reason sent %v", gotBody)
+	}
+}
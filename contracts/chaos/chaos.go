@@ -0,0 +1,248 @@
+// Package chaos injects faults into the mock services so the BPO's failure
+// paths can be exercised: latency, error statuses, malformed bodies,
+// connection resets and failures of chosen products, each at a configured
+// rate.
+//
+// An Injector wraps a mock's router. Its configuration comes from
+// LoadConfig at startup and can be read and replaced at runtime through
+// /admin/chaos. Faults are drawn from a seeded source, so a test that sends
+// the same requests in the same order sees the same faults.
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AdminPath is where an injector's configuration is served
+const AdminPath = "/admin/chaos"
+
+// ProductFunc names the product a request concerns, or "" if none. body is
+// the request body, which the handler can still read.
+type ProductFunc func(r *http.Request, body []byte) string
+
+// Injector injects faults into requests according to its configuration
+type Injector struct {
+	name    string
+	product ProductFunc
+
+	mu     sync.Mutex
+	config Config
+	random *rand.Rand
+}
+
+// New returns an injector for the named service that injects nothing until
+// configured. product may be nil if the service has no products.
+func New(name string, product ProductFunc) *Injector {
+	i := &Injector{name: name, product: product}
+	i.Configure(Config{})
+	return i
+}
+
+// Configure replaces the configuration and reseeds the fault source
+func (i *Injector) Configure(cfg Config) error {
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.config = cfg
+	i.random = rand.New(rand.NewSource(cfg.Seed))
+	if cfg.Enabled() {
+		log.Printf("[%s] Chaos enabled with seed %d", i.name, cfg.Seed)
+	}
+	return nil
+}
+
+// Config returns the current configuration, with the seed in use
+func (i *Injector) Config() Config {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.config
+}
+
+// faultKind is the failure injected into a request
+type faultKind int
+
+const (
+	faultNone faultKind = iota
+	faultStatus
+	faultMalformed
+	faultReset
+)
+
+// decision is what the injector does to one request
+type decision struct {
+	delay  time.Duration
+	fault  faultKind
+	status int
+	reason string
+}
+
+// decide draws the faults for a request concerning product. Draws are made
+// in a fixed order so a seed reproduces the same faults.
+func (i *Injector) decide(product string) decision {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	cfg := i.config
+	hit := func(rate float64) bool {
+		return rate > 0 && i.random.Float64() < rate
+	}
+
+	var d decision
+	if hit(cfg.Latency.Rate) {
+		d.delay = time.Duration(cfg.Latency.Min)
+		if spread := int64(cfg.Latency.Max - cfg.Latency.Min); spread > 0 {
+			d.delay += time.Duration(i.random.Int63n(spread + 1))
+		}
+	}
+
+	failure, ok := cfg.Products[product]
+	switch {
+	case ok && hit(failure.Rate):
+		d.fault, d.status, d.reason = faultStatus, failure.Status, "failure of product "+product
+	case hit(cfg.ResetRate):
+		d.fault, d.reason = faultReset, "connection reset"
+	case hit(cfg.ErrorRate):
+		d.fault = faultStatus
+		d.status = cfg.ErrorStatuses[i.random.Intn(len(cfg.ErrorStatuses))]
+		d.reason = "error status"
+	case hit(cfg.MalformedRate):
+		d.fault, d.reason = faultMalformed, "malformed body"
+	}
+	return d
+}
+
+// Wrap injects faults into requests to next. Health checks and the admin
+// endpoints are never faulted.
+func (i *Injector) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" || strings.HasPrefix(r.URL.Path, "/admin/") || !i.Config().Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var product string
+		if i.product != nil {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			product = i.product(r, body)
+		}
+
+		d := i.decide(product)
+		if d.delay > 0 {
+			select {
+			case <-time.After(d.delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if d.fault != faultNone {
+			log.Printf("[%s] Chaos: %s %s gets a %s", i.name, r.Method, r.URL.Path, d.reason)
+		}
+
+		switch d.fault {
+		case faultNone:
+			next.ServeHTTP(w, r)
+		case faultStatus:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(d.status)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":   "chaos_fault",
+				"message": fmt.Sprintf("Injected %s: %d", d.reason, d.status),
+			})
+		case faultMalformed:
+			// The real response, cut off halfway through its body
+			rec := httptest.NewRecorder()
+			next.ServeHTTP(rec, r)
+			for key, values := range rec.Header() {
+				w.Header()[key] = values
+			}
+			w.Header().Del("Content-Length")
+			w.WriteHeader(rec.Code)
+			body := rec.Body.Bytes()
+			w.Write(body[:len(body)/2])
+		case faultReset:
+			reset(w)
+		}
+	})
+}
+
+// reset closes the request's connection without a response, as an RST
+// where the connection is TCP
+func reset(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// ServeHTTP serves the configuration at AdminPath: GET returns it, PUT
+// replaces it and DELETE turns chaos off
+func (i *Injector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var cfg Config
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&cfg); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error":   "invalid_request",
+				"message": fmt.Sprintf("Invalid chaos configuration: %v", err),
+			})
+			return
+		}
+		if err := i.Configure(cfg); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error":   "invalid_chaos_config",
+				"message": err.Error(),
+			})
+			return
+		}
+	case http.MethodDelete:
+		i.Configure(Config{})
+		log.Printf("[%s] Chaos disabled", i.name)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error":   "method_not_allowed",
+			"message": r.Method + " is not supported on " + AdminPath,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, i.Config())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
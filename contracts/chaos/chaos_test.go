@@ -0,0 +1,251 @@
+package chaos
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env is a lookup over a fixed set of variables
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chaos.yaml")
+	yaml := "seed: 7\nerror_rate: 0.2\nproducts:\n  ROUTER-100:\n    rate: 0.5\n"
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(env(map[string]string{
+		"CHAOS_CONFIG":           path,
+		"CHAOS_SEED":             "42",
+		"CHAOS_LATENCY":          "50ms-150ms",
+		"CHAOS_ERROR_STATUSES":   "500, 503",
+		"CHAOS_RESET_RATE":       "0.01",
+		"CHAOS_PRODUCT_FAILURES": "SWITCH-200=1:502",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Config{
+		Seed:          42,
+		Latency:       Latency{Rate: 1, Min: Duration(50 * time.Millisecond), Max: Duration(150 * time.Millisecond)},
+		ErrorRate:     0.2,
+		ErrorStatuses: []int{500, 503},
+		ResetRate:     0.01,
+		Products: map[string]ProductFailure{
+			"ROUTER-100": {Rate: 0.5, Status: 500},
+			"SWITCH-200": {Rate: 1, Status: 502},
+		},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("config = %+v\nwant %+v", cfg, want)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		vars map[string]string
+		want string
+	}{
+		{"unparsable rate", map[string]string{"CHAOS_ERROR_RATE": "often"}, `CHAOS_ERROR_RATE: invalid rate "often"`},
+		{"rate above 1", map[string]string{"CHAOS_RESET_RATE": "1.5"}, "reset_rate: must be between 0 and 1"},
+		{"bad latency", map[string]string{"CHAOS_LATENCY": "fast"}, "CHAOS_LATENCY: invalid latency"},
+		{"inverted latency", map[string]string{"CHAOS_LATENCY": "150ms-50ms"}, "latency: min 150ms and max 50ms"},
+		{"success status", map[string]string{"CHAOS_ERROR_RATE": "1", "CHAOS_ERROR_STATUSES": "200"}, "error_statuses[0]: must be an error status"},
+		{"bad product failure", map[string]string{"CHAOS_PRODUCT_FAILURES": "ROUTER-100"}, "want NAME=RATE[:STATUS]"},
+		{"missing file", map[string]string{"CHAOS_CONFIG": "does-not-exist.yaml"}, "failed to read chaos config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(env(tt.vars))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDisabledByDefault(t *testing.T) {
+	cfg, err := LoadConfig(env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Enabled() {
+		t.Errorf("config = %+v, want chaos disabled", cfg)
+	}
+}
+
+// ok answers every request with a small JSON body
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok","product":"ROUTER-100"}`))
+})
+
+// pathProduct takes the product from the request path
+func pathProduct(r *http.Request, body []byte) string {
+	return strings.TrimPrefix(r.URL.Path, "/products/")
+}
+
+func newInjector(t *testing.T, cfg Config) *Injector {
+	t.Helper()
+	injector := New("test", pathProduct)
+	if err := injector.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return injector
+}
+
+// statuses sends n requests to path and returns the statuses received
+func statuses(handler http.Handler, path string, n int) []int {
+	var got []int
+	for i := 0; i < n; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		got = append(got, rec.Code)
+	}
+	return got
+}
+
+func TestSameSeedInjectsSameFaults(t *testing.T) {
+	cfg := Config{Seed: 42, ErrorRate: 0.5, ErrorStatuses: []int{500, 503}}
+
+	first := statuses(newInjector(t, cfg).Wrap(ok), "/products/ROUTER-100", 50)
+	second := statuses(newInjector(t, cfg).Wrap(ok), "/products/ROUTER-100", 50)
+
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("statuses differ between runs with the same seed:\n%v\n%v", first, second)
+	}
+	seen := make(map[int]bool)
+	for _, status := range first {
+		seen[status] = true
+	}
+	if !seen[http.StatusOK] || !seen[http.StatusInternalServerError] || !seen[http.StatusServiceUnavailable] {
+		t.Errorf("statuses = %v, want a mix of 200, 500 and 503", first)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	handler := newInjector(t, Config{Seed: 1, ErrorRate: 1, ErrorStatuses: []int{503}}).Wrap(ok)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products/ROUTER-100", nil))
+
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || body["error"] != "chaos_fault" {
+		t.Errorf("response = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestProductFailure(t *testing.T) {
+	handler := newInjector(t, Config{Seed: 1, Products: map[string]ProductFailure{
+		"SWITCH-200": {Rate: 1, Status: 502},
+	}}).Wrap(ok)
+
+	if got := statuses(handler, "/products/SWITCH-200", 3); !reflect.DeepEqual(got, []int{502, 502, 502}) {
+		t.Errorf("SWITCH-200 statuses = %v, want 502s", got)
+	}
+	if got := statuses(handler, "/products/ROUTER-100", 3); !reflect.DeepEqual(got, []int{200, 200, 200}) {
+		t.Errorf("ROUTER-100 statuses = %v, want 200s", got)
+	}
+}
+
+func TestMalformedBody(t *testing.T) {
+	handler := newInjector(t, Config{Seed: 1, MalformedRate: 1}).Wrap(ok)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products/ROUTER-100", nil))
+
+	if rec.Code != http.StatusOK || json.Valid(rec.Body.Bytes()) || rec.Body.Len() == 0 {
+		t.Errorf("response = %d %q, want 200 with a truncated JSON body", rec.Code, rec.Body)
+	}
+}
+
+func TestConnectionReset(t *testing.T) {
+	server := httptest.NewServer(newInjector(t, Config{Seed: 1, ResetRate: 1}).Wrap(ok))
+	defer server.Close()
+
+	response, err := server.Client().Get(server.URL + "/products/ROUTER-100")
+	if err == nil {
+		response.Body.Close()
+		t.Fatalf("status = %d, want a transport error", response.StatusCode)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	handler := newInjector(t, Config{Seed: 1, Latency: Latency{Min: Duration(20 * time.Millisecond)}}).Wrap(ok)
+
+	start := time.Now()
+	statuses(handler, "/products/ROUTER-100", 1)
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("request took %s, want at least 20ms", elapsed)
+	}
+}
+
+func TestHealthAndAdminAreNotFaulted(t *testing.T) {
+	handler := newInjector(t, Config{Seed: 1, ErrorRate: 1}).Wrap(ok)
+
+	for _, path := range []string{"/health", AdminPath} {
+		if got := statuses(handler, path, 1); got[0] != http.StatusOK {
+			t.Errorf("%s status = %d, want 200", path, got[0])
+		}
+	}
+}
+
+func TestAdminEndpoint(t *testing.T) {
+	injector := New("test", nil)
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		injector.ServeHTTP(rec, httptest.NewRequest(method, AdminPath, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve(http.MethodPut, `{"seed": 9, "error_rate": 0.5, "latency": {"min": "10ms"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", rec.Code, rec.Body)
+	}
+	var cfg Config
+	if err := json.Unmarshal(serve(http.MethodGet, "").Body.Bytes(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Seed != 9 || cfg.ErrorRate != 0.5 || !reflect.DeepEqual(cfg.ErrorStatuses, []int{500}) ||
+		cfg.Latency != (Latency{Rate: 1, Min: Duration(10 * time.Millisecond), Max: Duration(10 * time.Millisecond)}) {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	for body, code := range map[string]string{
+		`{"error_rate": 2}`:  "invalid_chaos_config",
+		`{"errror_rate": 1}`: "invalid_request",
+	} {
+		rec := serve(http.MethodPut, body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), code) {
+			t.Errorf("PUT %s = %d %s, want 400 %s", body, rec.Code, rec.Body, code)
+		}
+	}
+	if !injector.Config().Enabled() {
+		t.Error("a rejected configuration replaced the current one")
+	}
+
+	if rec := serve(http.MethodDelete, ""); rec.Code != http.StatusOK || injector.Config().Enabled() {
+		t.Errorf("DELETE = %d %s, want chaos disabled", rec.Code, rec.Body)
+	}
+	if rec := serve(http.MethodPost, ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", rec.Code)
+	}
+}
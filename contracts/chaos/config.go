@@ -0,0 +1,277 @@
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration written as a string such as "150ms" in JSON
+// and YAML
+type Duration time.Duration
+
+// UnmarshalJSON parses values such as "150ms" or "2s"
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", raw)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration in its string form
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalYAML parses values such as "150ms" or "2s"
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var raw string
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", value.Line, raw)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Config is a fault injection configuration. Rates are probabilities
+// between 0 and 1, drawn for each request. The zero Config injects
+// nothing.
+type Config struct {
+	// Seed makes the faults injected into a given sequence of requests
+	// repeatable. Zero picks a seed from the clock, which GET /admin/chaos
+	// reports so a run can be repeated.
+	Seed int64 `json:"seed" yaml:"seed"`
+
+	Latency Latency `json:"latency" yaml:"latency"`
+
+	// ErrorRate fails requests with one of ErrorStatuses, 500 if none
+	ErrorRate     float64 `json:"error_rate" yaml:"error_rate"`
+	ErrorStatuses []int   `json:"error_statuses,omitempty" yaml:"error_statuses"`
+	// MalformedRate answers requests with a truncated body
+	MalformedRate float64 `json:"malformed_rate" yaml:"malformed_rate"`
+	// ResetRate resets the connection without a response
+	ResetRate float64 `json:"reset_rate" yaml:"reset_rate"`
+
+	// Products fails requests concerning a product, by product name
+	Products map[string]ProductFailure `json:"products,omitempty" yaml:"products"`
+}
+
+// Latency delays requests by a random duration between Min and Max
+type Latency struct {
+	// Rate defaults to 1 once a latency is set
+	Rate float64  `json:"rate" yaml:"rate"`
+	Min  Duration `json:"min" yaml:"min"`
+	// Max defaults to Min
+	Max Duration `json:"max" yaml:"max"`
+}
+
+// ProductFailure fails requests concerning one product
+type ProductFailure struct {
+	Rate float64 `json:"rate" yaml:"rate"`
+	// Status defaults to 500
+	Status int `json:"status" yaml:"status"`
+}
+
+// Enabled reports whether the configuration injects any fault
+func (c Config) Enabled() bool {
+	return c.Latency.Rate > 0 || c.ErrorRate > 0 || c.MalformedRate > 0 || c.ResetRate > 0 || len(c.Products) > 0
+}
+
+// applyDefaults fills in the values left out of a configuration
+func (c *Config) applyDefaults() {
+	if c.Latency.Max == 0 {
+		c.Latency.Max = c.Latency.Min
+	}
+	if c.Latency.Rate == 0 && c.Latency.Max > 0 {
+		c.Latency.Rate = 1
+	}
+	if c.ErrorRate > 0 && len(c.ErrorStatuses) == 0 {
+		c.ErrorStatuses = []int{500}
+	}
+	for name, product := range c.Products {
+		if product.Status == 0 {
+			product.Status = 500
+			c.Products[name] = product
+		}
+	}
+}
+
+// Validate reports every problem with the configuration
+func (c Config) Validate() error {
+	var problems []string
+	checkRate := func(field string, rate float64) {
+		if rate < 0 || rate > 1 {
+			problems = append(problems, fmt.Sprintf("%s: must be between 0 and 1, got %g", field, rate))
+		}
+	}
+	checkStatus := func(field string, status int) {
+		if status < 400 || status > 599 {
+			problems = append(problems, fmt.Sprintf("%s: must be an error status between 400 and 599, got %d", field, status))
+		}
+	}
+
+	checkRate("latency.rate", c.Latency.Rate)
+	if c.Latency.Min < 0 || c.Latency.Max < c.Latency.Min {
+		problems = append(problems, fmt.Sprintf("latency: min %s and max %s must satisfy 0 <= min <= max",
+			time.Duration(c.Latency.Min), time.Duration(c.Latency.Max)))
+	}
+	checkRate("error_rate", c.ErrorRate)
+	for i, status := range c.ErrorStatuses {
+		checkStatus(fmt.Sprintf("error_statuses[%d]", i), status)
+	}
+	checkRate("malformed_rate", c.MalformedRate)
+	checkRate("reset_rate", c.ResetRate)
+
+	names := make([]string, 0, len(c.Products))
+	for name := range c.Products {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		checkRate("products."+name+".rate", c.Products[name].Rate)
+		checkStatus("products."+name+".status", c.Products[name].Status)
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// LoadConfig reads the configuration from the file named by CHAOS_CONFIG,
+// if set, and overlays the CHAOS_* variables:
+//
+//	CHAOS_SEED=42
+//	CHAOS_LATENCY=50ms-150ms         or a fixed 100ms
+//	CHAOS_LATENCY_RATE=0.5
+//	CHAOS_ERROR_RATE=0.1
+//	CHAOS_ERROR_STATUSES=500,503
+//	CHAOS_MALFORMED_RATE=0.05
+//	CHAOS_RESET_RATE=0.01
+//	CHAOS_PRODUCT_FAILURES=SWITCH-200=1,ROUTER-100=0.5:503
+//
+// lookup is os.LookupEnv outside tests.
+func LoadConfig(lookup func(string) (string, bool)) (Config, error) {
+	var cfg Config
+	if path, ok := lookup("CHAOS_CONFIG"); ok && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read chaos config: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("failed to parse chaos config %s: %w", path, err)
+		}
+	}
+
+	var problems []string
+	setRate := func(name string, rate *float64) {
+		if v, ok := lookup(name); ok && v != "" {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid rate %q", name, v))
+			}
+			*rate = parsed
+		}
+	}
+
+	if v, ok := lookup("CHAOS_SEED"); ok && v != "" {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("CHAOS_SEED: invalid integer %q", v))
+		}
+		cfg.Seed = seed
+	}
+	if v, ok := lookup("CHAOS_LATENCY"); ok && v != "" {
+		min, max, found := strings.Cut(v, "-")
+		if !found {
+			max = min
+		}
+		minDuration, minErr := time.ParseDuration(strings.TrimSpace(min))
+		maxDuration, maxErr := time.ParseDuration(strings.TrimSpace(max))
+		if minErr != nil || maxErr != nil {
+			problems = append(problems, fmt.Sprintf("CHAOS_LATENCY: invalid latency %q, want a duration or a range such as 50ms-150ms", v))
+		}
+		cfg.Latency.Min, cfg.Latency.Max = Duration(minDuration), Duration(maxDuration)
+	}
+	setRate("CHAOS_LATENCY_RATE", &cfg.Latency.Rate)
+	setRate("CHAOS_ERROR_RATE", &cfg.ErrorRate)
+	if v, ok := lookup("CHAOS_ERROR_STATUSES"); ok && v != "" {
+		cfg.ErrorStatuses = nil
+		for _, field := range strings.Split(v, ",") {
+			status, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("CHAOS_ERROR_STATUSES: invalid status %q", field))
+				continue
+			}
+			cfg.ErrorStatuses = append(cfg.ErrorStatuses, status)
+		}
+	}
+	setRate("CHAOS_MALFORMED_RATE", &cfg.MalformedRate)
+	setRate("CHAOS_RESET_RATE", &cfg.ResetRate)
+	if v, ok := lookup("CHAOS_PRODUCT_FAILURES"); ok && v != "" {
+		if cfg.Products == nil {
+			cfg.Products = make(map[string]ProductFailure)
+		}
+		for _, field := range strings.Split(v, ",") {
+			failure, err := parseProductFailure(strings.TrimSpace(field))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("CHAOS_PRODUCT_FAILURES: %v", err))
+				continue
+			}
+			cfg.Products[failure.name] = failure.ProductFailure
+		}
+	}
+
+	if len(problems) > 0 {
+		return cfg, errors.New(strings.Join(problems, "; "))
+	}
+	cfg.applyDefaults()
+	return cfg, cfg.Validate()
+}
+
+// namedFailure is a product failure parsed from CHAOS_PRODUCT_FAILURES
+type namedFailure struct {
+	name string
+	ProductFailure
+}
+
+// parseProductFailure parses NAME=RATE or NAME=RATE:STATUS
+func parseProductFailure(field string) (namedFailure, error) {
+	name, spec, ok := strings.Cut(field, "=")
+	if !ok || name == "" {
+		return namedFailure{}, fmt.Errorf("invalid product failure %q, want NAME=RATE[:STATUS]", field)
+	}
+	rate, status, hasStatus := strings.Cut(spec, ":")
+	failure := namedFailure{name: name}
+	var err error
+	if failure.Rate, err = strconv.ParseFloat(rate, 64); err != nil {
+		return failure, fmt.Errorf("invalid rate in %q", field)
+	}
+	if hasStatus {
+		if failure.Status, err = strconv.Atoi(status); err != nil {
+			return failure, fmt.Errorf("invalid status in %q", field)
+		}
+	}
+	return failure, nil
+}
@@ -0,0 +1,241 @@
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"crosscut-contracts/openapi"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// docgenSpec is the DocGen API the DocGen types follow
+const docgenSpec = "../docs/mock-docgen-openapi.yaml"
+
+// docgenSchemas maps the spec's named schemas to the types implementing them
+var docgenSchemas = map[string]reflect.Type{
+	"DocumentPlan":       reflect.TypeOf(DocumentPlan{}),
+	"ComponentInstance":  reflect.TypeOf(ComponentInstance{}),
+	"GenerateResponse":   reflect.TypeOf(GenerateResponse{}),
+	"ValidationResponse": reflect.TypeOf(ValidationResponse{}),
+	"ComponentsResponse": reflect.TypeOf(ComponentsResponse{}),
+	"ErrorResponse":      reflect.TypeOf(ErrorResponse{}),
+}
+
+func loadDocGenSpec(t *testing.T) *openapi.Document {
+	t.Helper()
+	doc, err := openapi.Load(docgenSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// jsonField is a struct field as it appears in JSON
+type jsonField struct {
+	name      string
+	omitempty bool
+	typ       reflect.Type
+}
+
+// jsonFields lists the JSON fields of a struct type, including those of
+// embedded structs
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && tag == "" {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{
+			name:      name,
+			omitempty: strings.Contains(options, "omitempty"),
+			typ:       field.Type,
+		})
+	}
+	return fields
+}
+
+// comparison is a type compared against a schema, remembered so recursive
+// types such as ComponentInstance are compared once
+type comparison struct {
+	typ    reflect.Type
+	schema *openapi3.Schema
+}
+
+// comparer compares Go types with spec schemas
+type comparer struct {
+	doc  *openapi.Document
+	seen map[comparison]bool
+}
+
+func newComparer(doc *openapi.Document) *comparer {
+	return &comparer{doc: doc, seen: make(map[comparison]bool)}
+}
+
+// compareType reports every way typ's JSON form differs from schema
+func (c *comparer) compareType(path string, typ reflect.Type, ref *openapi3.SchemaRef) []string {
+	schema := ref.Value
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if c.seen[comparison{typ, schema}] {
+		return nil
+	}
+	c.seen[comparison{typ, schema}] = true
+
+	switch typ.Kind() {
+	case reflect.String:
+		return expectType(path, schema, "string")
+	case reflect.Bool:
+		return expectType(path, schema, "boolean")
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return expectType(path, schema, "integer")
+	case reflect.Float32, reflect.Float64:
+		return expectType(path, schema, "number")
+	case reflect.Slice:
+		if problems := expectType(path, schema, "array"); problems != nil {
+			return problems
+		}
+		if schema.Items == nil {
+			return []string{path + ": spec declares no items"}
+		}
+		return c.compareType(path+"[]", typ.Elem(), schema.Items)
+	case reflect.Map:
+		if problems := expectType(path, schema, "object"); problems != nil {
+			return problems
+		}
+		additional := schema.AdditionalProperties
+		if additional.Schema == nil && (additional.Has == nil || !*additional.Has) {
+			return []string{path + ": Go map but spec does not allow additionalProperties"}
+		}
+		return nil
+	case reflect.Struct:
+		if problems := expectType(path, schema, "object"); problems != nil {
+			return problems
+		}
+		return c.compareStruct(path, typ, schema)
+	default:
+		return []string{path + ": unsupported Go kind " + typ.Kind().String()}
+	}
+}
+
+func (c *comparer) compareStruct(path string, typ reflect.Type, schema *openapi3.Schema) []string {
+	var problems []string
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	declared := make(map[string]bool)
+	for _, field := range jsonFields(typ) {
+		declared[field.name] = true
+		fieldPath := path + "." + field.name
+		prop, ok := schema.Properties[field.name]
+		if !ok {
+			problems = append(problems, fieldPath+": Go field is not in the spec")
+			continue
+		}
+		if required[field.name] && field.omitempty {
+			problems = append(problems, fieldPath+": required by the spec but omitted when empty")
+		}
+		problems = append(problems, c.compareType(fieldPath, field.typ, prop)...)
+	}
+
+	var missing []string
+	for name := range schema.Properties {
+		if !declared[name] {
+			missing = append(missing, path+"."+name+": in the spec but missing from the Go type")
+		}
+	}
+	sort.Strings(missing)
+	return append(problems, missing...)
+}
+
+func expectType(path string, schema *openapi3.Schema, want string) []string {
+	if !schema.Type.Is(want) {
+		return []string{path + ": Go " + want + " but spec type " + strings.Join(schema.Type.Slice(), ", ")}
+	}
+	return nil
+}
+
+func TestDocGenTypesMatchSpec(t *testing.T) {
+	doc := loadDocGenSpec(t)
+	for name, typ := range docgenSchemas {
+		schema, ok := doc.Schema(name)
+		if !ok {
+			t.Errorf("spec has no schema %s", name)
+			continue
+		}
+		for _, problem := range newComparer(doc).compareType(name, typ, schema) {
+			t.Error(problem)
+		}
+	}
+}
+
+// TestDocGenExamplesRoundTrip decodes every example in the spec into its Go
+// type, without unknown fields, and checks the re-encoded JSON still
+// satisfies the schema
+func TestDocGenExamplesRoundTrip(t *testing.T) {
+	doc := loadDocGenSpec(t)
+	checked := 0
+	for path, item := range doc.Paths.Map() {
+		for method, op := range item.Operations() {
+			var media []*openapi3.MediaType
+			if op.RequestBody != nil {
+				media = append(media, op.RequestBody.Value.Content.Get("application/json"))
+			}
+			for _, response := range op.Responses.Map() {
+				media = append(media, response.Value.Content.Get("application/json"))
+			}
+
+			for _, m := range media {
+				if m == nil || m.Schema == nil {
+					continue
+				}
+				typ, ok := docgenSchemas[strings.TrimPrefix(m.Schema.Ref, "#/components/schemas/")]
+				if !ok {
+					continue
+				}
+				for name, example := range m.Examples {
+					at := method + " " + path + " example " + name
+					data, err := json.Marshal(example.Value.Value)
+					if err != nil {
+						t.Fatalf("%s: %v", at, err)
+					}
+
+					value := reflect.New(typ)
+					decoder := json.NewDecoder(bytes.NewReader(data))
+					decoder.DisallowUnknownFields()
+					if err := decoder.Decode(value.Interface()); err != nil {
+						t.Errorf("%s: does not decode into %s: %v", at, typ.Name(), err)
+						continue
+					}
+					encoded, err := json.Marshal(value.Interface())
+					if err != nil {
+						t.Fatalf("%s: %v", at, err)
+					}
+					if err := doc.ValidateJSON(encoded, m.Schema, openapi.Options{Strict: true}); err != nil {
+						t.Errorf("%s: re-encoded %s does not match the spec: %v", at, typ.Name(), err)
+					}
+					checked++
+				}
+			}
+		}
+	}
+	if checked == 0 {
+		t.Fatal("the spec has no examples for the DocGen types")
+	}
+}
@@ -0,0 +1,7 @@
+// Package contracts holds the wire types exchanged between the CrossCut BPO,
+// the PLM service and the DocGen service. Each service uses these types
+// rather than its own copy, so a change to the contract is made once.
+//
+// The DocGen types follow docs/mock-docgen-openapi.yaml; the tests in this
+// module fail when they drift from it.
+package contracts
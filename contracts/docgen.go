@@ -0,0 +1,61 @@
+package contracts
+
+// DocumentPlan is the plan DocGen renders, sent to /generate and
+// /validate-plan
+type DocumentPlan struct {
+	DocProps *DocProps           `json:"doc_props,omitempty"`
+	Body     []ComponentInstance `json:"body" binding:"required,min=1"`
+}
+
+// DocProps is document metadata, including an optional header component
+type DocProps struct {
+	Filename        string                 `json:"filename,omitempty"`
+	HeaderComponent string                 `json:"header_component,omitempty"`
+	HeaderProps     map[string]interface{} `json:"header_props,omitempty"`
+}
+
+// ComponentInstance is a component to render and its nested children
+type ComponentInstance struct {
+	Component string                 `json:"component" binding:"required"`
+	Props     map[string]interface{} `json:"props" binding:"required"`
+	Children  []ComponentInstance    `json:"children,omitempty"`
+}
+
+// GenerateResponse reports a generated document
+type GenerateResponse struct {
+	Status             string `json:"status"`
+	URL                string `json:"url"`
+	Filename           string `json:"filename"`
+	GenerationTimeMs   int    `json:"generation_time_ms"`
+	ComponentsRendered int    `json:"components_rendered"`
+}
+
+// ValidationResponse is DocGen's verdict on a document plan
+type ValidationResponse struct {
+	Valid   bool   `json:"valid"`
+	Message string `json:"message"`
+	// ComponentsValidated is only set when the plan is valid
+	ComponentsValidated *int `json:"components_validated,omitempty"`
+	// Errors is only set when the plan is invalid
+	Errors []ValidationError `json:"errors,omitempty"`
+}
+
+// ValidationError is one field-level problem found in a plan
+type ValidationError struct {
+	Field string `json:"field"`
+	Issue string `json:"issue"`
+}
+
+// ComponentsResponse lists the components DocGen can render
+type ComponentsResponse struct {
+	Components []string `json:"components"`
+	Count      int      `json:"count"`
+	Note       string   `json:"note,omitempty"`
+}
+
+// ErrorResponse is DocGen's error body
+type ErrorResponse struct {
+	Error   string            `json:"error"`
+	Message string            `json:"message"`
+	Details []ValidationError `json:"details,omitempty"`
+}
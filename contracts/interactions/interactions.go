@@ -0,0 +1,282 @@
+// Package interactions records the requests a consumer sends to a provider
+// and replays them against the provider, so each side can check in its own
+// go test that the other still behaves as it relies on.
+//
+// The consumer's tests point it at a Recorder, which answers each expected
+// request with the response the consumer is written against and records
+// the request the consumer actually sent. The resulting Contract is saved
+// as JSON. The provider's tests Load it and Verify every interaction
+// against the provider's router: the status must be the expected one and
+// the body must have the expected shape.
+package interactions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Contract is what a consumer relies on from one provider
+type Contract struct {
+	Consumer     string        `json:"consumer"`
+	Provider     string        `json:"provider"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a request the consumer sends and the response it expects
+type Interaction struct {
+	Description string `json:"description"`
+	// ProviderState names the data the provider must hold before the
+	// request is replayed, e.g. "product ROUTER-100 exists"
+	ProviderState string   `json:"provider_state,omitempty"`
+	Request       Request  `json:"request"`
+	Response      Response `json:"response"`
+}
+
+// Request is a recorded HTTP request
+type Request struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Response is the response a consumer expects
+type Response struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Load reads a contract saved as Marshal encodes it
+func Load(path string) (*Contract, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var contract Contract
+	if err := json.Unmarshal(data, &contract); err != nil {
+		return nil, fmt.Errorf("invalid contract %s: %w", path, err)
+	}
+	return &contract, nil
+}
+
+// Marshal encodes the contract as indented JSON, the form it is saved in
+func (c *Contract) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Recorder stands in for a provider in the consumer's tests. It answers
+// expected requests and records them, in the order first received.
+type Recorder struct {
+	consumer string
+	provider string
+
+	mu           sync.Mutex
+	expectations map[string]*Interaction
+	recorded     []Interaction
+	seen         map[string]bool
+	unexpected   []string
+}
+
+// NewRecorder returns a recorder for the contract between consumer and
+// provider
+func NewRecorder(consumer, provider string) *Recorder {
+	return &Recorder{
+		consumer:     consumer,
+		provider:     provider,
+		expectations: make(map[string]*Interaction),
+		seen:         make(map[string]bool),
+	}
+}
+
+// Expect answers requests to method and path with status and body, which
+// is marshalled to JSON. state is the provider state the response assumes.
+func (r *Recorder) Expect(description, state, method, path string, status int, body interface{}) {
+	var raw json.RawMessage
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			panic(fmt.Sprintf("interactions: response body of %q: %v", description, err))
+		}
+		raw = data
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expectations[method+" "+path] = &Interaction{
+		Description:   description,
+		ProviderState: state,
+		Request:       Request{Method: method, Path: path},
+		Response:      Response{Status: status, Body: raw},
+	}
+}
+
+// ServeHTTP answers an expected request and records it. Any other request
+// is answered with 501 and reported by Unexpected.
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	key := req.Method + " " + req.URL.Path
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	expected, ok := r.expectations[key]
+	if !ok {
+		r.unexpected = append(r.unexpected, key)
+		r.mu.Unlock()
+		http.Error(w, "no interaction expected for "+key, http.StatusNotImplemented)
+		return
+	}
+	if !r.seen[key] {
+		r.seen[key] = true
+		interaction := *expected
+		if len(bytes.TrimSpace(body)) > 0 {
+			interaction.Request.Body = compact(body)
+		}
+		r.recorded = append(r.recorded, interaction)
+	}
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(expected.Response.Status)
+	w.Write(expected.Response.Body)
+}
+
+// Contract returns the interactions recorded so far
+func (r *Recorder) Contract() *Contract {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Contract{
+		Consumer:     r.consumer,
+		Provider:     r.provider,
+		Interactions: append([]Interaction(nil), r.recorded...),
+	}
+}
+
+// Unexpected lists the requests that matched no expectation
+func (r *Recorder) Unexpected() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.unexpected...)
+}
+
+// compact removes insignificant whitespace from a JSON body, keeping other
+// bodies as they are
+func compact(body []byte) json.RawMessage {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, body); err != nil {
+		quoted, _ := json.Marshal(string(body))
+		return quoted
+	}
+	return buf.Bytes()
+}
+
+// Verify replays the interaction against a provider's handler and checks
+// the response
+func Verify(handler http.Handler, interaction Interaction) error {
+	req := httptest.NewRequest(interaction.Request.Method, interaction.Request.Path,
+		bytes.NewReader(interaction.Request.Body))
+	if len(interaction.Request.Body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != interaction.Response.Status {
+		return fmt.Errorf("status %d, want %d: %s", rec.Code, interaction.Response.Status, rec.Body)
+	}
+	if len(interaction.Response.Body) == 0 {
+		return nil
+	}
+	if err := Match(interaction.Response.Body, rec.Body.Bytes()); err != nil {
+		return fmt.Errorf("%w\n%s", err, rec.Body)
+	}
+	return nil
+}
+
+// Match checks that actual has the shape of expected: every field of an
+// expected object is present with a value of the same JSON type, and every
+// element of an array has the shape of the expected array's first
+// element. Values themselves are not compared, and fields the consumer
+// does not expect are allowed.
+func Match(expected, actual []byte) error {
+	var want, got interface{}
+	if err := json.Unmarshal(expected, &want); err != nil {
+		return fmt.Errorf("invalid expected body: %w", err)
+	}
+	if err := json.Unmarshal(actual, &got); err != nil {
+		return fmt.Errorf("response is not JSON: %w", err)
+	}
+
+	var problems []string
+	matchValue("body", want, got, &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("response does not match the contract: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func matchValue(path string, want, got interface{}, problems *[]string) {
+	if jsonType(want) != jsonType(got) {
+		*problems = append(*problems, fmt.Sprintf("%s: is %s, want %s", path, jsonType(got), jsonType(want)))
+		return
+	}
+	switch want := want.(type) {
+	case map[string]interface{}:
+		got := got.(map[string]interface{})
+		names := make([]string, 0, len(want))
+		for name := range want {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value, ok := got[name]
+			if !ok {
+				*problems = append(*problems, fmt.Sprintf("%s.%s: is missing", path, name))
+				continue
+			}
+			matchValue(path+"."+name, want[name], value, problems)
+		}
+	case []interface{}:
+		got := got.([]interface{})
+		if len(want) == 0 {
+			return
+		}
+		if len(got) == 0 {
+			*problems = append(*problems, fmt.Sprintf("%s: is empty", path))
+			return
+		}
+		for i, item := range got {
+			matchValue(fmt.Sprintf("%s[%d]", path, i), want[0], item, problems)
+		}
+	}
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
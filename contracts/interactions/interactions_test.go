@@ -0,0 +1,85 @@
+package interactions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	expected := `{"product": "ROUTER-100", "components": [{"name": "PowerTest", "voltage": "12V"}]}`
+
+	tests := []struct {
+		name   string
+		actual string
+		want   string
+	}{
+		{"same shape", `{"product": "SWITCH-200", "components": [{"name": "a", "voltage": "24V"}, {"name": "b", "voltage": "5V"}], "extra": 1}`, ""},
+		{"missing field", `{"components": [{"name": "a", "voltage": "24V"}]}`, "body.product: is missing"},
+		{"wrong type", `{"product": "x", "components": [{"name": "a", "voltage": 24}]}`, "body.components[0].voltage: is a number, want a string"},
+		{"empty array", `{"product": "x", "components": []}`, "body.components: is empty"},
+		{"null", `{"product": null, "components": [{"name": "a", "voltage": "24V"}]}`, "body.product: is null, want a string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Match([]byte(expected), []byte(tt.actual))
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordAndVerify(t *testing.T) {
+	recorder := NewRecorder("consumer", "provider")
+	recorder.Expect("create a widget", "no widgets exist", http.MethodPost, "/widgets", http.StatusCreated,
+		map[string]interface{}{"id": "w-1", "name": "widget"})
+
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+	for i := 0; i < 2; i++ {
+		resp, err := http.Post(server.URL+"/widgets", "application/json", strings.NewReader(`{ "name": "widget" }`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("status %d", resp.StatusCode)
+		}
+	}
+	resp, err := http.Get(server.URL + "/widgets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	contract := recorder.Contract()
+	if len(contract.Interactions) != 1 {
+		t.Fatalf("recorded %d interactions, want 1", len(contract.Interactions))
+	}
+	if body := string(contract.Interactions[0].Request.Body); body != `{"name":"widget"}` {
+		t.Errorf("recorded body %s", body)
+	}
+	if got := recorder.Unexpected(); len(got) != 1 || got[0] != "GET /widgets" {
+		t.Errorf("unexpected = %v", got)
+	}
+
+	provider := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "w-42", "name": "widget", "created_at": "2026-01-01T00:00:00Z"}`))
+	})
+	if err := Verify(provider, contract.Interactions[0]); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	broken := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 42}`))
+	})
+	if err := Verify(broken, contract.Interactions[0]); err == nil {
+		t.Error("Verify accepted a response without a name and with a numeric id")
+	}
+}
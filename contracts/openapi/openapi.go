@@ -0,0 +1,205 @@
+// Package openapi loads OpenAPI 3 documents with kin-openapi and reports
+// what fails validation as "field: issue" problems, the form the BPO
+// returns in its error details. Fields are named after where they occur:
+// body.<property>[<index>], path.<name> or query.<name>.
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// Document is an OpenAPI 3 document and the router matching requests to
+// its operations
+type Document struct {
+	*openapi3.T
+	router routers.Router
+}
+
+// Parse loads an OpenAPI document from YAML or JSON and checks it is
+// valid, including that every $ref resolves
+func Parse(data []byte) (*Document, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+
+	// Requests are matched on their path alone, whichever server they
+	// were sent to
+	routed := *doc
+	routed.Servers = nil
+	router, err := gorillamux.NewRouter(&routed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	return &Document{T: doc, router: router}, nil
+}
+
+// Load reads and parses the OpenAPI document at path
+func Load(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Schema returns a schema of the document's components by name
+func (d *Document) Schema(name string) (*openapi3.SchemaRef, bool) {
+	if d.Components == nil {
+		return nil, false
+	}
+	schema, ok := d.Components.Schemas[name]
+	return schema, ok
+}
+
+// ResponseSchema returns the JSON schema of an operation's response for a
+// status code
+func (d *Document) ResponseSchema(method, path string, status int) (*openapi3.SchemaRef, error) {
+	item := d.Paths.Value(path)
+	if item == nil {
+		return nil, fmt.Errorf("no path %s", path)
+	}
+	op := item.GetOperation(strings.ToUpper(method))
+	if op == nil {
+		return nil, fmt.Errorf("no operation %s %s", strings.ToUpper(method), path)
+	}
+	response := op.Responses.Status(status)
+	if response == nil || response.Value == nil {
+		return nil, fmt.Errorf("%s %s declares no %d response", strings.ToUpper(method), path, status)
+	}
+	media := response.Value.Content.Get("application/json")
+	if media == nil || media.Schema == nil {
+		return nil, fmt.Errorf("%s %s %d has no JSON schema", strings.ToUpper(method), path, status)
+	}
+	return media.Schema, nil
+}
+
+// Options adjust validation
+type Options struct {
+	// Strict rejects properties an object schema does not declare, unless
+	// it sets additionalProperties. OpenAPI allows them by default; contract
+	// tests use Strict to catch fields missing from the spec.
+	Strict bool
+}
+
+// ValidationError lists every way a value fails its schema
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// ValidateJSON decodes data and validates it against schema
+func (d *Document) ValidateJSON(data []byte, schema *openapi3.SchemaRef, opts Options) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return &ValidationError{Problems: []string{fmt.Sprintf("body: invalid JSON: %v", err)}}
+	}
+	return d.Validate(value, schema, opts)
+}
+
+// Validate checks a decoded JSON value against schema
+func (d *Document) Validate(value interface{}, schema *openapi3.SchemaRef, opts Options) error {
+	var problems []string
+	if err := schema.Value.VisitJSON(value, openapi3.MultiErrors()); err != nil {
+		problems = schemaProblems("body", err)
+	}
+	if opts.Strict {
+		problems = append(problems, undeclared("body", value, schema.Value)...)
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// schemaProblems flattens the schema errors kin-openapi reports for a
+// value at prefix
+func schemaProblems(prefix string, err error) []string {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		var problems []string
+		for _, err := range multi {
+			problems = append(problems, schemaProblems(prefix, err)...)
+		}
+		return problems
+	}
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		return []string{fieldPath(prefix, schemaErr.JSONPointer()) + ": " + schemaErr.Reason}
+	}
+	return []string{prefix + ": " + err.Error()}
+}
+
+// fieldPath appends a JSON pointer to prefix, with array indexes in
+// brackets
+func fieldPath(prefix string, pointer []string) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	for _, key := range pointer {
+		if _, err := strconv.Atoi(key); err == nil {
+			b.WriteString("[" + key + "]")
+		} else {
+			b.WriteString("." + key)
+		}
+	}
+	return b.String()
+}
+
+// undeclared lists the properties of value its object schemas neither
+// declare nor allow with additionalProperties, which kin-openapi accepts.
+// An object schema without properties is free-form.
+func undeclared(path string, value interface{}, schema *openapi3.Schema) []string {
+	if schema == nil {
+		return nil
+	}
+	var problems []string
+	switch value := value.(type) {
+	case map[string]interface{}:
+		additional := schema.AdditionalProperties
+		for _, name := range sortedKeys(value) {
+			at := path + "." + name
+			if prop, ok := schema.Properties[name]; ok {
+				problems = append(problems, undeclared(at, value[name], prop.Value)...)
+			} else if additional.Schema != nil {
+				problems = append(problems, undeclared(at, value[name], additional.Schema.Value)...)
+			} else if len(schema.Properties) > 0 && (additional.Has == nil || !*additional.Has) {
+				problems = append(problems, at+": is not declared in the schema")
+			}
+		}
+	case []interface{}:
+		if schema.Items == nil {
+			return nil
+		}
+		for i, item := range value {
+			problems = append(problems, undeclared(fmt.Sprintf("%s[%d]", path, i), item, schema.Items.Value)...)
+		}
+	}
+	return problems
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
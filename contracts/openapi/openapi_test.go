@@ -0,0 +1,214 @@
+package openapi
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSpec = `
+openapi: 3.0.3
+info:
+  title: Test
+  version: "1"
+paths:
+  /widgets:
+    post:
+      responses:
+        '201':
+          description: Created
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Widget'
+components:
+  schemas:
+    Widget:
+      type: object
+      required: [name, size]
+      properties:
+        name:
+          type: string
+        size:
+          type: integer
+          minimum: 1
+        colour:
+          type: string
+          enum: [red, blue]
+        note:
+          type: string
+          nullable: true
+        parts:
+          type: array
+          minItems: 1
+          items:
+            $ref: '#/components/schemas/Widget'
+        labels:
+          type: object
+          additionalProperties:
+            type: string
+`
+
+func TestValidate(t *testing.T) {
+	doc, err := Parse([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := doc.ResponseSchema("post", "/widgets", 201)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		strict bool
+		want   []string
+	}{
+		{"valid", `{"name": "w", "size": 2, "note": null, "labels": {"a": "b"}}`, true, nil},
+		{"missing required", `{"name": "w"}`, false, []string{`body.size: property "size" is missing`}},
+		{"wrong types", `{"name": 1, "size": 1.5}`, false, []string{
+			"body.name: value must be a string",
+			"body.size: value must be an integer",
+		}},
+		{"below minimum", `{"name": "w", "size": 0}`, false, []string{"body.size: number must be at least 1"}},
+		{"enum", `{"name": "w", "size": 1, "colour": "green"}`, false, []string{`body.colour: value is not one of the allowed values ["red","blue"]`}},
+		{"nested", `{"name": "w", "size": 1, "parts": [{"name": "p"}]}`, false, []string{`body.parts[0].size: property "size" is missing`}},
+		{"empty array", `{"name": "w", "size": 1, "parts": []}`, false, []string{"body.parts: minimum number of items is 1"}},
+		{"additional properties", `{"name": "w", "size": 1, "labels": {"a": 1}}`, false, []string{"body.labels.a: value must be a string"}},
+		{"undeclared lenient", `{"name": "w", "size": 1, "extra": true}`, false, nil},
+		{"undeclared strict", `{"name": "w", "size": 1, "extra": true}`, true, []string{"body.extra: is not declared in the schema"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := doc.ValidateJSON([]byte(tt.body), schema, Options{Strict: tt.strict})
+			var got []string
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				got = validationErr.Problems
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejectsUnresolvedRefs(t *testing.T) {
+	_, err := Parse([]byte(`
+openapi: 3.0.3
+info: {title: Test, version: "1"}
+paths: {}
+components:
+  schemas:
+    Widget:
+      type: object
+      properties:
+        part:
+          $ref: '#/components/schemas/Part'
+`))
+	if err == nil {
+		t.Fatal("expected the unresolved reference to be rejected")
+	}
+}
+
+const routeSpec = `
+openapi: 3.0.3
+info: {title: Test, version: "1"}
+paths:
+  /widgets/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema: {type: integer}
+    put:
+      parameters:
+        - name: force
+          in: query
+          schema: {type: boolean}
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name]
+              properties:
+                name: {type: string}
+      responses:
+        '200': {description: Updated}
+  /widgets/latest:
+    put:
+      responses:
+        '200': {description: Updated}
+`
+
+func TestFindRoute(t *testing.T) {
+	doc, err := Parse([]byte(routeSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	route, ok := doc.FindRoute("put", "/widgets/7")
+	if !ok || route.Path != "/widgets/{id}" || route.PathParams["id"] != "7" {
+		t.Errorf("FindRoute(/widgets/7) = %+v, %v", route, ok)
+	}
+	if route, ok := doc.FindRoute("PUT", "/widgets/latest"); !ok || route.Path != "/widgets/latest" {
+		t.Errorf("literal template should win, got %+v", route)
+	}
+	if _, ok := doc.FindRoute("GET", "/widgets/7"); ok {
+		t.Error("undeclared method should not match")
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	doc, err := Parse([]byte(routeSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		want   []string
+	}{
+		{"valid", "/widgets/7?force=true", `{"name": "w"}`, nil},
+		{"bad path parameter", "/widgets/seven", `{"name": "w"}`, []string{"path.id: an invalid integer"}},
+		{"bad query parameter", "/widgets/7?force=maybe", `{"name": "w"}`, []string{"query.force: an invalid boolean"}},
+		{"missing body", "/widgets/7", ``, []string{"body: value is required but missing"}},
+		{"invalid body", "/widgets/7", `{"name": 1}`, []string{"body.name: value must be a string"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, tt.target, strings.NewReader(tt.body))
+			route, ok := doc.FindRoute(r.Method, r.URL.Path)
+			if !ok {
+				t.Fatal("no route")
+			}
+			err := doc.ValidateRequest(r, route, Options{})
+			var got []string
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				got = validationErr.Problems
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems = %q, want %q", got, tt.want)
+			}
+
+			// The body is still there for the handler
+			if body, _ := io.ReadAll(r.Body); string(body) != tt.body {
+				t.Errorf("body after validation = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
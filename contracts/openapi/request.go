@@ -0,0 +1,121 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+)
+
+// Route is the operation of a document a request resolves to
+type Route struct {
+	// Path is the matched path template, e.g. /v1/workflows/{id}
+	Path      string
+	Method    string
+	Operation *openapi3.Operation
+	// PathParams holds the values of the path's template segments
+	PathParams map[string]string
+
+	route *routers.Route
+}
+
+// FindRoute matches a request method and path to an operation
+func (d *Document) FindRoute(method, path string) (*Route, bool) {
+	req, err := http.NewRequest(strings.ToUpper(method), path, nil)
+	if err != nil {
+		return nil, false
+	}
+	route, params, err := d.router.FindRoute(req)
+	if err != nil {
+		return nil, false
+	}
+	return &Route{
+		Path:       route.Path,
+		Method:     route.Method,
+		Operation:  route.Operation,
+		PathParams: params,
+		route:      route,
+	}, true
+}
+
+// ValidateRequest checks a request's path and query parameters and JSON
+// body against the route's operation. The body is read and replaced, so
+// handlers can still decode it. A body without a Content-Type is
+// validated as JSON. Authentication is left to the caller.
+func (d *Document) ValidateRequest(r *http.Request, route *Route, opts Options) error {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	checked := r.Clone(r.Context())
+	checked.Body = io.NopCloser(bytes.NewReader(data))
+	if len(data) == 0 {
+		checked.Body = http.NoBody
+	}
+	if checked.Header.Get("Content-Type") == "" {
+		checked.Header.Set("Content-Type", "application/json")
+	}
+
+	var problems []string
+	err = openapi3filter.ValidateRequest(checked.Context(), &openapi3filter.RequestValidationInput{
+		Request:    checked,
+		PathParams: route.PathParams,
+		Route:      route.route,
+		Options: &openapi3filter.Options{
+			MultiError:         true,
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	})
+	if err != nil {
+		var multi openapi3.MultiError
+		if !errors.As(err, &multi) {
+			multi = openapi3.MultiError{err}
+		}
+		for _, err := range multi {
+			problems = append(problems, requestProblems(err)...)
+		}
+	}
+	if body := route.Operation.RequestBody; opts.Strict && body != nil && len(data) > 0 {
+		var value interface{}
+		media := body.Value.Content.Get("application/json")
+		if media != nil && media.Schema != nil && json.Unmarshal(data, &value) == nil {
+			problems = append(problems, undeclared("body", value, media.Schema.Value)...)
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// requestProblems names the parameter or body a request error is about
+func requestProblems(err error) []string {
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		return []string{"request: " + err.Error()}
+	}
+
+	prefix := "body"
+	if param := requestErr.Parameter; param != nil {
+		prefix = param.In + "." + param.Name
+	}
+	var parseErr *openapi3filter.ParseError
+	switch {
+	case requestErr.Err == nil:
+		return []string{prefix + ": " + requestErr.Reason}
+	case errors.As(requestErr.Err, &parseErr):
+		return []string{prefix + ": " + parseErr.Reason}
+	default:
+		return schemaProblems(prefix, requestErr.Err)
+	}
+}
@@ -0,0 +1,74 @@
+package contracts
+
+import "time"
+
+// TemplatePlan is a plan of values PLM must resolve, sent to /enrich-plan.
+// Values are resolved against Revision, or the current revision if empty.
+type TemplatePlan struct {
+	Product    string              `json:"product" binding:"required"`
+	Revision   string              `json:"revision,omitempty"`
+	Components []ComponentTemplate `json:"components" binding:"required"`
+}
+
+// ComponentTemplate is a component whose voltage PLM must resolve
+type ComponentTemplate struct {
+	Name    string `json:"name" binding:"required"`
+	Voltage string `json:"voltage"`
+}
+
+// EnrichedPlan is the template plan with the values PLM resolved, and the
+// revision they were resolved against
+type EnrichedPlan struct {
+	Product    string              `json:"product"`
+	Revision   string              `json:"revision,omitempty"`
+	Components []EnrichedComponent `json:"components"`
+}
+
+// EnrichedComponent is a component with its resolved voltage
+type EnrichedComponent struct {
+	Name     string `json:"name"`
+	Voltage  string `json:"voltage"`
+	TestType string `json:"test_type"`
+}
+
+// ProductComponents lists the test components PLM records for a product,
+// returned by /products/{name}/components
+type ProductComponents struct {
+	Product    string             `json:"product"`
+	Revision   string             `json:"revision"`
+	Components []ProductComponent `json:"components"`
+}
+
+// ProductRevision is one revision of a product with the voltage and test
+// components PLM records for it, returned by /products/{name}/revisions/{rev}
+type ProductRevision struct {
+	Product  string `json:"product"`
+	Revision string `json:"revision"`
+	// Current is set for the product's latest revision
+	Current    bool               `json:"current"`
+	Voltage    string             `json:"voltage"`
+	Components []ProductComponent `json:"components"`
+}
+
+// ProductComponent is one test component of a product
+type ProductComponent struct {
+	Name     string `json:"name"`
+	Voltage  string `json:"voltage"`
+	TestType string `json:"test_type"`
+}
+
+// ReleaseStatusUpdate is posted to /products/{name}/release-status to record
+// the release state of a product revision
+type ReleaseStatusUpdate struct {
+	Revision   string `json:"revision"`
+	Status     string `json:"status" binding:"required"`
+	Reason     string `json:"reason,omitempty"`
+	WorkflowID string `json:"workflow_id,omitempty"`
+}
+
+// ReleaseStatus is the release state PLM records for a product
+type ReleaseStatus struct {
+	Product string `json:"product"`
+	ReleaseStatusUpdate
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Approval decisions accepted by the approvals endpoint
+const (
+	decisionApprove = "approve"
+	decisionReject  = "reject"
+)
+
+var (
+	// errNotAwaitingApproval is returned when a decision arrives for a run
+	// with no outstanding approval
+	errNotAwaitingApproval = errors.New("workflow is not awaiting approval")
+	// errNotApprover is returned when the caller may not decide the approval
+	errNotApprover = errors.New("caller is not an approver for this step")
+)
+
+// approvalConfig is the `with` block of a wait_for_approval step
+type approvalConfig struct {
+	// Approvers lists the caller identities allowed to decide; empty
+	// allows any authenticated caller
+	Approvers []string `yaml:"approvers"`
+	// Timeout rejects the approval when no decision arrives in time
+	Timeout Duration `yaml:"timeout"`
+	// EscalateAfter adds EscalateTo to the approvers when no decision
+	// arrives in time
+	EscalateAfter Duration `yaml:"escalate_after"`
+	EscalateTo    []string `yaml:"escalate_to"`
+}
+
+// parseApprovalConfig decodes and checks a wait_for_approval step
+func parseApprovalConfig(step StepDefinition) (approvalConfig, error) {
+	var cfg approvalConfig
+	if err := decodeWith(step, &cfg); err != nil {
+		return cfg, err
+	}
+
+	switch {
+	case cfg.Timeout < 0:
+		return cfg, errors.New("timeout: must not be negative")
+	case cfg.EscalateAfter < 0:
+		return cfg, errors.New("escalate_after: must not be negative")
+	case cfg.EscalateAfter > 0 && len(cfg.EscalateTo) == 0:
+		return cfg, errors.New("escalate_to: required when escalate_after is set")
+	case cfg.EscalateAfter == 0 && len(cfg.EscalateTo) > 0:
+		return cfg, errors.New("escalate_after: required when escalate_to is set")
+	case cfg.Timeout > 0 && cfg.EscalateAfter >= cfg.Timeout:
+		return cfg, errors.New("escalate_after: must be shorter than timeout")
+	}
+	return cfg, nil
+}
+
+// validateApprovalStep checks a wait_for_approval step when definitions load
+func validateApprovalStep(step StepDefinition) error {
+	_, err := parseApprovalConfig(step)
+	return err
+}
+
+// pendingApproval is an outstanding sign-off request on a suspended run
+type pendingApproval struct {
+	Step        string     `json:"step"`
+	Approvers   []string   `json:"approvers,omitempty"`
+	RequestedAt time.Time  `json:"requested_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	EscalatedAt *time.Time `json:"escalated_at,omitempty"`
+
+	config approvalConfig
+	timers []*time.Timer
+}
+
+// allows reports whether approver may decide this approval
+func (a *pendingApproval) allows(approver string) bool {
+	if len(a.Approvers) == 0 {
+		return true
+	}
+	for _, name := range a.Approvers {
+		if name == approver {
+			return true
+		}
+	}
+	return false
+}
+
+// stop cancels the approval's timeout and escalation timers
+func (a *pendingApproval) stop() {
+	for _, timer := range a.timers {
+		timer.Stop()
+	}
+}
+
+// ApprovalRequest is the body of POST /v1/workflows/{id}/approvals
+type ApprovalRequest struct {
+	Decision string `json:"decision"`
+	Comment  string `json:"comment,omitempty"`
+	// Approver names the approver when authentication is disabled; with
+	// token auth it must match the authenticated caller if given
+	Approver string `json:"approver,omitempty"`
+}
+
+// stepWaitForApproval suspends the run until an approver decides
+func (s *BPOService) stepWaitForApproval(ctx context.Context, run *workflowRun, step StepDefinition) (map[string]interface{}, error) {
+	cfg, err := parseApprovalConfig(step)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	approval := &pendingApproval{
+		Step:        step.ID,
+		Approvers:   cfg.Approvers,
+		RequestedAt: now,
+		config:      cfg,
+	}
+	details := map[string]interface{}{
+		"step":      step.ID,
+		"approvers": cfg.Approvers,
+	}
+	if cfg.Timeout > 0 {
+		expires := now.Add(time.Duration(cfg.Timeout))
+		approval.ExpiresAt = &expires
+		details["expires_at"] = expires
+	}
+	if cfg.EscalateAfter > 0 {
+		details["escalate_after"] = time.Duration(cfg.EscalateAfter).String()
+		details["escalate_to"] = cfg.EscalateTo
+	}
+	s.auditRun(run, "approval_requested", "waiting", details, nil)
+
+	s.runsMu.Lock()
+	run.approval = approval
+	if cfg.EscalateAfter > 0 {
+		approval.timers = append(approval.timers, time.AfterFunc(time.Duration(cfg.EscalateAfter), func() {
+			s.escalateApproval(run, approval)
+		}))
+	}
+	if cfg.Timeout > 0 {
+		approval.timers = append(approval.timers, time.AfterFunc(time.Duration(cfg.Timeout), func() {
+			s.expireApproval(run, approval)
+		}))
+	}
+	s.runsMu.Unlock()
+
+	log.Printf("Workflow %s awaiting approval at %s", run.ID, step.ID)
+	return nil, &suspension{
+		Status:  runAwaitingApproval,
+		Message: fmt.Sprintf("Workflow is awaiting approval at %s", step.ID),
+	}
+}
+
+// claimApproval takes the outstanding approval of a run for approver so no
+// other decision, timeout or escalation can act on it
+func (s *BPOService) claimApproval(run *workflowRun, approver string) (*pendingApproval, error) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	approval := run.approval
+	if run.status != runAwaitingApproval || approval == nil {
+		return nil, errNotAwaitingApproval
+	}
+	if !approval.allows(approver) {
+		return nil, errNotApprover
+	}
+
+	approval.stop()
+	run.approval = nil
+	run.status = runRunning
+	return approval, nil
+}
+
+// escalateApproval widens the approvers of an approval that is still
+// outstanding after its escalation delay
+func (s *BPOService) escalateApproval(run *workflowRun, approval *pendingApproval) {
+	s.runsMu.Lock()
+	if run.approval != approval {
+		s.runsMu.Unlock()
+		return
+	}
+	now := time.Now()
+	approval.EscalatedAt = &now
+	// An approval open to everyone already includes the escalation targets
+	if len(approval.Approvers) > 0 {
+		approvers := make([]string, 0, len(approval.Approvers)+len(approval.config.EscalateTo))
+		approvers = append(approvers, approval.Approvers...)
+		approval.Approvers = append(approvers, approval.config.EscalateTo...)
+	}
+	approvers := approval.Approvers
+	s.runsMu.Unlock()
+
+	log.Printf("Workflow %s approval at %s escalated to %v", run.ID, approval.Step, approval.config.EscalateTo)
+	s.auditRun(run, "approval_escalated", "waiting", map[string]interface{}{
+		"step":        approval.Step,
+		"escalate_to": approval.config.EscalateTo,
+		"approvers":   approvers,
+	}, nil)
+}
+
+// expireApproval rejects an approval that is still outstanding at its
+// timeout, ending the workflow. A decision being recorded at the same
+// moment wins; at shutdown the run is left to be interrupted.
+func (s *BPOService) expireApproval(run *workflowRun, approval *pendingApproval) {
+	if err := s.beginWorkflow(run); err != nil {
+		return
+	}
+
+	s.runsMu.Lock()
+	if run.approval != approval {
+		s.runsMu.Unlock()
+		s.endWorkflow(run, nil)
+		return
+	}
+	approval.stop()
+	run.approval = nil
+	s.runsMu.Unlock()
+
+	timeout := time.Duration(approval.config.Timeout)
+	log.Printf("Workflow %s approval at %s timed out after %s", run.ID, approval.Step, timeout)
+	s.auditRun(run, "approval_timed_out", "rejected", map[string]interface{}{
+		"step":    approval.Step,
+		"timeout": timeout.String(),
+	}, nil)
+	s.rejectRun(run.ctx, run, fmt.Errorf("approval at %s timed out after %s", approval.Step, timeout))
+	s.endWorkflow(run, nil)
+}
+
+// rejectRun ends a run whose approval was refused or timed out. Steps the
+// run completed before the approval are compensated as for a failed run,
+// leaving it compensated rather than rejected. It returns the reason
+// annotated with the outcome of compensation.
+func (s *BPOService) rejectRun(ctx context.Context, run *workflowRun, reason error) error {
+	s.auditRun(run, "workflow_rejected", "rejected", nil, reason)
+	if len(run.compensations) == 0 {
+		s.setRunStatus(run, runRejected, reason)
+		return reason
+	}
+	return s.compensate(ctx, run, reason)
+}
+
+// interruptSuspendedRuns records runs still awaiting a decision at shutdown
+// as interrupted; their state does not survive a restart
+func (s *BPOService) interruptSuspendedRuns() {
+	s.runsMu.Lock()
+	var suspended []*workflowRun
+	for _, run := range s.runs {
+		if run.approval != nil {
+			run.approval.stop()
+			run.approval = nil
+			suspended = append(suspended, run)
+		} else if run.status == runPaused {
+			suspended = append(suspended, run)
+		}
+	}
+	s.runsMu.Unlock()
+
+	for _, run := range suspended {
+		s.markInterrupted(run)
+	}
+}
+
+// handleApproval records an approve or reject decision on a suspended run.
+// Approval resumes the run with the next step and responds like a trigger.
+func (s *BPOService) handleApproval(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	run, ok := s.findRun(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "workflow_not_found", fmt.Sprintf("Workflow %s is not known", id))
+		return
+	}
+
+	var request ApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Failed to decode JSON request")
+		return
+	}
+	if request.Decision != decisionApprove && request.Decision != decisionReject {
+		writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("decision must be %q or %q", decisionApprove, decisionReject))
+		return
+	}
+
+	approver := callerFromContext(r.Context())
+	if request.Approver != "" {
+		if approver != anonymousCaller && request.Approver != approver {
+			writeError(w, http.StatusForbidden, "approver_mismatch", "approver must match the authenticated caller")
+			return
+		}
+		approver = request.Approver
+	}
+
+	if err := s.beginWorkflow(run); err != nil {
+		if errors.Is(err, errShuttingDown) {
+			writeError(w, http.StatusServiceUnavailable, "shutting_down", err.Error())
+		} else {
+			writeError(w, http.StatusConflict, "workflow_busy", err.Error())
+		}
+		return
+	}
+
+	approval, err := s.claimApproval(run, approver)
+	if err != nil {
+		s.endWorkflow(run, nil)
+		if errors.Is(err, errNotApprover) {
+			log.Printf("Refused approval of workflow %s by %s: %v", run.ID, approver, err)
+			writeError(w, http.StatusForbidden, "not_an_approver", err.Error())
+		} else {
+			writeError(w, http.StatusConflict, "not_awaiting_approval", err.Error())
+		}
+		return
+	}
+
+	action, status := "approval_granted", "approved"
+	if request.Decision == decisionReject {
+		action, status = "approval_rejected", "rejected"
+	}
+	log.Printf("Workflow %s %s at %s by %s", run.ID, status, approval.Step, approver)
+	s.auditRun(run, action, status, map[string]interface{}{
+		"step":      approval.Step,
+		"approver":  approver,
+		"comment":   request.Comment,
+		"escalated": approval.EscalatedAt != nil,
+	}, nil)
+
+	if request.Decision == decisionReject {
+		err := s.rejectRun(run.ctx, run, fmt.Errorf("rejected at %s by %s", approval.Step, approver))
+		s.endWorkflow(run, nil)
+		writeJSON(w, http.StatusOK, WorkflowResponse{
+			Status:     runRejected,
+			WorkflowID: run.ID,
+			Message:    "Workflow " + err.Error(),
+		})
+		return
+	}
+
+	// The approval step is complete; carry on with the one after it
+	run.next++
+	response, err := s.executeRun(run.ctx, run)
+	s.endWorkflow(run, err)
+	writeRunResult(w, run, response, err)
+}
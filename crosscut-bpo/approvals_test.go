@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"crosscut-contracts/bpo"
+)
+
+// approvalHarness starts the services with a release workflow that waits
+// for approval, configured by with, before generating the document
+func approvalHarness(t *testing.T, with string) *harness {
+	t.Helper()
+	return newDefinitionsHarness(t, fmt.Sprintf(`
+name: approved-release
+version: 1
+trigger: release.approved
+inputs:
+  product_name:
+    required: true
+  revision: {}
+steps:
+  - id: template_plan_generated
+    type: generate_template_plan
+  - id: plm_consultation
+    type: consult_plm
+  - id: document_plan_built
+    type: build_document_plan
+  - id: release_approved
+    type: wait_for_approval
+    with: %s
+  - id: docgen_command
+    type: command_docgen
+`, with))
+}
+
+// awaitApproval triggers the approved release and checks it suspends
+func (h *harness) awaitApproval() string {
+	h.t.Helper()
+	response, err := h.trigger("release.approved", routerRelease)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	if response.Status != runAwaitingApproval {
+		h.t.Fatalf("response = %+v, want %s", response, runAwaitingApproval)
+	}
+	return response.WorkflowID
+}
+
+// status returns a run's status through the API
+func (h *harness) status(id string) *bpo.WorkflowStatus {
+	h.t.Helper()
+	status, err := bpo.Decode[bpo.WorkflowStatus](h.client.GetWorkflow(context.Background(), id))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return status
+}
+
+func TestApprovalResumesWorkflow(t *testing.T) {
+	h := approvalHarness(t, "{approvers: [qa-lead]}")
+	ctx := context.Background()
+
+	id := h.awaitApproval()
+	status := h.status(id)
+	if status.Status != runAwaitingApproval || status.Approval == nil || status.Approval.Step != "release_approved" {
+		t.Fatalf("status = %+v, want awaiting approval at release_approved", status)
+	}
+	if n := h.requests("docgen", http.MethodPost, "/generate"); n != 0 {
+		t.Errorf("DocGen received %d generate requests before approval", n)
+	}
+
+	var apiErr *bpo.Error
+	_, err := bpo.Decode[bpo.WorkflowResponse](h.client.DecideApproval(ctx, id, bpo.ApprovalRequest{Decision: decisionApprove, Approver: "intern"}))
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || apiErr.Code != "not_an_approver" {
+		t.Errorf("approval by a non-approver: error = %v, want 403 not_an_approver", err)
+	}
+
+	response, err := bpo.Decode[bpo.WorkflowResponse](h.client.DecideApproval(ctx, id, bpo.ApprovalRequest{Decision: decisionApprove, Approver: "qa-lead", Comment: "looks good"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "success" || response.DocumentURL == "" {
+		t.Errorf("response = %+v, want the generated document", response)
+	}
+	h.assertAuditTrail(id,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"approval_requested waiting",
+		"approval_granted approved",
+		"docgen_command success",
+		"workflow_completed success",
+	)
+	if approver := h.auditEntry(id, "approval_granted").Details["approver"]; approver != "qa-lead" {
+		t.Errorf("approval audited for %v, want qa-lead", approver)
+	}
+
+	_, err = bpo.Decode[bpo.WorkflowResponse](h.client.DecideApproval(ctx, id, bpo.ApprovalRequest{Decision: decisionApprove, Approver: "qa-lead"}))
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict || apiErr.Code != "not_awaiting_approval" {
+		t.Errorf("second decision: error = %v, want 409 not_awaiting_approval", err)
+	}
+}
+
+func TestRejectedApprovalEndsWorkflow(t *testing.T) {
+	h := approvalHarness(t, "{approvers: [qa-lead]}")
+
+	id := h.awaitApproval()
+	response, err := bpo.Decode[bpo.WorkflowResponse](h.client.DecideApproval(context.Background(), id, bpo.ApprovalRequest{Decision: decisionReject, Approver: "qa-lead"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Status != runRejected {
+		t.Errorf("response = %+v, want %s", response, runRejected)
+	}
+	if status := h.status(id); status.Status != runRejected || status.FinishedAt == nil {
+		t.Errorf("status = %+v, want finished as %s", status, runRejected)
+	}
+	h.assertAuditTrail(id,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"approval_requested waiting",
+		"approval_rejected rejected",
+		"workflow_rejected rejected",
+	)
+}
+
+func TestApprovalEscalates(t *testing.T) {
+	h := approvalHarness(t, "{approvers: [qa-lead], escalate_after: 50ms, escalate_to: [release-manager], timeout: 1m}")
+	ctx := context.Background()
+
+	id := h.awaitApproval()
+	var apiErr *bpo.Error
+	_, err := bpo.Decode[bpo.WorkflowResponse](h.client.DecideApproval(ctx, id, bpo.ApprovalRequest{Decision: decisionApprove, Approver: "release-manager"}))
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("approval before escalation: error = %v, want 403", err)
+	}
+
+	h.eventually("the approval to escalate", func() bool {
+		return h.status(id).Approval.EscalatedAt != nil
+	})
+	if approvers := h.status(id).Approval.Approvers; len(approvers) != 2 || approvers[1] != "release-manager" {
+		t.Errorf("approvers after escalation = %v, want qa-lead and release-manager", approvers)
+	}
+
+	response, err := bpo.Decode[bpo.WorkflowResponse](h.client.DecideApproval(ctx, id, bpo.ApprovalRequest{Decision: decisionApprove, Approver: "release-manager"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "success" {
+		t.Errorf("response = %+v", response)
+	}
+	if escalated := h.auditEntry(id, "approval_granted").Details["escalated"]; escalated != true {
+		t.Errorf("approval_granted escalated = %v, want true", escalated)
+	}
+	h.assertAuditTrail(id,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"approval_requested waiting",
+		"approval_escalated waiting",
+		"approval_granted approved",
+		"docgen_command success",
+		"workflow_completed success",
+	)
+}
+
+func TestApprovalTimesOut(t *testing.T) {
+	h := approvalHarness(t, "{approvers: [qa-lead], timeout: 50ms}")
+
+	id := h.awaitApproval()
+	if h.status(id).Approval.ExpiresAt == nil {
+		t.Error("approval has no expiry")
+	}
+	h.eventually("the approval to time out", func() bool {
+		return h.status(id).Status == runRejected
+	})
+
+	h.assertAuditTrail(id,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"approval_requested waiting",
+		"approval_timed_out rejected",
+		"workflow_rejected rejected",
+	)
+	var apiErr *bpo.Error
+	_, err := bpo.Decode[bpo.WorkflowResponse](h.client.DecideApproval(context.Background(), id, bpo.ApprovalRequest{Decision: decisionApprove, Approver: "qa-lead"}))
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("approval after the timeout: error = %v, want 409", err)
+	}
+}
+
+func TestRunningCountsIncludeSuspendedRuns(t *testing.T) {
+	h := approvalHarness(t, "{approvers: [qa-lead]}")
+	id := h.awaitApproval()
+
+	info, err := bpo.Decode[bpo.DefinitionInfo](h.client.GetDefinition(context.Background(), "approved-release"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Versions) != 1 || info.Versions[0].RunningCount != 1 {
+		t.Errorf("with a run awaiting approval: %+v, want a running count of 1", info.Versions)
+	}
+
+	if _, err := bpo.Decode[bpo.WorkflowResponse](h.client.DecideApproval(context.Background(), id, bpo.ApprovalRequest{Decision: decisionReject, Approver: "qa-lead"})); err != nil {
+		t.Fatal(err)
+	}
+	info, err = bpo.Decode[bpo.DefinitionInfo](h.client.GetDefinition(context.Background(), "approved-release"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Versions[0].RunningCount != 0 {
+		t.Errorf("once rejected: %+v, want a running count of 0", info.Versions)
+	}
+}
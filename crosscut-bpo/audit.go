@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// AuditStore persists the process audit trail
+type AuditStore interface {
+	// Append adds an entry to the trail
+	Append(entry AuditEntry) error
+	// Check verifies the store can currently accept writes
+	Check() error
+	// Target describes where entries are written
+	Target() string
+}
+
+// newAuditStore creates the audit store selected by the configuration
+func newAuditStore(cfg AuditConfig) (AuditStore, error) {
+	switch cfg.Backend {
+	case auditBackendFile:
+		return &fileAuditStore{path: cfg.Path}, nil
+	case auditBackendMemory:
+		return &memoryAuditStore{}, nil
+	default:
+		return nil, fmt.Errorf("unknown audit backend: %s", cfg.Backend)
+	}
+}
+
+// fileAuditStore keeps the audit trail as a JSON array in a single file
+type fileAuditStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Append writes an entry to the audit log
+func (f *fileAuditStore) Append(entry AuditEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	absPath, err := filepath.Abs(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	// Read existing entries
+	var entries []AuditEntry
+	if data, err := os.ReadFile(absPath); err == nil && len(data) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			log.Printf("Warning: failed to unmarshal existing audit log: %v", err)
+			entries = []AuditEntry{} // Start fresh if corrupted
+		}
+	}
+
+	// Append new entry
+	entries = append(entries, entry)
+
+	// Write back to file
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entries: %w", err)
+	}
+
+	if err := os.WriteFile(absPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	return nil
+}
+
+// Check verifies the audit log could be written without creating or
+// modifying it: an existing log must open for writing, and its directory
+// must take a probe file, which catches read-only mounts and full disks
+// that permission bits do not show
+func (f *fileAuditStore) Check() error {
+	absPath, err := filepath.Abs(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	dir := filepath.Dir(absPath)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("audit directory unavailable: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("audit directory %s is not a directory", dir)
+	}
+
+	file, err := os.OpenFile(absPath, os.O_WRONLY|os.O_APPEND, 0)
+	switch {
+	case err == nil:
+		file.Close()
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("audit log is not writable: %w", err)
+	}
+	if err := probeWritable(dir); err != nil {
+		return fmt.Errorf("audit directory %s is not writable: %w", dir, err)
+	}
+	return nil
+}
+
+// probeWritable writes, syncs and removes a temporary file in dir
+func probeWritable(dir string) error {
+	probe, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(probe.Name())
+
+	_, err = probe.Write([]byte("ok"))
+	if err == nil {
+		err = probe.Sync()
+	}
+	if closeErr := probe.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Target returns the audit log path
+func (f *fileAuditStore) Target() string {
+	return f.path
+}
+
+// memoryAuditStore keeps the audit trail in memory; it is lost on restart
+type memoryAuditStore struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+// Append adds an entry to the in-memory trail
+func (m *memoryAuditStore) Append(entry AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+// Check always succeeds for the in-memory store
+func (m *memoryAuditStore) Check() error {
+	return nil
+}
+
+// Target describes the in-memory store
+func (m *memoryAuditStore) Target() string {
+	return "memory"
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// anonymousCaller identifies callers when authentication is disabled
+const anonymousCaller = "anonymous"
+
+// callerKey is the context key holding the authenticated caller name
+type callerKey struct{}
+
+// callerFromContext returns the identity attached by the auth middleware
+func callerFromContext(ctx context.Context) string {
+	if caller, ok := ctx.Value(callerKey{}).(string); ok && caller != "" {
+		return caller
+	}
+	return anonymousCaller
+}
+
+// authenticate enforces the configured auth mode and attaches the caller
+// identity to the request context. Tokens are read from the current runtime
+// snapshot so reloads take effect immediately.
+func (s *BPOService) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.current().config.Auth
+		if cfg.Mode != authModeToken {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, anonymousCaller)))
+			return
+		}
+
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok {
+			for _, identity := range cfg.Tokens {
+				if subtle.ConstantTimeCompare([]byte(presented), []byte(identity.Token)) == 1 {
+					next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, identity.Name)))
+					return
+				}
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="crosscut-bpo"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":   "unauthorized",
+			"message": "A valid bearer token is required",
+		})
+	})
+}
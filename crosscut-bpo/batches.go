@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxRetainedBatches bounds how many batches are kept for inspection
+const maxRetainedBatches = 100
+
+// Batch statuses, aggregated from the statuses of their items
+const (
+	batchRunning   = "running"
+	batchSuspended = "suspended"
+	batchCompleted = "completed"
+	// batchCompletedWithFailures means every item finished but not all of
+	// them completed
+	batchCompletedWithFailures = "completed_with_failures"
+)
+
+// itemRejected marks a batch item refused before it started, e.g. for an
+// unknown trigger event or a missing input
+const itemRejected = "rejected"
+
+// BatchRequest is the body of POST /v1/execute-workflows:batch
+type BatchRequest struct {
+	Requests []WorkflowRequest `json:"requests"`
+	// Concurrency overrides the configured number of workflows run at once
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// batch is a set of workflows triggered together
+type batch struct {
+	ID          string
+	CreatedAt   time.Time
+	Concurrency int
+	Actor       string
+	items       []batchItem
+}
+
+// batchItem is one request of a batch and the run it started, if any
+type batchItem struct {
+	TriggerEvent string
+	run          *workflowRun
+	// err is why the item was rejected; run is nil when it is set
+	err error
+}
+
+// BatchItemStatus reports one item of a batch
+type BatchItemStatus struct {
+	Index        int        `json:"index"`
+	TriggerEvent string     `json:"trigger_event"`
+	WorkflowID   string     `json:"workflow_id,omitempty"`
+	Status       string     `json:"status"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	DocumentURL  string     `json:"document_url,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// BatchStatus is the externally visible state of a batch
+type BatchStatus struct {
+	BatchID     string         `json:"batch_id"`
+	Status      string         `json:"status"`
+	CreatedAt   time.Time      `json:"created_at"`
+	FinishedAt  *time.Time     `json:"finished_at,omitempty"`
+	Concurrency int            `json:"concurrency"`
+	Total       int            `json:"total"`
+	Counts      map[string]int `json:"counts"`
+	// Failures lists the items that did not complete, once they finished
+	Failures []BatchItemStatus `json:"failures,omitempty"`
+	Items    []BatchItemStatus `json:"items"`
+}
+
+// batchRegistry holds submitted batches, oldest evicted first
+type batchRegistry struct {
+	mu    sync.Mutex
+	byID  map[string]*batch
+	order []string
+	seq   uint64
+}
+
+// add registers a batch, assigning its ID
+func (r *batchRegistry) add(b *batch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	b.ID = fmt.Sprintf("batch-%d-%d", b.CreatedAt.Unix(), r.seq)
+	r.byID[b.ID] = b
+	r.order = append(r.order, b.ID)
+	for len(r.order) > maxRetainedBatches {
+		delete(r.byID, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// find returns a retained batch
+func (r *batchRegistry) find(id string) (*batch, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.byID[id]
+	return b, ok
+}
+
+// handleExecuteBatch accepts many workflow triggers at once. Every item is
+// validated and given its workflow ID up front; valid items are queued and
+// run in the background, at most Concurrency at a time.
+func (s *BPOService) handleExecuteBatch(w http.ResponseWriter, r *http.Request) {
+	var request BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Failed to decode JSON request")
+		return
+	}
+
+	limits := s.current().config.Batch
+	concurrency := request.Concurrency
+	if concurrency == 0 {
+		concurrency = limits.Concurrency
+	}
+	switch {
+	case len(request.Requests) == 0:
+		writeError(w, http.StatusBadRequest, "invalid_request", "requests must not be empty")
+		return
+	case len(request.Requests) > limits.MaxItems:
+		writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("a batch holds at most %d requests", limits.MaxItems))
+		return
+	case concurrency < 1 || concurrency > limits.MaxConcurrency:
+		writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("concurrency must be between 1 and %d", limits.MaxConcurrency))
+		return
+	}
+	if s.isDraining() {
+		writeError(w, http.StatusServiceUnavailable, "shutting_down", errShuttingDown.Error())
+		return
+	}
+
+	b := &batch{
+		CreatedAt:   time.Now(),
+		Concurrency: concurrency,
+		Actor:       callerFromContext(r.Context()),
+		items:       make([]batchItem, len(request.Requests)),
+	}
+	var queued []*workflowRun
+	for i, item := range request.Requests {
+		b.items[i].TriggerEvent = item.TriggerEvent
+		run, err := s.newRun(item.TriggerEvent, item.Payload)
+		if err != nil {
+			b.items[i].err = err
+			continue
+		}
+		b.items[i].run = run
+		s.trackRun(run)
+		s.setRunStatus(run, runQueued, nil)
+		queued = append(queued, run)
+	}
+	s.batches.add(b)
+
+	workflowIDs := make([]string, len(queued))
+	for i, run := range queued {
+		workflowIDs[i] = run.ID
+	}
+	log.Printf("Batch %s: %d workflow(s) queued, %d rejected, concurrency %d", b.ID, len(queued), len(b.items)-len(queued), concurrency)
+	if err := s.writeAuditEntry(AuditEntry{
+		Timestamp: time.Now(),
+		Event:     "batch",
+		Action:    "batch_submitted",
+		Status:    "success",
+		Details: map[string]interface{}{
+			"batch_id":     b.ID,
+			"actor":        b.Actor,
+			"items":        len(b.items),
+			"rejected":     len(b.items) - len(queued),
+			"concurrency":  concurrency,
+			"workflow_ids": workflowIDs,
+		},
+	}); err != nil {
+		log.Printf("Failed to write audit entry: %v", err)
+	}
+
+	go s.runBatch(b, queued)
+	writeJSON(w, http.StatusAccepted, s.batchStatus(b))
+}
+
+// runBatch executes the queued runs of a batch in order, keeping at most
+// the batch's concurrency running at once. It stops starting runs once the
+// service is draining; shutdown records those left queued as interrupted.
+func (s *BPOService) runBatch(b *batch, queued []*workflowRun) {
+	slots := make(chan struct{}, b.Concurrency)
+	var wg sync.WaitGroup
+	for i, run := range queued {
+		slots <- struct{}{}
+		if s.isDraining() {
+			log.Printf("Batch %s: service is shutting down, %d workflow(s) not started", b.ID, len(queued)-i)
+			break
+		}
+		wg.Add(1)
+		go func(run *workflowRun) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			s.runBatchItem(run)
+		}(run)
+	}
+	wg.Wait()
+	log.Printf("Batch %s: all workflows dispatched and returned", b.ID)
+}
+
+// runBatchItem starts one queued run unless it was cancelled while it
+// waited or the service began shutting down
+func (s *BPOService) runBatchItem(run *workflowRun) {
+	if err := s.beginWorkflow(run); err != nil {
+		s.runsMu.Lock()
+		status := run.status
+		s.runsMu.Unlock()
+		if errors.Is(err, errShuttingDown) && status == runQueued {
+			s.markInterrupted(run)
+		}
+		return
+	}
+
+	s.runsMu.Lock()
+	status := run.status
+	if status == runQueued {
+		run.status = runRunning
+	}
+	s.runsMu.Unlock()
+	if status != runQueued {
+		// Cancelled while queued
+		s.endWorkflow(run, nil)
+		return
+	}
+
+	response, err := s.executeRun(run.ctx, run)
+	s.endWorkflow(run, err)
+	switch {
+	case err != nil:
+		log.Printf("Batch workflow %s failed: %v", run.ID, err)
+	case response.Status != "success":
+		log.Printf("Batch workflow %s is %s", run.ID, response.Status)
+	}
+}
+
+// interruptQueuedRuns records batch items still waiting for a slot as
+// interrupted once the service drains; runBatch will not start them
+func (s *BPOService) interruptQueuedRuns() {
+	s.runsMu.Lock()
+	var queued []*workflowRun
+	for _, run := range s.runs {
+		if run.status == runQueued {
+			queued = append(queued, run)
+		}
+	}
+	s.runsMu.Unlock()
+
+	for _, run := range queued {
+		s.markInterrupted(run)
+	}
+}
+
+// batchStatus aggregates the current state of a batch's items
+func (s *BPOService) batchStatus(b *batch) BatchStatus {
+	status := BatchStatus{
+		BatchID:     b.ID,
+		CreatedAt:   b.CreatedAt,
+		Concurrency: b.Concurrency,
+		Total:       len(b.items),
+		Counts:      make(map[string]int),
+		Items:       make([]BatchItemStatus, len(b.items)),
+	}
+
+	active, suspended, failed := 0, 0, 0
+	var finishedAt *time.Time
+	for i, item := range b.items {
+		itemStatus := BatchItemStatus{
+			Index:        i,
+			TriggerEvent: item.TriggerEvent,
+		}
+		if item.run == nil {
+			itemStatus.Status = itemRejected
+			itemStatus.Error = item.err.Error()
+		} else {
+			run := s.runStatus(item.run)
+			itemStatus.WorkflowID = run.WorkflowID
+			itemStatus.Status = run.Status
+			itemStatus.FinishedAt = run.FinishedAt
+			itemStatus.DocumentURL = run.DocumentURL
+			itemStatus.Error = run.Error
+		}
+		status.Items[i] = itemStatus
+		status.Counts[itemStatus.Status]++
+
+		switch itemStatus.Status {
+		case runQueued, runRunning:
+			active++
+		case runAwaitingApproval, runPaused:
+			suspended++
+		case runCompleted:
+		default:
+			failed++
+			status.Failures = append(status.Failures, itemStatus)
+		}
+		if itemStatus.FinishedAt != nil && (finishedAt == nil || itemStatus.FinishedAt.After(*finishedAt)) {
+			finishedAt = itemStatus.FinishedAt
+		}
+	}
+
+	switch {
+	case active > 0:
+		status.Status = batchRunning
+		return status
+	case suspended > 0:
+		status.Status = batchSuspended
+		return status
+	case failed > 0:
+		status.Status = batchCompletedWithFailures
+	default:
+		status.Status = batchCompleted
+	}
+	if finishedAt == nil {
+		// Every item was rejected up front
+		finishedAt = &b.CreatedAt
+	}
+	status.FinishedAt = finishedAt
+	return status
+}
+
+// handleGetBatch reports the progress of a batch
+func (s *BPOService) handleGetBatch(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	b, ok := s.batches.find(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "batch_not_found", fmt.Sprintf("Batch %s is not known", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.batchStatus(b))
+}
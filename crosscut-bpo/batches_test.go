@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"crosscut-contracts/bpo"
+)
+
+// batchStatus fetches a batch through the API
+func (h *harness) batchStatus(id string) *bpo.BatchStatus {
+	h.t.Helper()
+	status, err := bpo.Decode[bpo.BatchStatus](h.client.GetBatch(context.Background(), id))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return status
+}
+
+func TestBatchRunsAtMostConcurrencyAtOnce(t *testing.T) {
+	h := newHarness(t)
+	held := h.hold("docgen", http.MethodPost, "/generate")
+
+	requests := make([]bpo.WorkflowRequest, 5)
+	for i := range requests {
+		requests[i] = bpo.WorkflowRequest{TriggerEvent: "schematic.released", Payload: routerRelease}
+	}
+	submitted, err := bpo.Decode[bpo.BatchStatus](h.client.ExecuteBatch(context.Background(), bpo.BatchRequest{Requests: requests, Concurrency: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if submitted.Concurrency != 2 || submitted.Total != 5 {
+		t.Fatalf("batch = %+v, want concurrency 2 of 5 items", submitted)
+	}
+
+	held.wait()
+	held.wait()
+	// Give a third workflow the chance to start if the limit did not hold
+	time.Sleep(50 * time.Millisecond)
+	status := h.batchStatus(submitted.BatchID)
+	if status.Counts[runRunning] != 2 || status.Counts[runQueued] != 3 {
+		t.Fatalf("counts = %v, want 2 running and 3 queued", status.Counts)
+	}
+	if generating := h.requests("docgen", http.MethodPost, "/generate"); generating != 2 {
+		t.Errorf("%d documents generating at once, want 2", generating)
+	}
+
+	held.release()
+	h.eventually("the batch to finish", func() bool {
+		return h.batchStatus(submitted.BatchID).Status == batchCompleted
+	})
+	status = h.batchStatus(submitted.BatchID)
+	if status.Counts[runCompleted] != 5 || status.FinishedAt == nil {
+		t.Errorf("batch = %+v, want 5 completed", status)
+	}
+}
+
+func TestBatchRejectsInvalidItemsAndConcurrency(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	var apiErr *bpo.Error
+	for _, concurrency := range []int{-1, h.service.current().config.Batch.MaxConcurrency + 1} {
+		_, err := bpo.Decode[bpo.BatchStatus](h.client.ExecuteBatch(ctx, bpo.BatchRequest{
+			Requests:    []bpo.WorkflowRequest{{TriggerEvent: "schematic.released", Payload: routerRelease}},
+			Concurrency: concurrency,
+		}))
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("concurrency %d: error = %v, want 400", concurrency, err)
+		}
+	}
+
+	submitted, err := bpo.Decode[bpo.BatchStatus](h.client.ExecuteBatch(ctx, bpo.BatchRequest{Requests: []bpo.WorkflowRequest{
+		{TriggerEvent: "schematic.released", Payload: routerRelease},
+		{TriggerEvent: "unknown.event", Payload: routerRelease},
+		{TriggerEvent: "schematic.released", Payload: map[string]interface{}{"revision": "C"}},
+	}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if submitted.Concurrency != h.service.current().config.Batch.Concurrency {
+		t.Errorf("concurrency = %d, want the configured default", submitted.Concurrency)
+	}
+	h.eventually("the batch to finish", func() bool {
+		return h.batchStatus(submitted.BatchID).FinishedAt != nil
+	})
+	status := h.batchStatus(submitted.BatchID)
+	if status.Status != batchCompletedWithFailures {
+		t.Errorf("status = %s, want %s", status.Status, batchCompletedWithFailures)
+	}
+	if status.Counts[runCompleted] != 1 || status.Counts[itemRejected] != 2 {
+		t.Errorf("counts = %v, want 1 completed and 2 rejected", status.Counts)
+	}
+	for _, failure := range status.Failures {
+		if failure.Status != itemRejected || failure.WorkflowID != "" || failure.Error == "" {
+			t.Errorf("failure %+v, want a rejected item with its reason", failure)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"crosscut-contracts"
+)
+
+// catalogueCheckTimeout bounds the DocGen call verifying the catalogue
+const catalogueCheckTimeout = 5 * time.Second
+
+// catalogueInput is what a TestTypeMapping draws prop values from
+type catalogueInput struct {
+	component   EnrichedComponent
+	product     string
+	revision    string
+	description string
+}
+
+// catalogueFields are the fields a prop mapping may reference
+var catalogueFields = map[string]func(catalogueInput) interface{}{
+	"component.name":      func(in catalogueInput) interface{} { return in.component.Name },
+	"component.voltage":   func(in catalogueInput) interface{} { return in.component.Voltage },
+	"component.test_type": func(in catalogueInput) interface{} { return in.component.TestType },
+	"product_name":        func(in catalogueInput) interface{} { return in.product },
+	"revision":            func(in catalogueInput) interface{} { return in.revision },
+	"description":         func(in catalogueInput) interface{} { return in.description },
+}
+
+// defaultTestProps is the TestBlock prop mapping used when a mapping does
+// not declare its own
+var defaultTestProps = map[string]string{
+	"test_name":    "component.name",
+	"voltage":      "component.voltage",
+	"product_name": "product_name",
+	"description":  "description",
+}
+
+// defaultTestCatalogue documents the test types PLM currently reports
+func defaultTestCatalogue() TestCatalogueConfig {
+	return TestCatalogueConfig{
+		TestTypes: map[string]TestTypeMapping{
+			"power_supply_validation": {
+				Component:   "TestBlock",
+				Description: "Validate power supply voltage requirements",
+			},
+			"thermal_validation": {
+				Component:   "TestBlock",
+				Description: "Validate thermal behaviour under sustained load",
+			},
+			"signal_integrity": {
+				Component:   "TestBlock",
+				Description: "Validate signal integrity at the rated voltage",
+			},
+			"emc_compliance": {
+				Component:   "TestBlock",
+				Description: "Verify radiated and conducted emissions against EMC limits",
+			},
+		},
+		Fallback: TestTypeMapping{
+			Component: "TestBlock",
+		},
+	}
+}
+
+// applyDefaults gives mappings without props the standard TestBlock props
+func (c *TestCatalogueConfig) applyDefaults() {
+	for testType, mapping := range c.TestTypes {
+		if len(mapping.Props) == 0 {
+			mapping.Props = defaultTestProps
+			c.TestTypes[testType] = mapping
+		}
+	}
+	if len(c.Fallback.Props) == 0 {
+		c.Fallback.Props = defaultTestProps
+	}
+}
+
+// validate checks every mapping, prefixing problems with field
+func (c TestCatalogueConfig) validate(field string) []string {
+	var problems []string
+	testTypes := make([]string, 0, len(c.TestTypes))
+	for testType := range c.TestTypes {
+		testTypes = append(testTypes, testType)
+	}
+	sort.Strings(testTypes)
+
+	for _, testType := range testTypes {
+		if testType == "" {
+			problems = append(problems, field+".test_types: test type must not be empty")
+			continue
+		}
+		problems = append(problems, c.TestTypes[testType].validate(field+".test_types."+testType)...)
+	}
+	return append(problems, c.Fallback.validate(field+".fallback")...)
+}
+
+// validate checks one mapping, prefixing problems with field
+func (m TestTypeMapping) validate(field string) []string {
+	var problems []string
+	if m.Component == "" {
+		problems = append(problems, field+".component: must not be empty")
+	}
+	props := make([]string, 0, len(m.Props))
+	for prop := range m.Props {
+		props = append(props, prop)
+	}
+	sort.Strings(props)
+	for _, prop := range props {
+		if _, ok := catalogueFields[m.Props[prop]]; !ok {
+			problems = append(problems, fmt.Sprintf("%s.props.%s: %q is not one of %s", field, prop, m.Props[prop], strings.Join(catalogueFieldNames(), ", ")))
+		}
+	}
+	return problems
+}
+
+// catalogueFieldNames lists the fields a prop mapping may reference
+func catalogueFieldNames() []string {
+	names := make([]string, 0, len(catalogueFields))
+	for name := range catalogueFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mapping returns how a test type is documented, falling back for test
+// types the catalogue does not list
+func (c TestCatalogueConfig) mapping(testType string) TestTypeMapping {
+	if mapping, ok := c.TestTypes[testType]; ok {
+		return mapping
+	}
+	mapping := c.Fallback
+	if mapping.Description == "" {
+		mapping.Description = fmt.Sprintf("Validate %s", strings.ReplaceAll(testType, "_", " "))
+	}
+	return mapping
+}
+
+// instance renders the DocGen component documenting an enriched component
+func (c TestCatalogueConfig) instance(comp EnrichedComponent, product, revision string) ComponentInstance {
+	mapping := c.mapping(comp.TestType)
+	in := catalogueInput{
+		component:   comp,
+		product:     product,
+		revision:    revision,
+		description: mapping.Description,
+	}
+	props := make(map[string]interface{}, len(mapping.Props))
+	for prop, field := range mapping.Props {
+		props[prop] = catalogueFields[field](in)
+	}
+	return ComponentInstance{
+		Component: mapping.Component,
+		Props:     props,
+	}
+}
+
+// components lists the DocGen components the catalogue renders
+func (c TestCatalogueConfig) components() []string {
+	seen := map[string]bool{c.Fallback.Component: true}
+	for _, mapping := range c.TestTypes {
+		seen[mapping.Component] = true
+	}
+	components := make([]string, 0, len(seen))
+	for component := range seen {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	return components
+}
+
+// listDocGenComponents asks DocGen which components it can render
+func listDocGenComponents(ctx context.Context, docgen *sorClient) ([]string, error) {
+	resp, err := docgen.get(ctx, "/components")
+	if err != nil {
+		return nil, fmt.Errorf("failed to call DocGen service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("DocGen service returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var listing contracts.ComponentsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return nil, fmt.Errorf("failed to decode DocGen response: %w", err)
+	}
+	return listing.Components, nil
+}
+
+// verifyCatalogue checks that DocGen can render every component the test
+// catalogue of state uses. An unreachable DocGen cannot be checked and is
+// only logged, so the BPO can start before its dependencies.
+func verifyCatalogue(state *runtimeState) error {
+	docgen, ok := state.sors["docgen"]
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), catalogueCheckTimeout)
+	defer cancel()
+
+	available, err := listDocGenComponents(ctx, docgen)
+	if err != nil {
+		log.Printf("Test catalogue not verified, DocGen unavailable: %v", err)
+		return nil
+	}
+	known := make(map[string]bool, len(available))
+	for _, component := range available {
+		known[component] = true
+	}
+
+	var problems []string
+	for testType, mapping := range state.config.TestCatalogue.TestTypes {
+		if !known[mapping.Component] {
+			problems = append(problems, fmt.Sprintf("test_catalogue.test_types.%s.component: DocGen has no component %q", testType, mapping.Component))
+		}
+	}
+	if fallback := state.config.TestCatalogue.Fallback.Component; !known[fallback] {
+		problems = append(problems, fmt.Sprintf("test_catalogue.fallback.component: DocGen has no component %q", fallback))
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return &ConfigError{Subject: "test catalogue", Problems: problems}
+	}
+
+	log.Printf("Test catalogue verified against DocGen: %s", strings.Join(state.config.TestCatalogue.components(), ", "))
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// withCatalogue returns a copy of the current state using catalogue
+func (h *harness) withCatalogue(catalogue TestCatalogueConfig) *runtimeState {
+	state := *h.service.current()
+	cfg := *state.config
+	catalogue.applyDefaults()
+	cfg.TestCatalogue = catalogue
+	state.config = &cfg
+	return &state
+}
+
+func TestCatalogueMapsTestTypes(t *testing.T) {
+	catalogue := defaultTestCatalogue()
+	catalogue.TestTypes["signal_integrity"] = TestTypeMapping{
+		Component:   "TestBlock",
+		Description: "Eye diagram at the rated voltage",
+		Props: map[string]string{
+			"test_name": "component.name",
+			"level":     "component.voltage",
+			"revision":  "revision",
+		},
+	}
+	catalogue.applyDefaults()
+
+	mapped := catalogue.instance(EnrichedComponent{Name: "EthernetPortTest", Voltage: "3.3V", TestType: "signal_integrity"}, "ROUTER-100", "C")
+	want := map[string]interface{}{"test_name": "EthernetPortTest", "level": "3.3V", "revision": "C"}
+	if mapped.Component != "TestBlock" || !reflect.DeepEqual(mapped.Props, want) {
+		t.Errorf("signal_integrity = %+v, want TestBlock with %v", mapped, want)
+	}
+
+	// Test types the catalogue does not list use the fallback, described
+	// after the test type
+	fallback := catalogue.instance(EnrichedComponent{Name: "DropTest", Voltage: "5V", TestType: "drop_impact"}, "ROUTER-100", "C")
+	want = map[string]interface{}{"test_name": "DropTest", "voltage": "5V", "product_name": "ROUTER-100", "description": "Validate drop impact"}
+	if fallback.Component != "TestBlock" || !reflect.DeepEqual(fallback.Props, want) {
+		t.Errorf("fallback = %+v, want TestBlock with %v", fallback, want)
+	}
+}
+
+func TestCatalogueValidation(t *testing.T) {
+	catalogue := TestCatalogueConfig{
+		TestTypes: map[string]TestTypeMapping{
+			"thermal_validation": {Props: map[string]string{"test_name": "component.label"}},
+		},
+		Fallback: TestTypeMapping{Component: "TestBlock"},
+	}
+	assertProblems(t, &ConfigError{Problems: catalogue.validate("test_catalogue")},
+		"test_catalogue.test_types.thermal_validation.component: must not be empty",
+		`test_catalogue.test_types.thermal_validation.props.test_name: "component.label" is not one of `+strings.Join(catalogueFieldNames(), ", "),
+	)
+}
+
+func TestCatalogueVerifiedAgainstDocGen(t *testing.T) {
+	h := newHarness(t)
+
+	err := verifyCatalogue(h.withCatalogue(TestCatalogueConfig{
+		TestTypes: map[string]TestTypeMapping{
+			"power_supply_validation": {Component: "TestBlock"},
+			"signal_integrity":        {Component: "SignalBlock"},
+		},
+		Fallback: TestTypeMapping{Component: "GenericBlock"},
+	}))
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Subject != "test catalogue" {
+		t.Fatalf("error = %v, want a test catalogue ConfigError", err)
+	}
+	assertProblems(t, err,
+		`test_catalogue.fallback.component: DocGen has no component "GenericBlock"`,
+		`test_catalogue.test_types.signal_integrity.component: DocGen has no component "SignalBlock"`,
+	)
+
+	// Any component DocGen lists is accepted
+	if err := verifyCatalogue(h.withCatalogue(TestCatalogueConfig{
+		TestTypes: map[string]TestTypeMapping{"signal_integrity": {Component: "AuthorBlock"}},
+		Fallback:  TestTypeMapping{Component: "TestBlock"},
+	})); err != nil {
+		t.Errorf("catalogue of listed components: %v", err)
+	}
+}
+
+func TestCatalogueNotVerifiedWhileDocGenIsDown(t *testing.T) {
+	h := newHarness(t)
+	h.failRequests("docgen", http.MethodGet, "/components", http.StatusServiceUnavailable, 0)
+
+	err := verifyCatalogue(h.withCatalogue(TestCatalogueConfig{
+		Fallback: TestTypeMapping{Component: "GenericBlock"},
+	}))
+	if err != nil {
+		t.Errorf("error = %v, want the check skipped", err)
+	}
+}
+
+func TestReloadRejectsUnknownCatalogueComponent(t *testing.T) {
+	h, definitionsDir, configPath := reloadHarness(t)
+	before := h.service.current()
+
+	writeFile(t, configPath, "workflows:\n  definitions_dir: "+definitionsDir+"\ntest_catalogue:\n  test_types:\n    signal_integrity:\n      component: SignalBlock\n")
+	err := h.service.reload("test")
+
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || !strings.Contains(err.Error(), `DocGen has no component "SignalBlock"`) {
+		t.Fatalf("error = %v, want the unknown component rejected", err)
+	}
+	if h.service.current() != before {
+		t.Error("a rejected reload replaced the configuration")
+	}
+}
+
+func TestCatalogueShapesDocumentPlan(t *testing.T) {
+	h := newHarness(t, func(cfg *Config) {
+		mapping := cfg.TestCatalogue.TestTypes["signal_integrity"]
+		mapping.Description = "Eye diagram at the rated voltage"
+		cfg.TestCatalogue.TestTypes["signal_integrity"] = mapping
+	})
+
+	response := h.dryRun("schematic.released", routerRelease)
+
+	if response.Status != "success" {
+		t.Fatalf("response = %+v", response)
+	}
+	plan, err := json.Marshal(response.DocumentPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(plan), "Eye diagram at the rated voltage") {
+		t.Errorf("document plan = %s, want the catalogue's description", plan)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"crosscut-contracts"
+)
+
+// compensation is a completed step whose effects can be undone
+type compensation struct {
+	// run is the run, or parallel branch copy, the step ran on
+	run  *workflowRun
+	step StepDefinition
+}
+
+// compensationStep returns the step that undoes s, defaulting its ID
+func (s StepDefinition) compensationStep() StepDefinition {
+	comp := *s.Compensate
+	if comp.ID == "" {
+		comp.ID = s.ID + "_compensation"
+	}
+	return comp
+}
+
+// validateCompensation checks the compensate block of a step
+func validateCompensation(step StepDefinition) []string {
+	comp := step.compensationStep()
+	var problems []string
+	switch comp.Type {
+	case "wait_for_approval", "parallel":
+		problems = append(problems, fmt.Sprintf("type: %s steps cannot compensate", comp.Type))
+	case "":
+		problems = append(problems, "type: must not be empty")
+	default:
+		if _, ok := stepTypes[comp.Type]; !ok {
+			problems = append(problems, fmt.Sprintf("type: unknown step type %q", comp.Type))
+		} else if validate, ok := stepValidators[comp.Type]; ok {
+			if err := validate(comp); err != nil {
+				problems = append(problems, fmt.Sprintf("with: %v", err))
+			}
+		}
+	}
+	switch step.Type {
+	case "wait_for_approval", "parallel":
+		problems = append(problems, fmt.Sprintf("%s steps cannot declare a compensation; declare it on the steps inside", step.Type))
+	}
+	if comp.Compensate != nil {
+		problems = append(problems, "compensate: compensations cannot be compensated")
+	}
+	if comp.When != "" {
+		problems = append(problems, "when: compensations always run")
+	}
+	return problems
+}
+
+// compensate undoes the completed steps of a failed run in reverse order.
+// Every compensation is attempted and audited even if an earlier one fails.
+// It returns the failure annotated with the outcome.
+func (s *BPOService) compensate(ctx context.Context, run *workflowRun, failure error) error {
+	if len(run.compensations) == 0 {
+		return failure
+	}
+	log.Printf("Workflow %s failed, running %d compensation(s)", run.ID, len(run.compensations))
+
+	var compensated []string
+	var problems []string
+	for i := len(run.compensations) - 1; i >= 0; i-- {
+		completed := run.compensations[i]
+		comp := completed.step.compensationStep()
+
+		details, err := stepTypes[comp.Type](s, ctx, completed.run, comp)
+		if details == nil {
+			details = map[string]interface{}{}
+		}
+		details["compensates"] = completed.step.ID
+		if err != nil {
+			s.auditRun(completed.run, comp.ID, "failed", details, err)
+			problems = append(problems, fmt.Sprintf("%s: %v", comp.ID, err))
+			continue
+		}
+		s.auditRun(completed.run, comp.ID, "success", details, nil)
+		compensated = append(compensated, completed.step.ID)
+	}
+
+	if len(problems) > 0 {
+		err := fmt.Errorf("%w; compensation failed: %s", failure, strings.Join(problems, "; "))
+		s.auditRun(run, "workflow_compensation_failed", "failed", map[string]interface{}{
+			"compensated": compensated,
+		}, err)
+		s.setRunStatus(run, runFailed, err)
+		return err
+	}
+
+	err := fmt.Errorf("%w (compensated)", failure)
+	s.auditRun(run, "workflow_compensated", runCompensated, map[string]interface{}{
+		"compensated": compensated,
+	}, failure)
+	s.setRunStatus(run, runCompensated, failure)
+	return err
+}
+
+// deleteDocument asks DocGen to delete a generated document. A document
+// that is already gone counts as deleted.
+func deleteDocument(ctx context.Context, docgen *sorClient, filename string) (bool, error) {
+	resp, err := docgen.delete(ctx, "/documents/"+url.PathEscape(filename))
+	if err != nil {
+		return false, fmt.Errorf("failed to call DocGen service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("DocGen service returned %d: %s", resp.StatusCode, string(body))
+	}
+}
+
+// ReleaseStatusUpdate is sent to PLM to record a product's release status
+type ReleaseStatusUpdate = contracts.ReleaseStatusUpdate
+
+// notifyPLMStatus records a product's release status in PLM
+func notifyPLMStatus(ctx context.Context, plm *sorClient, product string, update ReleaseStatusUpdate) error {
+	jsonData, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to marshal release status: %w", err)
+	}
+
+	resp, err := plm.postJSON(ctx, "/products/"+url.PathEscape(product)+"/release-status", jsonData)
+	if err != nil {
+		return fmt.Errorf("failed to call PLM service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("PLM service returned %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// stepDeleteDocument deletes the document generated earlier in the run
+func (s *BPOService) stepDeleteDocument(ctx context.Context, run *workflowRun, step StepDefinition) (map[string]interface{}, error) {
+	response, err := output[*DocGenResponse](run, outputDocGenResponse)
+	if err != nil {
+		return nil, err
+	}
+	docgen, err := run.sor("docgen")
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := deleteDocument(ctx, docgen, response.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if run.documentURL == response.URL {
+		run.documentURL = ""
+	}
+
+	return map[string]interface{}{
+		"filename":        response.Filename,
+		"document_url":    response.URL,
+		"already_deleted": !deleted,
+	}, nil
+}
+
+// notifyConfig is the `with` block of a notify_plm step
+type notifyConfig struct {
+	Status string `yaml:"status"`
+	Reason string `yaml:"reason"`
+}
+
+// parseNotifyConfig decodes and checks a notify_plm step
+func parseNotifyConfig(step StepDefinition) (notifyConfig, error) {
+	var cfg notifyConfig
+	if err := decodeWith(step, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Status == "" {
+		return cfg, errors.New("status: must not be empty")
+	}
+	return cfg, nil
+}
+
+// validateNotifyStep checks a notify_plm step
+func validateNotifyStep(step StepDefinition) error {
+	_, err := parseNotifyConfig(step)
+	return err
+}
+
+// stepNotifyPLM records the product revision's release status in PLM, e.g.
+// reverting it when a release workflow is compensated
+func (s *BPOService) stepNotifyPLM(ctx context.Context, run *workflowRun, step StepDefinition) (map[string]interface{}, error) {
+	cfg, err := parseNotifyConfig(step)
+	if err != nil {
+		return nil, err
+	}
+	plm, err := run.sor("plm")
+	if err != nil {
+		return nil, err
+	}
+
+	update := ReleaseStatusUpdate{
+		Revision:   run.revision(),
+		Status:     cfg.Status,
+		Reason:     cfg.Reason,
+		WorkflowID: run.ID,
+	}
+	if err := notifyPLMStatus(ctx, plm, run.Inputs["product_name"], update); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"product":  run.Inputs["product_name"],
+		"revision": update.Revision,
+		"status":   update.Status,
+	}, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"crosscut-contracts/bpo"
+)
+
+// compensatedSteps builds a release that records a status in PLM,
+// generates the document and records a second status, each undone by a
+// compensation, before the steps given in last
+func compensatedSteps(last string) string {
+	return fmt.Sprintf(`
+name: staged-release
+version: 1
+trigger: release.staged
+inputs:
+  product_name:
+    required: true
+  revision: {}
+steps:
+  - id: template_plan_generated
+    type: generate_template_plan
+  - id: plm_consultation
+    type: consult_plm
+  - id: document_plan_built
+    type: build_document_plan
+  - id: release_started
+    type: notify_plm
+    with: {status: in_progress}
+    compensate:
+      type: notify_plm
+      with: {status: abandoned, reason: release did not complete}
+  - id: docgen_command
+    type: command_docgen
+    compensate:
+      type: delete_document
+  - id: release_documented
+    type: notify_plm
+    with: {status: documented}
+    compensate:
+      id: documented_reverted
+      type: notify_plm
+      with: {status: reverted, reason: release did not complete}
+%s`, last)
+}
+
+const (
+	// finalValidation fails when DocGen refuses to validate
+	finalValidation = `
+  - id: document_plan_validated
+    type: validate_document_plan
+`
+	// finalApproval waits for qa-lead, for at most timeout
+	finalApproval = `
+  - id: release_approved
+    type: wait_for_approval
+    with: {approvers: [qa-lead], timeout: %s}
+`
+)
+
+// stagedCompensations lists the compensations of a staged release in the
+// order they must run, after the audit entries named in before
+func stagedCompensations(before ...string) []string {
+	return append(before,
+		"documented_reverted success",
+		"docgen_command_compensation success",
+		"release_started_compensation success",
+	)
+}
+
+// stagedSteps lists the audit entries of the staged release's own steps
+var stagedSteps = []string{
+	"workflow_started success",
+	"template_plan_generated success",
+	"plm_consultation success",
+	"document_plan_built success",
+	"release_started success",
+	"docgen_command success",
+	"release_documented success",
+}
+
+// releaseStatus returns the release status PLM holds for a product
+func (h *harness) releaseStatus(product string) string {
+	h.t.Helper()
+	recorder := serve(h.plm, http.MethodGet, "/products/"+product+"/release-status", "")
+	if recorder.Code != http.StatusOK {
+		h.t.Fatalf("release status of %s: %d %s", product, recorder.Code, recorder.Body)
+	}
+	return recorder.Body.String()
+}
+
+func TestCompensationRunsInReverseOrder(t *testing.T) {
+	h := newDefinitionsHarness(t, compensatedSteps(finalValidation))
+	h.failRequests("docgen", http.MethodPost, "/validate-plan", http.StatusInternalServerError, 0)
+
+	_, err := h.trigger("release.staged", routerRelease)
+
+	id := failedWorkflowID(t, err)
+	want := append(append([]string(nil), stagedSteps...), "document_plan_validated failed")
+	h.assertAuditTrail(id, append(stagedCompensations(want...), "workflow_compensated compensated")...)
+	if status := h.status(id); status.Status != runCompensated {
+		t.Errorf("status = %s, want %s", status.Status, runCompensated)
+	}
+	// The first status recorded is undone last
+	if status := h.releaseStatus("ROUTER-100"); !strings.Contains(status, `"status":"abandoned"`) {
+		t.Errorf("release status = %s, want abandoned", status)
+	}
+	if compensates := h.auditEntry(id, "documented_reverted").Details["compensates"]; compensates != "release_documented" {
+		t.Errorf("documented_reverted compensates %v, want release_documented", compensates)
+	}
+}
+
+func TestFailedCompensationDoesNotStopOthers(t *testing.T) {
+	h := newDefinitionsHarness(t, compensatedSteps(finalValidation))
+	h.failRequests("docgen", http.MethodPost, "/validate-plan", http.StatusInternalServerError, 0)
+	h.failRequests("docgen", http.MethodDelete, "/documents/ROUTER-100-DVT-Procedure-Rev-C.docx", http.StatusInternalServerError, 0)
+
+	_, err := h.trigger("release.staged", routerRelease)
+
+	id := failedWorkflowID(t, err)
+	h.assertAuditTrail(id, append(append([]string(nil), stagedSteps...),
+		"document_plan_validated failed",
+		"documented_reverted success",
+		"docgen_command_compensation failed",
+		"release_started_compensation success",
+		"workflow_compensation_failed failed",
+	)...)
+	status := h.status(id)
+	if status.Status != runFailed || !strings.Contains(status.Error, "compensation failed: docgen_command_compensation") {
+		t.Errorf("status = %s (%s), want failed naming the compensation", status.Status, status.Error)
+	}
+}
+
+func TestRejectedApprovalIsCompensated(t *testing.T) {
+	h := newDefinitionsHarness(t, compensatedSteps(fmt.Sprintf(finalApproval, "1m")))
+	id := h.awaitStaged()
+
+	response, err := bpo.Decode[bpo.WorkflowResponse](h.client.DecideApproval(context.Background(), id, bpo.ApprovalRequest{Decision: decisionReject, Approver: "qa-lead"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Status != runRejected || !strings.HasSuffix(response.Message, "(compensated)") {
+		t.Errorf("response = %+v, want rejected and compensated", response)
+	}
+	want := append(append([]string(nil), stagedSteps...),
+		"approval_requested waiting",
+		"approval_rejected rejected",
+		"workflow_rejected rejected",
+	)
+	h.assertAuditTrail(id, append(stagedCompensations(want...), "workflow_compensated compensated")...)
+	if status := h.status(id); status.Status != runCompensated {
+		t.Errorf("status = %s, want %s", status.Status, runCompensated)
+	}
+	if n := h.requests("docgen", http.MethodDelete, "/documents/ROUTER-100-DVT-Procedure-Rev-C.docx"); n != 1 {
+		t.Errorf("DocGen received %d delete requests, want 1", n)
+	}
+}
+
+func TestExpiredApprovalIsCompensated(t *testing.T) {
+	h := newDefinitionsHarness(t, compensatedSteps(fmt.Sprintf(finalApproval, "50ms")))
+	id := h.awaitStaged()
+
+	h.eventually("the expired approval to be compensated", func() bool {
+		return h.status(id).Status == runCompensated
+	})
+
+	want := append(append([]string(nil), stagedSteps...),
+		"approval_requested waiting",
+		"approval_timed_out rejected",
+		"workflow_rejected rejected",
+	)
+	h.assertAuditTrail(id, append(stagedCompensations(want...), "workflow_compensated compensated")...)
+}
+
+// awaitStaged triggers the staged release and checks it waits for approval
+func (h *harness) awaitStaged() string {
+	h.t.Helper()
+	response, err := h.trigger("release.staged", routerRelease)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	if response.Status != runAwaitingApproval {
+		h.t.Fatalf("response = %+v, want %s", response, runAwaitingApproval)
+	}
+	return response.WorkflowID
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Step conditions are CEL expressions evaluated against the run:
+//
+//	payload  the trigger payload
+//	inputs   the resolved definition inputs
+//	outputs  outputs recorded by earlier steps, as their JSON form, e.g.
+//	         outputs.enriched_plan.components
+//
+// volts("48V") converts a PLM voltage string to a number and fails on one
+// it cannot parse; has_volts("48V") reports whether it can, to guard it.
+var (
+	conditionEnvOnce sync.Once
+	conditionEnv     *cel.Env
+	conditionEnvErr  error
+
+	// conditionPrograms caches compiled conditions by expression
+	conditionPrograms sync.Map
+)
+
+// parseVolts converts a voltage such as "24V", "3.3 V" or "12" to volts
+func parseVolts(value string) (float64, error) {
+	trimmed := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "V"))
+	volts, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid voltage %q", value)
+	}
+	return volts, nil
+}
+
+// newConditionEnv declares the variables and functions conditions may use
+func newConditionEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("payload", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("inputs", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("outputs", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Function("volts",
+			cel.Overload("volts_string", []*cel.Type{cel.StringType}, cel.DoubleType,
+				cel.UnaryBinding(func(value ref.Val) ref.Val {
+					raw, ok := value.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(value)
+					}
+					volts, err := parseVolts(string(raw))
+					if err != nil {
+						return types.NewErr("volts: %v", err)
+					}
+					return types.Double(volts)
+				}),
+			),
+		),
+		cel.Function("has_volts",
+			cel.Overload("has_volts_string", []*cel.Type{cel.StringType}, cel.BoolType,
+				cel.UnaryBinding(func(value ref.Val) ref.Val {
+					raw, ok := value.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(value)
+					}
+					_, err := parseVolts(string(raw))
+					return types.Bool(err == nil)
+				}),
+			),
+		),
+	)
+}
+
+// compileCondition type-checks a condition, which must produce a bool
+func compileCondition(expr string) (cel.Program, error) {
+	if cached, ok := conditionPrograms.Load(expr); ok {
+		return cached.(cel.Program), nil
+	}
+
+	conditionEnvOnce.Do(func() {
+		conditionEnv, conditionEnvErr = newConditionEnv()
+	})
+	if conditionEnvErr != nil {
+		return nil, conditionEnvErr
+	}
+
+	ast, issues := conditionEnv.Compile(expr)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if out := ast.OutputType(); !out.IsExactType(cel.BoolType) && !out.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("condition must evaluate to a bool, not %s", out)
+	}
+	program, err := conditionEnv.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	conditionPrograms.Store(expr, program)
+	return program, nil
+}
+
+// conditionVars builds the variables a condition is evaluated against
+func (r *workflowRun) conditionVars() (map[string]interface{}, error) {
+	// Outputs are typed Go values; conditions see their JSON field names
+	data, err := json.Marshal(r.outputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode step outputs: %w", err)
+	}
+	var outputs map[string]interface{}
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return nil, fmt.Errorf("failed to decode step outputs: %w", err)
+	}
+
+	payload := r.Payload
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"payload": payload,
+		"inputs":  r.Inputs,
+		"outputs": outputs,
+	}, nil
+}
+
+// evaluateCondition evaluates a step's condition against the run
+func evaluateCondition(expr string, run *workflowRun) (bool, error) {
+	program, err := compileCondition(expr)
+	if err != nil {
+		return false, err
+	}
+	vars, err := run.conditionVars()
+	if err != nil {
+		return false, err
+	}
+
+	out, _, err := program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("condition evaluated to %v, not a bool", out.Value())
+	}
+	return result, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHighVoltageProductGetsSafetyBlock(t *testing.T) {
+	h := newHarness(t)
+	h.createProduct(plmProduct{
+		Name:     "INVERTER-400",
+		Voltage:  "400V",
+		Revision: "A",
+		Components: []ProductComponent{
+			{Name: "PowerTest", Voltage: "400V", TestType: "power_supply_validation"},
+			{Name: "ThermalTest", Voltage: "24V", TestType: "thermal_validation"},
+		},
+	})
+
+	response := h.release("INVERTER-400", "A")
+
+	h.assertAuditTrail(response.WorkflowID,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"high_voltage_safety success",
+		"document_plan_validated success",
+		"docgen_command success",
+		"workflow_completed success",
+	)
+	entry := h.auditEntry(response.WorkflowID, "high_voltage_safety")
+	if entry.Details["test_name"] != "HighVoltageSafety" || entry.Details["voltage"] != "400V" {
+		t.Errorf("high_voltage_safety details = %v, want HighVoltageSafety at 400V", entry.Details)
+	}
+}
+
+func TestUnparseableVoltageSkipsSafetyBlock(t *testing.T) {
+	registry, err := loadDefinitions("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err := registry.latest("schematic.released", func(definitionKey) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var when string
+	for _, step := range def.Steps {
+		if step.ID == "high_voltage_safety" {
+			when = step.When
+		}
+	}
+
+	// PLM is the system of record for voltages and may hold ones such as
+	// "mains" that volts cannot parse
+	tests := []struct {
+		voltages []string
+		want     bool
+	}{
+		{[]string{"mains", "24V"}, false},
+		{[]string{"mains", "400V"}, true},
+	}
+	for _, tt := range tests {
+		var components []EnrichedComponent
+		for _, voltage := range tt.voltages {
+			components = append(components, EnrichedComponent{Voltage: voltage})
+		}
+		run := &workflowRun{outputs: map[string]interface{}{
+			outputEnrichedPlan: &EnrichedPlan{Components: components},
+		}}
+		got, err := evaluateCondition(when, run)
+		if err != nil || got != tt.want {
+			t.Errorf("high_voltage_safety with voltages %q = %v, %v; want %v", tt.voltages, got, err, tt.want)
+		}
+	}
+}
+
+func TestFalseConditionSkipsStep(t *testing.T) {
+	h := newHarness(t)
+	// A component PLM gives no test type is enriched as "unknown"
+	h.createProduct(plmProduct{
+		Name:     "PROTO-1",
+		Voltage:  "5V",
+		Revision: "A",
+		Components: []ProductComponent{
+			{Name: "PowerTest", Voltage: "5V", TestType: "power_supply_validation"},
+			{Name: "MysteryTest", Voltage: "5V"},
+		},
+	})
+
+	response := h.release("PROTO-1", "A")
+
+	h.assertAuditTrail(response.WorkflowID,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"high_voltage_safety skipped",
+		"document_plan_validated skipped",
+		"docgen_command skipped",
+		"workflow_completed success",
+	)
+	entry := h.auditEntry(response.WorkflowID, "docgen_command")
+	if condition, _ := entry.Details["condition"].(string); !strings.Contains(condition, `c.test_type != "unknown"`) {
+		t.Errorf("docgen_command skipped with details %v, want the false condition", entry.Details)
+	}
+	if response.DocumentURL != "" {
+		t.Errorf("document_url = %s, want none", response.DocumentURL)
+	}
+	if n := h.requests("docgen", http.MethodPost, "/generate"); n != 0 {
+		t.Errorf("DocGen received %d generate requests, want none", n)
+	}
+}
+
+func TestConditionsSeePayloadAndInputs(t *testing.T) {
+	h := newDefinitionsHarness(t, `
+name: conditional-release
+version: 1
+trigger: release.conditional
+inputs:
+  product_name:
+    required: true
+  revision: {}
+steps:
+  - id: template_plan_generated
+    type: generate_template_plan
+  - id: urgent_notice
+    type: notify_plm
+    when: has(payload.urgent) && payload.urgent == true && inputs.product_name.startsWith("ROUTER")
+    with: {status: urgent}
+`)
+
+	routine, err := h.trigger("release.conditional", routerRelease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := h.auditEntry(routine.WorkflowID, "urgent_notice"); entry.Status != "skipped" {
+		t.Errorf("urgent_notice without urgent = %s, want skipped", entry.Status)
+	}
+
+	response, err := h.trigger("release.conditional", map[string]interface{}{
+		"product_name": "ROUTER-100",
+		"revision":     "C",
+		"urgent":       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := h.auditEntry(response.WorkflowID, "urgent_notice"); entry.Status != "success" {
+		t.Errorf("urgent_notice with urgent = %s, want success", entry.Status)
+	}
+}
+
+func TestInvalidConditionsAreRejected(t *testing.T) {
+	tests := []struct {
+		when string
+		want string
+	}{
+		{"outputs.enriched_plan.", "Syntax error"},
+		{"1 + 1", "must evaluate to a bool"},
+		{"volts(42)", "found no matching overload"},
+	}
+	for _, tt := range tests {
+		problems := validateSteps("steps", []StepDefinition{{ID: "first", Type: "consult_plm", When: tt.when}})
+		if len(problems) != 1 || !strings.HasPrefix(problems[0], "steps[0].when: ") || !strings.Contains(problems[0], tt.want) {
+			t.Errorf("when %q: problems = %q, want one mentioning %q", tt.when, problems, tt.want)
+		}
+	}
+}
+
+func TestVoltsParsesVoltages(t *testing.T) {
+	run := &workflowRun{outputs: map[string]interface{}{
+		outputEnrichedPlan: &EnrichedPlan{Components: []EnrichedComponent{{Voltage: "3.3V"}, {Voltage: " 48 V"}}},
+	}}
+	tests := []struct {
+		when string
+		want bool
+	}{
+		{`outputs.enriched_plan.components.exists(c, volts(c.voltage) > 48.0)`, false},
+		{`outputs.enriched_plan.components.exists(c, volts(c.voltage) >= 48.0)`, true},
+		{`volts("3.3V") < 5.0`, true},
+		{`has_volts("3.3V")`, true},
+		{`has_volts("mains")`, false},
+		{`has_volts("mains") && volts("mains") > 48.0`, false},
+	}
+	for _, tt := range tests {
+		got, err := evaluateCondition(tt.when, run)
+		if err != nil || got != tt.want {
+			t.Errorf("%s = %v, %v; want %v", tt.when, got, err, tt.want)
+		}
+	}
+
+	if _, err := evaluateCondition(`volts("mains") > 0.0`, run); err == nil || !strings.Contains(err.Error(), `invalid voltage "mains"`) {
+		t.Errorf("volts of an invalid voltage: error = %v", err)
+	}
+}
@@ -0,0 +1,592 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedSecret replaces secret values when the config is printed
+const redactedSecret = "<redacted>"
+
+// defaultSoRTimeout applies to SoRs configured without an explicit timeout
+const defaultSoRTimeout = Duration(30 * time.Second)
+
+// Duration is a time.Duration that reads and writes as a Go duration string
+type Duration time.Duration
+
+// UnmarshalYAML parses values such as "30s" or "2m"
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var raw string
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", value.Line, raw)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML writes the duration in its string form
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// Config is the complete crosscut-bpo configuration
+type Config struct {
+	Server    ServerConfig         `yaml:"server"`
+	Audit     AuditConfig          `yaml:"audit"`
+	SoRs      map[string]SoRConfig `yaml:"sors"`
+	Retry     RetryConfig          `yaml:"retry"`
+	Timeouts  TimeoutConfig        `yaml:"timeouts"`
+	Auth      AuthConfig           `yaml:"auth"`
+	Workflows WorkflowsConfig      `yaml:"workflows"`
+	Documents DocumentsConfig      `yaml:"documents"`
+	Scheduler SchedulerConfig      `yaml:"scheduler"`
+	Batch     BatchConfig          `yaml:"batch"`
+	// TestCatalogue decides how each PLM test type is documented
+	TestCatalogue TestCatalogueConfig `yaml:"test_catalogue"`
+}
+
+// ServerConfig controls the HTTP listener
+type ServerConfig struct {
+	ListenAddr string    `yaml:"listen_addr"`
+	TLS        TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig enables HTTPS on the listener
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// AuditConfig selects where audit entries are written
+type AuditConfig struct {
+	Backend string `yaml:"backend"`
+	Path    string `yaml:"path"`
+}
+
+// SoRConfig describes how to reach a System of Record
+type SoRConfig struct {
+	URL     string       `yaml:"url"`
+	Timeout Duration     `yaml:"timeout"`
+	Retry   *RetryConfig `yaml:"retry,omitempty"`
+}
+
+// RetryConfig controls retries of failed SoR calls
+type RetryConfig struct {
+	MaxAttempts    int      `yaml:"max_attempts"`
+	InitialBackoff Duration `yaml:"initial_backoff"`
+	MaxBackoff     Duration `yaml:"max_backoff"`
+}
+
+// TimeoutConfig holds server-side timeouts
+type TimeoutConfig struct {
+	ReadHeader Duration `yaml:"read_header"`
+	Read       Duration `yaml:"read"`
+	Write      Duration `yaml:"write"`
+	Idle       Duration `yaml:"idle"`
+	Shutdown   Duration `yaml:"shutdown"`
+}
+
+// AuthConfig controls authentication of API callers
+type AuthConfig struct {
+	Mode   string          `yaml:"mode"`
+	Tokens []TokenIdentity `yaml:"tokens,omitempty"`
+}
+
+// TokenIdentity maps a bearer token to the caller it identifies
+type TokenIdentity struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+}
+
+// WorkflowsConfig locates workflow definitions
+type WorkflowsConfig struct {
+	DefinitionsDir string `yaml:"definitions_dir"`
+}
+
+// DocumentsConfig locates document plan templates
+type DocumentsConfig struct {
+	TemplatesDir string `yaml:"templates_dir"`
+}
+
+// TestCatalogueConfig maps PLM test types to the DocGen components that
+// document them
+type TestCatalogueConfig struct {
+	TestTypes map[string]TestTypeMapping `yaml:"test_types"`
+	// Fallback documents test types missing from TestTypes
+	Fallback TestTypeMapping `yaml:"fallback"`
+}
+
+// TestTypeMapping documents one PLM test type
+type TestTypeMapping struct {
+	// Component is the DocGen component rendered for the test
+	Component string `yaml:"component"`
+	// Description explains what the test verifies; the fallback derives
+	// one from the test type when it is empty
+	Description string `yaml:"description,omitempty"`
+	// Props maps each DocGen prop to the field supplying its value, e.g.
+	// voltage: component.voltage
+	Props map[string]string `yaml:"props,omitempty"`
+}
+
+// BatchConfig bounds batch triggers
+type BatchConfig struct {
+	// MaxItems is the largest batch accepted
+	MaxItems int `yaml:"max_items"`
+	// Concurrency is how many workflows of a batch run at once when the
+	// request does not say; MaxConcurrency caps what a request may ask for
+	Concurrency    int `yaml:"concurrency"`
+	MaxConcurrency int `yaml:"max_concurrency"`
+}
+
+// SchedulerConfig declares time-based triggers
+type SchedulerConfig struct {
+	// LeasePath is a lock file shared by every replica; only the replica
+	// holding it fires schedules. Empty means this instance always fires.
+	LeasePath string `yaml:"lease_path"`
+	// StatePath records when each schedule last fired so missed runs can
+	// be detected across restarts. Empty keeps the record in memory.
+	StatePath string           `yaml:"state_path"`
+	Schedules []ScheduleConfig `yaml:"schedules,omitempty"`
+}
+
+// ScheduleConfig fires a trigger event on a cron expression
+type ScheduleConfig struct {
+	Name string `yaml:"name"`
+	// Cron is a five-field cron expression or a descriptor such as @daily
+	Cron string `yaml:"cron"`
+	// Timezone is an IANA zone name the expression is evaluated in; UTC by
+	// default
+	Timezone     string `yaml:"timezone,omitempty"`
+	TriggerEvent string `yaml:"trigger_event"`
+	// Payload is sent with the trigger; string values are Go templates
+	// rendered with .Schedule, .ScheduledAt and .FiredAt
+	Payload map[string]interface{} `yaml:"payload,omitempty"`
+	// MissedRuns decides what happens to occurrences missed while no
+	// replica was firing: skip, run_once or run_all
+	MissedRuns string `yaml:"missed_runs,omitempty"`
+}
+
+// Supported enumerations
+const (
+	auditBackendFile   = "file"
+	auditBackendMemory = "memory"
+
+	authModeNone  = "none"
+	authModeToken = "token"
+
+	missedRunsSkip    = "skip"
+	missedRunsRunOnce = "run_once"
+	missedRunsRunAll  = "run_all"
+)
+
+// requiredSoRs are the Systems of Record the built-in workflows consult
+var requiredSoRs = []string{"plm", "docgen"}
+
+// ConfigError lists every problem found while validating a config or the
+// workflow definitions it points at
+type ConfigError struct {
+	// Subject names what was validated; it defaults to "configuration"
+	Subject  string
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	subject := e.Subject
+	if subject == "" {
+		subject = "configuration"
+	}
+	return "invalid " + subject + ":\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// defaultConfig returns the configuration used when nothing is overridden
+func defaultConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ListenAddr: ":8080",
+		},
+		Audit: AuditConfig{
+			Backend: auditBackendFile,
+			Path:    "/app/data/audit-log.json",
+		},
+		SoRs: map[string]SoRConfig{
+			"plm": {
+				URL:     "http://localhost:8081",
+				Timeout: defaultSoRTimeout,
+			},
+			"docgen": {
+				URL:     "http://localhost:8082",
+				Timeout: defaultSoRTimeout,
+			},
+		},
+		Retry: RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: Duration(200 * time.Millisecond),
+			MaxBackoff:     Duration(2 * time.Second),
+		},
+		Timeouts: TimeoutConfig{
+			ReadHeader: Duration(10 * time.Second),
+			Read:       Duration(30 * time.Second),
+			Write:      Duration(2 * time.Minute),
+			Idle:       Duration(2 * time.Minute),
+			Shutdown:   Duration(30 * time.Second),
+		},
+		Auth: AuthConfig{
+			Mode: authModeNone,
+		},
+		Batch: BatchConfig{
+			MaxItems:       200,
+			Concurrency:    4,
+			MaxConcurrency: 16,
+		},
+		TestCatalogue: defaultTestCatalogue(),
+	}
+}
+
+// LoadConfig builds the effective configuration from defaults, the optional
+// YAML file at path and environment overrides, then validates it
+func LoadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	cfg.applyDefaults()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// applyEnv overlays environment variables on top of the file configuration
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var problems []string
+
+	setString := func(name string, target *string) {
+		if v, ok := lookup(name); ok && v != "" {
+			*target = v
+		}
+	}
+	setDuration := func(name string, target *Duration) {
+		if v, ok := lookup(name); ok && v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid duration %q", name, v))
+				return
+			}
+			*target = Duration(d)
+		}
+	}
+	setSoRURL := func(name, sor string) {
+		if v, ok := lookup(name); ok && v != "" {
+			sc := c.SoRs[sor]
+			sc.URL = v
+			c.SoRs[sor] = sc
+		}
+	}
+
+	if v, ok := lookup("PORT"); ok && v != "" {
+		c.Server.ListenAddr = ":" + v
+	}
+	setString("LISTEN_ADDR", &c.Server.ListenAddr)
+	if v, ok := lookup("TLS_ENABLED"); ok && v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("TLS_ENABLED: invalid boolean %q", v))
+		}
+		c.Server.TLS.Enabled = enabled
+	}
+	setString("TLS_CERT_FILE", &c.Server.TLS.CertFile)
+	setString("TLS_KEY_FILE", &c.Server.TLS.KeyFile)
+
+	setString("AUDIT_BACKEND", &c.Audit.Backend)
+	setString("AUDIT_LOG_PATH", &c.Audit.Path)
+
+	if c.SoRs == nil {
+		c.SoRs = map[string]SoRConfig{}
+	}
+	setSoRURL("PLM_SERVICE_URL", "plm")
+	setSoRURL("DOCGEN_SERVICE_URL", "docgen")
+
+	if v, ok := lookup("RETRY_MAX_ATTEMPTS"); ok && v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("RETRY_MAX_ATTEMPTS: invalid integer %q", v))
+		}
+		c.Retry.MaxAttempts = n
+	}
+	setDuration("SHUTDOWN_TIMEOUT", &c.Timeouts.Shutdown)
+
+	setString("AUTH_MODE", &c.Auth.Mode)
+	if v, ok := lookup("AUTH_TOKENS"); ok && v != "" {
+		c.Auth.Tokens = nil
+		for _, pair := range strings.Split(v, ",") {
+			name, token, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found {
+				problems = append(problems, "AUTH_TOKENS: entries must be name=token")
+				continue
+			}
+			c.Auth.Tokens = append(c.Auth.Tokens, TokenIdentity{Name: name, Token: token})
+		}
+	}
+
+	setString("WORKFLOW_DEFINITIONS_DIR", &c.Workflows.DefinitionsDir)
+	setString("DOCUMENT_TEMPLATES_DIR", &c.Documents.TemplatesDir)
+	setString("SCHEDULER_LEASE_PATH", &c.Scheduler.LeasePath)
+	setString("SCHEDULER_STATE_PATH", &c.Scheduler.StatePath)
+	if v, ok := lookup("BATCH_CONCURRENCY"); ok && v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("BATCH_CONCURRENCY: invalid integer %q", v))
+		}
+		c.Batch.Concurrency = n
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// applyDefaults fills per-SoR settings a file or env override left unset
+func (c *Config) applyDefaults() {
+	for name, sor := range c.SoRs {
+		if sor.Timeout == 0 {
+			sor.Timeout = defaultSoRTimeout
+			c.SoRs[name] = sor
+		}
+	}
+	c.TestCatalogue.applyDefaults()
+	for i := range c.Scheduler.Schedules {
+		if c.Scheduler.Schedules[i].MissedRuns == "" {
+			c.Scheduler.Schedules[i].MissedRuns = missedRunsSkip
+		}
+	}
+}
+
+// Validate checks the configuration and reports every problem at once
+func (c *Config) Validate() error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Server.ListenAddr == "" {
+		addf("server.listen_addr: must not be empty")
+	} else if _, _, err := net.SplitHostPort(c.Server.ListenAddr); err != nil {
+		addf("server.listen_addr: %q is not host:port (%v)", c.Server.ListenAddr, err)
+	}
+	if c.Server.TLS.Enabled {
+		files := [][2]string{{"cert_file", c.Server.TLS.CertFile}, {"key_file", c.Server.TLS.KeyFile}}
+		for _, f := range files {
+			if f[1] == "" {
+				addf("server.tls.%s: required when TLS is enabled", f[0])
+			} else if _, err := os.Stat(f[1]); err != nil {
+				addf("server.tls.%s: %v", f[0], err)
+			}
+		}
+	}
+
+	switch c.Audit.Backend {
+	case auditBackendFile:
+		if c.Audit.Path == "" {
+			addf("audit.path: required for the %q backend", auditBackendFile)
+		}
+	case auditBackendMemory:
+	default:
+		addf("audit.backend: %q is not one of %q, %q", c.Audit.Backend, auditBackendFile, auditBackendMemory)
+	}
+
+	for _, name := range requiredSoRs {
+		if _, ok := c.SoRs[name]; !ok {
+			addf("sors.%s: required by the built-in workflows", name)
+		}
+	}
+	names := make([]string, 0, len(c.SoRs))
+	for name := range c.SoRs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sor := c.SoRs[name]
+		if u, err := url.Parse(sor.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			addf("sors.%s.url: %q is not an absolute URL", name, sor.URL)
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			addf("sors.%s.url: scheme must be http or https", name)
+		}
+		if sor.Timeout <= 0 {
+			addf("sors.%s.timeout: must be positive", name)
+		}
+		if sor.Retry != nil {
+			problems = append(problems, sor.Retry.validate("sors."+name+".retry")...)
+		}
+	}
+
+	problems = append(problems, c.Retry.validate("retry")...)
+
+	timeouts := map[string]Duration{
+		"read_header": c.Timeouts.ReadHeader,
+		"read":        c.Timeouts.Read,
+		"write":       c.Timeouts.Write,
+		"idle":        c.Timeouts.Idle,
+		"shutdown":    c.Timeouts.Shutdown,
+	}
+	for _, field := range []string{"read_header", "read", "write", "idle", "shutdown"} {
+		if timeouts[field] < 0 {
+			addf("timeouts.%s: must not be negative", field)
+		}
+	}
+
+	switch c.Auth.Mode {
+	case authModeNone:
+	case authModeToken:
+		if len(c.Auth.Tokens) == 0 {
+			addf("auth.tokens: at least one token is required in %q mode", authModeToken)
+		}
+		seen := map[string]bool{}
+		for i, t := range c.Auth.Tokens {
+			if t.Name == "" {
+				addf("auth.tokens[%d].name: must not be empty", i)
+			}
+			if len(t.Token) < 16 {
+				addf("auth.tokens[%d].token: must be at least 16 characters", i)
+			}
+			if seen[t.Token] {
+				addf("auth.tokens[%d].token: duplicates an earlier token", i)
+			}
+			seen[t.Token] = true
+		}
+	default:
+		addf("auth.mode: %q is not one of %q, %q", c.Auth.Mode, authModeNone, authModeToken)
+	}
+
+	if dir := c.Workflows.DefinitionsDir; dir != "" {
+		if info, err := os.Stat(dir); err != nil {
+			addf("workflows.definitions_dir: %v", err)
+		} else if !info.IsDir() {
+			addf("workflows.definitions_dir: %s is not a directory", dir)
+		}
+	}
+	if dir := c.Documents.TemplatesDir; dir != "" {
+		if info, err := os.Stat(dir); err != nil {
+			addf("documents.templates_dir: %v", err)
+		} else if !info.IsDir() {
+			addf("documents.templates_dir: %s is not a directory", dir)
+		}
+	}
+
+	if c.Batch.MaxItems < 1 {
+		addf("batch.max_items: must be at least 1")
+	}
+	if c.Batch.MaxConcurrency < 1 {
+		addf("batch.max_concurrency: must be at least 1")
+	}
+	if c.Batch.Concurrency < 1 || c.Batch.Concurrency > c.Batch.MaxConcurrency {
+		addf("batch.concurrency: must be between 1 and max_concurrency (%d)", c.Batch.MaxConcurrency)
+	}
+
+	problems = append(problems, c.TestCatalogue.validate("test_catalogue")...)
+
+	seenSchedules := map[string]bool{}
+	for i, sc := range c.Scheduler.Schedules {
+		if sc.Name == "" {
+			addf("scheduler.schedules[%d].name: must not be empty", i)
+		} else if seenSchedules[sc.Name] {
+			addf("scheduler.schedules[%d].name: %q is used more than once", i, sc.Name)
+		}
+		seenSchedules[sc.Name] = true
+		if _, err := compileSchedule(sc); err != nil {
+			addf("scheduler.schedules[%d].%v", i, err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// validate checks a retry policy, prefixing problems with field
+func (r RetryConfig) validate(field string) []string {
+	var problems []string
+	if r.MaxAttempts < 1 {
+		problems = append(problems, fmt.Sprintf("%s.max_attempts: must be at least 1", field))
+	}
+	if r.InitialBackoff < 0 {
+		problems = append(problems, fmt.Sprintf("%s.initial_backoff: must not be negative", field))
+	}
+	if r.MaxBackoff < r.InitialBackoff {
+		problems = append(problems, fmt.Sprintf("%s.max_backoff: must not be less than initial_backoff", field))
+	}
+	return problems
+}
+
+// retryFor returns the retry policy that applies to the named SoR
+func (c *Config) retryFor(sor string) RetryConfig {
+	if sc, ok := c.SoRs[sor]; ok && sc.Retry != nil {
+		return *sc.Retry
+	}
+	return c.Retry
+}
+
+// Redacted returns a copy of the config safe to print
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.SoRs = make(map[string]SoRConfig, len(c.SoRs))
+	for name, sor := range c.SoRs {
+		if u, err := url.Parse(sor.URL); err == nil && u.User != nil {
+			if _, hasPassword := u.User.Password(); hasPassword {
+				// The marker is added after encoding so it is not
+				// percent-escaped; url.User escapes any @ in the username
+				u.User = url.User(u.User.Username())
+				sor.URL = strings.Replace(u.String(), "@", ":"+redactedSecret+"@", 1)
+			}
+		}
+		redacted.SoRs[name] = sor
+	}
+	redacted.Auth.Tokens = make([]TokenIdentity, len(c.Auth.Tokens))
+	for i, t := range c.Auth.Tokens {
+		redacted.Auth.Tokens[i] = TokenIdentity{Name: t.Name, Token: redactedSecret}
+	}
+	return &redacted
+}
+
+// YAML renders the config as YAML
+func (c *Config) YAML() (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return "", fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"crosscut-contracts"
+	"crosscut-contracts/interactions"
+)
+
+var updateContracts = flag.Bool("update-contracts", false, "rewrite the interaction contracts in testdata/contracts")
+
+// Interaction contracts recorded by TestRecordContracts. The mocks' tests
+// replay them against their routers.
+const (
+	plmContract    = "testdata/contracts/mock-plm-service.json"
+	docgenContract = "testdata/contracts/mock-docgen-service.json"
+)
+
+// contractWorkflowID replaces the generated workflow ID in recorded
+// requests, so recordings do not change from run to run
+const contractWorkflowID = "wf-contract"
+
+// newPLMRecorder expects the PLM requests of a release of ROUTER-100
+// revision C, answered as the BPO relies on
+func newPLMRecorder() *interactions.Recorder {
+	const state = "product ROUTER-100 has revision C"
+	plm := interactions.NewRecorder("crosscut-bpo", "mock-plm-service")
+
+	plm.Expect("read the test components of a product revision", state,
+		http.MethodGet, "/products/ROUTER-100/revisions/C", http.StatusOK,
+		ProductRevision{
+			Product:  "ROUTER-100",
+			Revision: "C",
+			Current:  true,
+			Voltage:  "12V",
+			Components: []ProductComponent{
+				{Name: "PowerTest", Voltage: "12V", TestType: "power_supply_validation"},
+				{Name: "EthernetPortTest", Voltage: "3.3V", TestType: "signal_integrity"},
+			},
+		})
+	plm.Expect("resolve the voltages of a template plan", state,
+		http.MethodPost, "/enrich-plan", http.StatusOK,
+		EnrichedPlan{
+			Product:  "ROUTER-100",
+			Revision: "C",
+			Components: []EnrichedComponent{
+				{Name: "PowerTest", Voltage: "12V", TestType: "power_supply_validation"},
+				{Name: "EthernetPortTest", Voltage: "3.3V", TestType: "signal_integrity"},
+			},
+		})
+	// The BPO only checks the status of a release status update
+	plm.Expect("record the release status of a product revision", state,
+		http.MethodPost, "/products/ROUTER-100/release-status", http.StatusOK, nil)
+	return plm
+}
+
+// newDocGenRecorder expects the DocGen requests of a release of
+// ROUTER-100, answered as the BPO relies on
+func newDocGenRecorder() *interactions.Recorder {
+	docgen := interactions.NewRecorder("crosscut-bpo", "mock-docgen-service")
+	validated := 3
+
+	docgen.Expect("list the components DocGen can render", "",
+		http.MethodGet, "/components", http.StatusOK,
+		contracts.ComponentsResponse{
+			Components: []string{"DocumentTitle", "TestBlock"},
+			Count:      2,
+		})
+	docgen.Expect("validate a document plan", "",
+		http.MethodPost, "/validate-plan", http.StatusOK,
+		ValidationResponse{
+			Valid:               true,
+			Message:             "Document plan is valid",
+			ComponentsValidated: &validated,
+		})
+	docgen.Expect("generate a document", "",
+		http.MethodPost, "/generate", http.StatusOK,
+		DocGenResponse{
+			Status:             "success",
+			URL:                "gcs://fake-bucket/ROUTER-100-DVT-Procedure-Rev-C.docx",
+			Filename:           "ROUTER-100-DVT-Procedure-Rev-C.docx",
+			GenerationTimeMs:   120,
+			ComponentsRendered: 3,
+		})
+	// Deleting a document that is already gone also succeeds, but the BPO
+	// relies on a generated document being deletable
+	docgen.Expect("delete a generated document", "document ROUTER-100-DVT-Procedure-Rev-C.docx was generated",
+		http.MethodDelete, "/documents/ROUTER-100-DVT-Procedure-Rev-C.docx", http.StatusOK, nil)
+	return docgen
+}
+
+// TestRecordContracts runs a release against recorders standing in for PLM
+// and DocGen and compares the requests the BPO sent with the recorded
+// contracts. Run with -update-contracts after an intended change, then run
+// the mocks' tests to check they still accept the new requests.
+func TestRecordContracts(t *testing.T) {
+	plm, docgen := newPLMRecorder(), newDocGenRecorder()
+	plmServer, docgenServer := httptest.NewServer(plm), httptest.NewServer(docgen)
+	defer plmServer.Close()
+	defer docgenServer.Close()
+
+	t.Setenv("PLM_SERVICE_URL", plmServer.URL)
+	t.Setenv("DOCGEN_SERVICE_URL", docgenServer.URL)
+	t.Setenv("WORKFLOW_DEFINITIONS_DIR", "testdata/contracts/workflows")
+	t.Setenv("RETRY_MAX_ATTEMPTS", "1")
+	service := newTestService(t)
+
+	if err := verifyCatalogue(service.current()); err != nil {
+		t.Fatalf("verifying the test catalogue: %v", err)
+	}
+	rec := serve(service.setupRoutes().Handler, http.MethodPost, "/v1/execute-workflow",
+		`{"trigger_event": "contract.release", "payload": {"product_name": "ROUTER-100", "revision": "C"}}`)
+	var response WorkflowResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("workflow failed with %d: %s", rec.Code, rec.Body)
+	}
+
+	for _, recorder := range []struct {
+		path     string
+		recorder *interactions.Recorder
+	}{
+		{plmContract, plm},
+		{docgenContract, docgen},
+	} {
+		if unexpected := recorder.recorder.Unexpected(); len(unexpected) > 0 {
+			t.Errorf("%s: requests without an expected interaction: %v", recorder.path, unexpected)
+		}
+		contract := recorder.recorder.Contract()
+		for i := range contract.Interactions {
+			request := &contract.Interactions[i].Request
+			request.Body = bytes.ReplaceAll(request.Body, []byte(response.WorkflowID), []byte(contractWorkflowID))
+		}
+		checkContract(t, recorder.path, contract)
+	}
+}
+
+// checkContract compares a recorded contract with the one saved at path,
+// or saves it with -update-contracts
+func checkContract(t *testing.T, path string, contract *interactions.Contract) {
+	t.Helper()
+	got, err := contract.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *updateContracts {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run go test -run TestRecordContracts -update-contracts", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("the BPO's requests differ from %s; if the change is intended, run go test -run TestRecordContracts -update-contracts and the mocks' tests\ngot:\n%s", path, got)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// builtinDefinitions are used when no definitions directory is configured
+//
+//go:embed workflows/*.yaml
+var builtinDefinitions embed.FS
+
+// WorkflowDefinition describes the steps run when a trigger event arrives.
+// Several versions of the same named workflow may be registered at once.
+type WorkflowDefinition struct {
+	Name        string                     `yaml:"name" json:"name"`
+	Version     int                        `yaml:"version" json:"version"`
+	Trigger     string                     `yaml:"trigger" json:"trigger"`
+	Description string                     `yaml:"description,omitempty" json:"description,omitempty"`
+	Deprecated  bool                       `yaml:"deprecated,omitempty" json:"deprecated,omitempty"`
+	Inputs      map[string]InputDefinition `yaml:"inputs,omitempty" json:"inputs,omitempty"`
+	Steps       []StepDefinition           `yaml:"steps" json:"steps"`
+
+	// Digest identifies the definition source, set when loaded
+	Digest string `yaml:"-" json:"digest"`
+	// Source is the file the definition was loaded from
+	Source string `yaml:"-" json:"source"`
+}
+
+// definitionKey identifies one version of a named workflow
+type definitionKey struct {
+	Name    string
+	Version int
+}
+
+// key returns the registry key of the definition
+func (d *WorkflowDefinition) key() definitionKey {
+	return definitionKey{Name: d.Name, Version: d.Version}
+}
+
+// String renders the definition as name@version
+func (d *WorkflowDefinition) String() string {
+	return fmt.Sprintf("%s@%d", d.Name, d.Version)
+}
+
+// InputDefinition declares a payload field the workflow reads
+type InputDefinition struct {
+	Required bool   `yaml:"required,omitempty" json:"required,omitempty"`
+	Default  string `yaml:"default,omitempty" json:"default,omitempty"`
+}
+
+// StepDefinition is a single step of a workflow
+type StepDefinition struct {
+	ID   string `yaml:"id" json:"id"`
+	Type string `yaml:"type" json:"type"`
+	// When is a CEL condition; the step is skipped when it is false
+	When string                 `yaml:"when,omitempty" json:"when,omitempty"`
+	With map[string]interface{} `yaml:"with,omitempty" json:"with,omitempty"`
+	// Compensate undoes the step if the workflow fails after it completed
+	Compensate *StepDefinition `yaml:"compensate,omitempty" json:"compensate,omitempty"`
+}
+
+// definitionRegistry indexes every registered version of each workflow
+type definitionRegistry struct {
+	// byName holds each workflow's versions in ascending order
+	byName map[string][]*WorkflowDefinition
+	// byTrigger maps a trigger event to the workflow name handling it
+	byTrigger map[string]string
+}
+
+// latest returns the highest version handling a trigger event that is not
+// deprecated, either in its definition or according to isDeprecated
+func (r *definitionRegistry) latest(trigger string, isDeprecated func(definitionKey) bool) (*WorkflowDefinition, error) {
+	name, ok := r.byTrigger[trigger]
+	if !ok {
+		return nil, fmt.Errorf("unknown trigger event: %s", trigger)
+	}
+
+	versions := r.byName[name]
+	for i := len(versions) - 1; i >= 0; i-- {
+		def := versions[i]
+		if !def.Deprecated && !isDeprecated(def.key()) {
+			return def, nil
+		}
+	}
+	return nil, fmt.Errorf("every version of workflow %s is deprecated", name)
+}
+
+// versions returns the registered versions of a workflow in ascending order
+func (r *definitionRegistry) versions(name string) []*WorkflowDefinition {
+	return r.byName[name]
+}
+
+// find returns one version of a workflow
+func (r *definitionRegistry) find(key definitionKey) (*WorkflowDefinition, bool) {
+	for _, def := range r.byName[key.Name] {
+		if def.Version == key.Version {
+			return def, true
+		}
+	}
+	return nil, false
+}
+
+// names returns the registered workflow names in order
+func (r *definitionRegistry) names() []string {
+	names := make([]string, 0, len(r.byName))
+	for name := range r.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// definitions returns all registered definitions ordered by name and version
+func (r *definitionRegistry) definitions() []*WorkflowDefinition {
+	var defs []*WorkflowDefinition
+	for _, name := range r.names() {
+		defs = append(defs, r.byName[name]...)
+	}
+	return defs
+}
+
+// loadDefinitions reads every *.yaml/*.yml definition from dir, or the
+// built-in definitions when dir is empty, and validates the resulting set
+func loadDefinitions(dir string) (*definitionRegistry, error) {
+	var fsys fs.FS = builtinDefinitions
+	root := "workflows"
+	if dir != "" {
+		fsys = os.DirFS(dir)
+		root = "."
+	}
+
+	entries, err := fs.ReadDir(fsys, root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow definitions: %w", err)
+	}
+
+	var defs []*WorkflowDefinition
+	var problems []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		path := filepath.ToSlash(filepath.Join(root, entry.Name()))
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read workflow definition %s: %w", entry.Name(), err)
+		}
+
+		def, err := parseDefinition(data)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", entry.Name(), err))
+			continue
+		}
+		def.Source = entry.Name()
+		if dir != "" {
+			def.Source = filepath.Join(dir, entry.Name())
+		}
+		defs = append(defs, def)
+	}
+
+	registry := &definitionRegistry{
+		byName:    make(map[string][]*WorkflowDefinition),
+		byTrigger: make(map[string]string),
+	}
+	for _, def := range defs {
+		if existing, ok := registry.find(def.key()); ok {
+			problems = append(problems, fmt.Sprintf("%s: %s is already defined in %s", def.Source, def, existing.Source))
+			continue
+		}
+		if name, ok := registry.byTrigger[def.Trigger]; ok && name != def.Name {
+			problems = append(problems, fmt.Sprintf("%s: trigger %q is already handled by workflow %s", def.Source, def.Trigger, name))
+			continue
+		}
+		if versions := registry.byName[def.Name]; len(versions) > 0 && versions[0].Trigger != def.Trigger {
+			problems = append(problems, fmt.Sprintf("%s: %s must keep trigger %q", def.Source, def, versions[0].Trigger))
+			continue
+		}
+		registry.byTrigger[def.Trigger] = def.Name
+		registry.byName[def.Name] = append(registry.byName[def.Name], def)
+	}
+	for _, versions := range registry.byName {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	}
+
+	if len(problems) > 0 {
+		return nil, &ConfigError{Subject: "workflow definitions", Problems: problems}
+	}
+	return registry, nil
+}
+
+// parseDefinition decodes and validates a single definition document
+func parseDefinition(data []byte) (*WorkflowDefinition, error) {
+	var def WorkflowDefinition
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&def); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("definition is empty")
+		}
+		return nil, err
+	}
+
+	if err := def.validate(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	def.Digest = hex.EncodeToString(sum[:])[:12]
+	return &def, nil
+}
+
+// validate checks a definition is complete and only uses known step types
+func (d *WorkflowDefinition) validate() error {
+	var problems []string
+	if d.Name == "" {
+		problems = append(problems, "name: must not be empty")
+	}
+	if d.Version < 1 {
+		problems = append(problems, "version: must be a positive integer")
+	}
+	if d.Trigger == "" {
+		problems = append(problems, "trigger: must not be empty")
+	}
+	problems = append(problems, validateSteps("steps", d.Steps)...)
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateSteps checks a sequence of steps, reporting problems under path.
+// Step types that nest steps validate them through their stepValidators.
+func validateSteps(path string, steps []StepDefinition) []string {
+	var problems []string
+	if len(steps) == 0 {
+		problems = append(problems, fmt.Sprintf("%s: at least one step is required", path))
+	}
+
+	seen := map[string]bool{}
+	for i, step := range steps {
+		if step.ID == "" {
+			problems = append(problems, fmt.Sprintf("%s[%d].id: must not be empty", path, i))
+		} else if seen[step.ID] {
+			problems = append(problems, fmt.Sprintf("%s[%d].id: %q is used more than once", path, i, step.ID))
+		}
+		seen[step.ID] = true
+
+		if _, ok := stepTypes[step.Type]; !ok {
+			problems = append(problems, fmt.Sprintf("%s[%d].type: unknown step type %q (known: %s)", path, i, step.Type, strings.Join(knownStepTypes(), ", ")))
+		} else if validate, ok := stepValidators[step.Type]; ok {
+			if err := validate(step); err != nil {
+				problems = append(problems, fmt.Sprintf("%s[%d].with: %v", path, i, err))
+			}
+		}
+
+		if step.When != "" {
+			if _, err := compileCondition(step.When); err != nil {
+				problems = append(problems, fmt.Sprintf("%s[%d].when: %v", path, i, err))
+			}
+		}
+
+		if step.Compensate != nil {
+			for _, problem := range validateCompensation(step) {
+				problems = append(problems, fmt.Sprintf("%s[%d].compensate.%s", path, i, problem))
+			}
+		}
+	}
+	return problems
+}
+
+// resolveInputs applies the definition's declared inputs to a payload
+func (d *WorkflowDefinition) resolveInputs(payload map[string]interface{}) (map[string]string, error) {
+	names := make([]string, 0, len(d.Inputs))
+	for name := range d.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	inputs := make(map[string]string, len(names))
+	for _, name := range names {
+		input := d.Inputs[name]
+		value, ok := payload[name].(string)
+		switch {
+		case ok:
+			inputs[name] = value
+		case input.Required:
+			return nil, fmt.Errorf("%s is required in payload", name)
+		default:
+			inputs[name] = input.Default
+		}
+	}
+	return inputs, nil
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// builtinTemplates are used when no templates directory is configured
+//
+//go:embed documents/*.yaml
+var builtinTemplates embed.FS
+
+// forEachComponents repeats a template component once per enriched
+// component PLM reported
+const forEachComponents = "components"
+
+// DocumentTemplate lays out the document plan of one kind of document. Every
+// string in it is a Go template rendered with templateData.
+type DocumentTemplate struct {
+	Name        string           `yaml:"name"`
+	Description string           `yaml:"description,omitempty"`
+	DocProps    TemplateDocProps `yaml:"doc_props,omitempty"`
+	// Header is rendered as the document's header component
+	Header *TemplateComponent `yaml:"header,omitempty"`
+	// Title is rendered as the first component of the body
+	Title *TemplateComponent  `yaml:"title,omitempty"`
+	Body  []TemplateComponent `yaml:"body"`
+
+	// Digest identifies the template source, set when loaded
+	Digest string `yaml:"-"`
+	// Source is the file the template was loaded from
+	Source string `yaml:"-"`
+}
+
+// TemplateDocProps is the document metadata of a template
+type TemplateDocProps struct {
+	Filename string `yaml:"filename,omitempty"`
+}
+
+// TemplateComponent is one component of a document template
+type TemplateComponent struct {
+	Component string                 `yaml:"component,omitempty"`
+	Props     map[string]interface{} `yaml:"props,omitempty"`
+	Children  []TemplateComponent    `yaml:"children,omitempty"`
+	// ForEach repeats the component once per item of SoR data, available
+	// to its templates as .Item
+	ForEach string `yaml:"for_each,omitempty"`
+	// Catalogue renders .Item the way the test catalogue documents its test
+	// type, in place of Component and Props
+	Catalogue bool `yaml:"catalogue,omitempty"`
+}
+
+// templateData is what document templates are rendered with
+type templateData struct {
+	Payload map[string]interface{}
+	Inputs  map[string]string
+	// Plan is the plan enriched by PLM
+	Plan *EnrichedPlan
+	// Item is the current component inside a for_each
+	Item *EnrichedComponent
+}
+
+// templateRegistry indexes document templates by name
+type templateRegistry struct {
+	byName map[string]*DocumentTemplate
+}
+
+// find returns a template by name
+func (r *templateRegistry) find(name string) (*DocumentTemplate, bool) {
+	tmpl, ok := r.byName[name]
+	return tmpl, ok
+}
+
+// names returns the registered template names in order
+func (r *templateRegistry) names() []string {
+	names := make([]string, 0, len(r.byName))
+	for name := range r.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadTemplates reads every *.yaml/*.yml document template from dir, or the
+// built-in templates when dir is empty
+func loadTemplates(dir string) (*templateRegistry, error) {
+	var fsys fs.FS = builtinTemplates
+	root := "documents"
+	if dir != "" {
+		fsys = os.DirFS(dir)
+		root = "."
+	}
+
+	entries, err := fs.ReadDir(fsys, root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document templates: %w", err)
+	}
+
+	registry := &templateRegistry{byName: make(map[string]*DocumentTemplate)}
+	var problems []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		path := filepath.ToSlash(filepath.Join(root, entry.Name()))
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read document template %s: %w", entry.Name(), err)
+		}
+
+		tmpl, err := parseTemplate(data)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", entry.Name(), err))
+			continue
+		}
+		tmpl.Source = entry.Name()
+		if dir != "" {
+			tmpl.Source = filepath.Join(dir, entry.Name())
+		}
+		if existing, ok := registry.find(tmpl.Name); ok {
+			problems = append(problems, fmt.Sprintf("%s: template %s is already defined in %s", tmpl.Source, tmpl.Name, existing.Source))
+			continue
+		}
+		registry.byName[tmpl.Name] = tmpl
+	}
+
+	if len(problems) > 0 {
+		return nil, &ConfigError{Subject: "document templates", Problems: problems}
+	}
+	return registry, nil
+}
+
+// parseTemplate decodes and validates a single document template
+func parseTemplate(data []byte) (*DocumentTemplate, error) {
+	var tmpl DocumentTemplate
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&tmpl); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("template is empty")
+		}
+		return nil, err
+	}
+
+	if err := tmpl.validate(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	tmpl.Digest = hex.EncodeToString(sum[:])[:12]
+	return &tmpl, nil
+}
+
+// validate checks a template is complete and that its strings parse
+func (t *DocumentTemplate) validate() error {
+	var problems []string
+	if t.Name == "" {
+		problems = append(problems, "name: must not be empty")
+	}
+	if err := checkTemplateValue(t.DocProps.Filename); err != nil {
+		problems = append(problems, fmt.Sprintf("doc_props.filename: %v", err))
+	}
+	if t.Header != nil {
+		if len(t.Header.Children) > 0 {
+			problems = append(problems, "header.children: a header cannot have children")
+		}
+		problems = append(problems, t.Header.validate("header", false, false)...)
+	}
+	if t.Title != nil {
+		problems = append(problems, t.Title.validate("title", false, false)...)
+	}
+	if t.Title == nil && len(t.Body) == 0 {
+		problems = append(problems, "body: a title or at least one body component is required")
+	}
+	for i, comp := range t.Body {
+		problems = append(problems, comp.validate(fmt.Sprintf("body[%d]", i), true, false)...)
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validate checks a template component and its children, reporting problems
+// under path. repeatable says whether for_each may be used here, and
+// inLoop whether an enclosing component already repeats.
+func (c TemplateComponent) validate(path string, repeatable, inLoop bool) []string {
+	var problems []string
+	switch c.ForEach {
+	case "":
+	case forEachComponents:
+		switch {
+		case !repeatable:
+			problems = append(problems, path+".for_each: not allowed here")
+		case inLoop:
+			problems = append(problems, path+".for_each: an enclosing component already repeats")
+		}
+		inLoop = true
+	default:
+		problems = append(problems, fmt.Sprintf("%s.for_each: must be %q", path, forEachComponents))
+	}
+
+	if c.Catalogue {
+		if !inLoop {
+			problems = append(problems, path+".catalogue: needs for_each on this or an enclosing component")
+		}
+		if c.Component != "" || len(c.Props) > 0 {
+			problems = append(problems, path+".catalogue: the test catalogue decides component and props")
+		}
+	} else if c.Component == "" {
+		problems = append(problems, path+".component: must not be empty")
+	}
+
+	keys := make([]string, 0, len(c.Props))
+	for key := range c.Props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := checkTemplateValue(c.Props[key]); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.props.%s: %v", path, key, err))
+		}
+	}
+
+	for i, child := range c.Children {
+		problems = append(problems, child.validate(fmt.Sprintf("%s.children[%d]", path, i), repeatable, inLoop)...)
+	}
+	return problems
+}
+
+// checkTemplateValue parses every string in a template value
+func checkTemplateValue(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		_, err := parseTemplateString(v)
+		return err
+	case map[string]interface{}:
+		for key, item := range v {
+			if err := checkTemplateValue(item); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if err := checkTemplateValue(item); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseTemplateString parses one template string
+func parseTemplateString(text string) (*template.Template, error) {
+	return template.New("document").Option("missingkey=error").Parse(text)
+}
+
+// render builds the document plan the template lays out
+func (t *DocumentTemplate) render(data templateData, catalogue TestCatalogueConfig) (*DocumentPlan, error) {
+	filename, err := renderTemplateValue(t.DocProps.Filename, data)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: doc_props.filename: %w", t.Name, err)
+	}
+	plan := &DocumentPlan{
+		DocProps: &DocProps{Filename: filename.(string)},
+		Body:     []ComponentInstance{},
+	}
+
+	if t.Header != nil {
+		header, err := t.Header.render("header", data, catalogue)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", t.Name, err)
+		}
+		plan.DocProps.HeaderComponent = header.Component
+		plan.DocProps.HeaderProps = header.Props
+	}
+	if t.Title != nil {
+		title, err := t.Title.render("title", data, catalogue)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", t.Name, err)
+		}
+		plan.Body = append(plan.Body, title)
+	}
+	for i, comp := range t.Body {
+		rendered, err := comp.renderAll(fmt.Sprintf("body[%d]", i), data, catalogue)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", t.Name, err)
+		}
+		plan.Body = append(plan.Body, rendered...)
+	}
+	return plan, nil
+}
+
+// renderAll renders a template component, once per item if it repeats
+func (c TemplateComponent) renderAll(path string, data templateData, catalogue TestCatalogueConfig) ([]ComponentInstance, error) {
+	if c.ForEach == "" {
+		rendered, err := c.render(path, data, catalogue)
+		if err != nil {
+			return nil, err
+		}
+		return []ComponentInstance{rendered}, nil
+	}
+
+	var items []ComponentInstance
+	if data.Plan != nil {
+		for i := range data.Plan.Components {
+			itemData := data
+			itemData.Item = &data.Plan.Components[i]
+			rendered, err := c.render(fmt.Sprintf("%s[%d]", path, i), itemData, catalogue)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, rendered)
+		}
+	}
+	return items, nil
+}
+
+// render renders one instance of a template component and its children
+func (c TemplateComponent) render(path string, data templateData, catalogue TestCatalogueConfig) (ComponentInstance, error) {
+	var instance ComponentInstance
+	if c.Catalogue {
+		instance = catalogue.instance(*data.Item, data.Inputs["product_name"], data.Inputs["revision"])
+	} else {
+		props := make(map[string]interface{}, len(c.Props))
+		for key, value := range c.Props {
+			rendered, err := renderTemplateValue(value, data)
+			if err != nil {
+				return instance, fmt.Errorf("%s.props.%s: %w", path, key, err)
+			}
+			props[key] = rendered
+		}
+		instance = ComponentInstance{Component: c.Component, Props: props}
+	}
+
+	for i, child := range c.Children {
+		rendered, err := child.renderAll(fmt.Sprintf("%s.children[%d]", path, i), data, catalogue)
+		if err != nil {
+			return instance, err
+		}
+		instance.Children = append(instance.Children, rendered...)
+	}
+	return instance, nil
+}
+
+// renderTemplateValue renders every string in a template value, including
+// those nested in maps and lists; other values are kept as they are
+func renderTemplateValue(value interface{}, data templateData) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		tmpl, err := parseTemplateString(v)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		return buf.String(), nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered, err := renderTemplateValue(item, data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			out[key] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderTemplateValue(item, data)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	default:
+		return value, nil
+	}
+}
+
+// checkDocumentTemplates reports build_document_plan steps, including those
+// in parallel branches, that name a template which is not registered
+func checkDocumentTemplates(definitions *definitionRegistry, templates *templateRegistry) error {
+	var problems []string
+	for _, def := range definitions.definitions() {
+		for _, problem := range missingTemplates("steps", def.Steps, templates) {
+			problems = append(problems, fmt.Sprintf("%s: %s", def.Source, problem))
+		}
+	}
+	if len(problems) > 0 {
+		return &ConfigError{Subject: "workflow definitions", Problems: problems}
+	}
+	return nil
+}
+
+// missingTemplates checks a sequence of steps, reporting problems under path
+func missingTemplates(path string, steps []StepDefinition, templates *templateRegistry) []string {
+	var problems []string
+	for i, step := range steps {
+		switch step.Type {
+		case "build_document_plan":
+			cfg, err := parseDocumentPlanConfig(step)
+			if err != nil {
+				continue
+			}
+			if _, ok := templates.find(cfg.Document); !ok {
+				problems = append(problems, fmt.Sprintf("%s[%d].with.document: no template %q (known: %s)", path, i, cfg.Document, strings.Join(templates.names(), ", ")))
+			}
+		case "parallel":
+			cfg, err := parseParallelConfig(step)
+			if err != nil {
+				continue
+			}
+			for j, branch := range cfg.Branches {
+				problems = append(problems, missingTemplates(fmt.Sprintf("%s[%d].with.branches[%d].steps", path, i, j), branch.Steps, templates)...)
+			}
+		}
+	}
+	return problems
+}
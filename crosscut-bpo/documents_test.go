@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"crosscut-contracts/bpo"
+	"crosscut-contracts/openapi"
+)
+
+// sectionedPlanFixture is the document plan shared with the DocGen mock's
+// tests, which replay it against the mock
+const sectionedPlanFixture = "testdata/sectioned-plan.json"
+
+// assertSameJSON fails unless got and want encode the same JSON value
+func assertSameJSON(t *testing.T, got, want []byte) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("decoding got: %v", err)
+	}
+	if err := json.Unmarshal(want, &wantValue); err != nil {
+		t.Fatalf("decoding want: %v", err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("JSON differs\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestDocumentPlanRoundTrip(t *testing.T) {
+	fixture, err := os.ReadFile(sectionedPlanFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var plan DocumentPlan
+	if err := json.Unmarshal(fixture, &plan); err != nil {
+		t.Fatalf("decoding fixture: %v", err)
+	}
+	encoded, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameJSON(t, encoded, fixture)
+}
+
+// TestDocumentPlanMatchesSpec checks the plan the BPO renders against the
+// DocumentPlan schema of the DocGen API
+func TestDocumentPlanMatchesSpec(t *testing.T) {
+	spec, err := openapi.Load("../docs/mock-docgen-openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, ok := spec.Schema("DocumentPlan")
+	if !ok {
+		t.Fatal("spec has no DocumentPlan schema")
+	}
+	fixture, err := os.ReadFile(sectionedPlanFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spec.ValidateJSON(fixture, schema, openapi.Options{Strict: true}); err != nil {
+		t.Errorf("document plan does not match the spec: %v", err)
+	}
+}
+
+func TestSectionedTemplateRender(t *testing.T) {
+	data, err := os.ReadFile("testdata/sectioned-dvt.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := parseTemplate(data)
+	if err != nil {
+		t.Fatalf("parsing template: %v", err)
+	}
+	catalogue := defaultTestCatalogue()
+	catalogue.applyDefaults()
+
+	plan, err := tmpl.render(templateData{
+		Payload: map[string]interface{}{"requested_by": "hw-release-bot"},
+		Inputs:  map[string]string{"product_name": "ROUTER-100", "revision": "C"},
+		Plan: &EnrichedPlan{
+			Product: "ROUTER-100",
+			Components: []EnrichedComponent{
+				{Name: "PowerTest", Voltage: "12V", TestType: "power_supply_validation"},
+				{Name: "EthernetPortTest", Voltage: "3.3V", TestType: "signal_integrity"},
+			},
+		},
+	}, catalogue)
+	if err != nil {
+		t.Fatalf("rendering template: %v", err)
+	}
+
+	encoded, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := os.ReadFile(sectionedPlanFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameJSON(t, encoded, fixture)
+}
+
+func TestTemplateValidation(t *testing.T) {
+	_, err := parseTemplate([]byte(`
+name: broken
+header:
+  component: AuthorBlock
+  children:
+    - component: TestBlock
+body:
+  - catalogue: true
+  - component: TestBlock
+    for_each: components
+    children:
+      - component: TestBlock
+        for_each: components
+`))
+	if err == nil {
+		t.Fatal("expected the template to be rejected")
+	}
+	for _, want := range []string{
+		"header.children: a header cannot have children",
+		"body[0].catalogue: needs for_each",
+		"body[1].children[0].for_each: an enclosing component already repeats",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestBuiltinTemplatesLoad(t *testing.T) {
+	templates, err := loadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := templates.names()
+	want := []string{"dvt_procedure", "release_note", "test_fixture_bom"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("templates = %v, want %v", got, want)
+	}
+}
+
+// inspectionHarness starts the services with a workflow that builds the
+// inspection_report template, loaded from a templates directory
+func inspectionHarness(t *testing.T) *harness {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "definition.yaml"), `
+name: inspection
+version: 1
+trigger: inspection.requested
+inputs:
+  product_name:
+    required: true
+  revision: {}
+steps:
+  - id: template_plan_generated
+    type: generate_template_plan
+  - id: plm_consultation
+    type: consult_plm
+  - id: document_plan_built
+    type: build_document_plan
+    with:
+      document: inspection_report
+`)
+	templates := t.TempDir()
+	writeFile(t, filepath.Join(templates, "inspection-report.yaml"), `
+name: inspection_report
+doc_props:
+  filename: "{{ .Inputs.product_name }}-Inspection-{{ .Payload.lot }}"
+header:
+  component: AuthorBlock
+  props:
+    author: "{{ .Payload.inspector }}"
+body:
+  - component: TestBlock
+    for_each: components
+    props:
+      test_name: "{{ .Item.Name }}"
+      voltage: "{{ .Item.Voltage }}"
+      lot: "{{ .Payload.lot }}"
+`)
+	return newHarness(t, func(cfg *Config) {
+		cfg.Workflows.DefinitionsDir = dir
+		cfg.Documents.TemplatesDir = templates
+	})
+}
+
+// documentPlan decodes the document plan of a dry run
+func documentPlan(t *testing.T, response *bpo.WorkflowResponse) DocumentPlan {
+	t.Helper()
+	data, err := json.Marshal(response.DocumentPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan DocumentPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func TestTemplateRendersPayloadAndComponents(t *testing.T) {
+	h := inspectionHarness(t)
+
+	response := h.dryRun("inspection.requested", map[string]interface{}{
+		"product_name": "ROUTER-100",
+		"revision":     "B",
+		"lot":          "L-42",
+		"inspector":    "qa-lead",
+	})
+
+	if response.Status != "success" {
+		t.Fatalf("response = %+v", response)
+	}
+	plan := documentPlan(t, response)
+	if plan.DocProps.Filename != "ROUTER-100-Inspection-L-42" {
+		t.Errorf("filename = %s", plan.DocProps.Filename)
+	}
+	if plan.DocProps.HeaderComponent != "AuthorBlock" || plan.DocProps.HeaderProps["author"] != "qa-lead" {
+		t.Errorf("header = %s %v, want AuthorBlock by qa-lead", plan.DocProps.HeaderComponent, plan.DocProps.HeaderProps)
+	}
+	// One block per component of rev B, in PLM's order
+	var got []string
+	for _, block := range plan.Body {
+		got = append(got, fmt.Sprintf("%s %v %v %v", block.Component, block.Props["test_name"], block.Props["voltage"], block.Props["lot"]))
+	}
+	h.assertSteps("body", got, []string{
+		"TestBlock PowerTest 12V L-42",
+		"TestBlock ThermalTest 12V L-42",
+		"TestBlock EthernetPortTest 5V L-42",
+	})
+}
+
+func TestMissingPayloadFieldFailsPlan(t *testing.T) {
+	h := inspectionHarness(t)
+
+	response := h.dryRun("inspection.requested", map[string]interface{}{
+		"product_name": "ROUTER-100",
+		"lot":          "L-42",
+	})
+
+	if response.Status != "failed" || !strings.Contains(response.Message, "header.props.author") || !strings.Contains(response.Message, `"inspector"`) {
+		t.Errorf("response = %+v, want the missing inspector reported", response)
+	}
+	h.assertTrace(response,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built failed",
+	)
+}
+
+func TestUnknownTemplateIsRejected(t *testing.T) {
+	h, definitionsDir, _ := reloadHarness(t)
+	before := h.service.current()
+
+	writeFile(t, filepath.Join(definitionsDir, "audit-pack.yaml"), `
+name: audit-pack
+version: 1
+trigger: audit.requested
+steps:
+  - id: document_plan_built
+    type: build_document_plan
+    with:
+      document: audit_pack
+`)
+	err := h.service.reload("test")
+
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || !strings.Contains(err.Error(), `steps[0].with.document: no template "audit_pack"`) {
+		t.Fatalf("error = %v, want the unknown template rejected", err)
+	}
+	if h.service.current() != before {
+		t.Error("a rejected reload replaced the configuration")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sideEffectSteps are the step types a dry run skips because they change a
+// System of Record or wait on a person. Every other step only reads from
+// the SoRs: PLM resolves plans and DocGen validates them without keeping
+// anything.
+var sideEffectSteps = map[string]bool{
+	"command_docgen":    true,
+	"delete_document":   true,
+	"notify_plm":        true,
+	"wait_for_approval": true,
+}
+
+// skippedInDryRun is the reason recorded for a side-effect step a dry run
+// did not execute
+const skippedInDryRun = "dry_run"
+
+// TraceEntry is one step of a dry run, recorded in place of the audit
+// entry a real run would write
+type TraceEntry struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Action    string                 `json:"action"`
+	Status    string                 `json:"status"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Branch    string                 `json:"branch,omitempty"`
+}
+
+// dryRunTrace collects the entries of a dry run. Parallel branches share
+// their run's trace.
+type dryRunTrace struct {
+	mu      sync.Mutex
+	entries []TraceEntry
+}
+
+func (t *dryRunTrace) add(entry TraceEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, entry)
+}
+
+func (t *dryRunTrace) snapshot() []TraceEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TraceEntry(nil), t.entries...)
+}
+
+// newDryRun prepares a run that simulates the workflow for an event. Its
+// audit entries go to its trace, it skips side-effect steps and it is not
+// tracked, so it cannot be looked up, retried or resumed.
+func (s *BPOService) newDryRun(event string, payload map[string]interface{}) (*workflowRun, error) {
+	run, err := s.newRun(event, payload)
+	if err != nil {
+		return nil, err
+	}
+	run.ID = "dry-run-" + strings.TrimPrefix(run.ID, "wf-")
+	run.trace = &dryRunTrace{}
+	return run, nil
+}
+
+// writeDryRunResult writes the outcome of a dry run: whether the workflow
+// would have succeeded, the document plan it built and the trace of its
+// steps. A failed simulation is still a successful request.
+func writeDryRunResult(w http.ResponseWriter, run *workflowRun, response *WorkflowResponse, err error) {
+	if err != nil {
+		log.Printf("Dry run %s failed: %v", run.ID, err)
+		response = &WorkflowResponse{
+			Status:     "failed",
+			WorkflowID: run.ID,
+			Message:    err.Error(),
+		}
+		var invalid *planInvalidError
+		if errors.As(err, &invalid) {
+			response.ValidationErrors = invalid.Errors
+		}
+	} else {
+		log.Printf("Dry run %s completed", run.ID)
+		response.Message = "Dry run completed; steps with side effects were skipped"
+	}
+
+	response.DryRun = true
+	response.Trace = run.trace.snapshot()
+	if plan, err := output[*DocumentPlan](run, outputDocumentPlan); err == nil {
+		response.DocumentPlan = plan
+	}
+	writeJSON(w, http.StatusOK, response)
+}
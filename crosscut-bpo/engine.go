@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runtimeState is an immutable snapshot of everything a workflow needs from
+// configuration. Reloads swap in a new snapshot; running workflows keep the
+// one they started with.
+type runtimeState struct {
+	config      *Config
+	sors        map[string]*sorClient
+	definitions *definitionRegistry
+	templates   *templateRegistry
+	schedules   []*schedule
+	loadedAt    time.Time
+}
+
+// newRuntimeState builds a snapshot from a validated config
+func newRuntimeState(cfg *Config) (*runtimeState, error) {
+	definitions, err := loadDefinitions(cfg.Workflows.DefinitionsDir)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := loadTemplates(cfg.Documents.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDocumentTemplates(definitions, templates); err != nil {
+		return nil, err
+	}
+	schedules, err := compileSchedules(cfg.Scheduler, definitions)
+	if err != nil {
+		return nil, err
+	}
+	return &runtimeState{
+		config:      cfg,
+		sors:        newSoRClients(cfg),
+		definitions: definitions,
+		templates:   templates,
+		schedules:   schedules,
+		loadedAt:    time.Now(),
+	}, nil
+}
+
+// stepHandler executes one step type. It returns the details recorded in the
+// step's success audit entry; nil details means the step is not audited.
+type stepHandler func(s *BPOService, ctx context.Context, run *workflowRun, step StepDefinition) (map[string]interface{}, error)
+
+// stepTypes maps definition step types to their implementation
+var stepTypes map[string]stepHandler
+
+// stepValidators check a step's `with` block when definitions are loaded,
+// for step types that take configuration
+var stepValidators map[string]func(StepDefinition) error
+
+func init() {
+	stepTypes = map[string]stepHandler{
+		"generate_template_plan": (*BPOService).stepGenerateTemplatePlan,
+		"consult_plm":            (*BPOService).stepConsultPLM,
+		"build_document_plan":    (*BPOService).stepBuildDocumentPlan,
+		"validate_document_plan": (*BPOService).stepValidateDocumentPlan,
+		"command_docgen":         (*BPOService).stepCommandDocGen,
+		"wait_for_approval":      (*BPOService).stepWaitForApproval,
+		"parallel":               (*BPOService).stepParallel,
+		"add_test_block":         (*BPOService).stepAddTestBlock,
+		"delete_document":        (*BPOService).stepDeleteDocument,
+		"notify_plm":             (*BPOService).stepNotifyPLM,
+	}
+	stepValidators = map[string]func(StepDefinition) error{
+		"build_document_plan": validateDocumentPlanStep,
+		"add_test_block":      validateTestBlockStep,
+		"notify_plm":          validateNotifyStep,
+		"wait_for_approval":   validateApprovalStep,
+		"parallel":            validateParallelStep,
+	}
+}
+
+// suspension is returned by a step that pauses its run until an external
+// decision resumes it. The suspending step is not yet complete.
+type suspension struct {
+	Status  string
+	Message string
+}
+
+func (e *suspension) Error() string {
+	return e.Message
+}
+
+// decodeWith decodes a step's `with` block into a typed configuration,
+// rejecting unknown keys
+func decodeWith(step StepDefinition, out interface{}) error {
+	data, err := yaml.Marshal(step.With)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// knownStepTypes lists the registered step types in order
+func knownStepTypes() []string {
+	types := make([]string, 0, len(stepTypes))
+	for t := range stepTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// workflowRun is a single execution of a workflow definition
+type workflowRun struct {
+	ID         string
+	Event      string
+	Definition *WorkflowDefinition
+	Inputs     map[string]string
+	Payload    map[string]interface{}
+	StartedAt  time.Time
+
+	state       *runtimeState
+	outputs     map[string]interface{}
+	documentURL string
+	// documents holds documents produced by parallel branches, by branch
+	documents map[string]string
+	// branchPath identifies the parallel branch this run copy executes
+	branchPath string
+	// compensations lists completed steps that declare how to undo them
+	compensations []compensation
+	// next is the index of the step to run when execution continues
+	next    int
+	started bool
+	// trace is set for dry runs, whose audit entries it collects instead
+	// of the audit trail
+	trace *dryRunTrace
+
+	// Guarded by BPOService.inflightMu
+	step        string
+	interrupted bool
+	// ctx is cancelled to stop the current execution of the run
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Guarded by BPOService.runsMu
+	status     string
+	err        string
+	finishedAt *time.Time
+	approval   *pendingApproval
+	// Set by admin operations; the execution acts on them between steps
+	cancelledBy      string
+	pauseRequestedBy string
+}
+
+// sor returns the client for a System of Record pinned to this run
+func (r *workflowRun) sor(name string) (*sorClient, error) {
+	client, ok := r.state.sors[name]
+	if !ok {
+		return nil, fmt.Errorf("SoR %q is not configured", name)
+	}
+	return client, nil
+}
+
+// newRun pins the latest non-deprecated definition for a trigger from the
+// current runtime snapshot and validates the payload against its inputs
+func (s *BPOService) newRun(event string, payload map[string]interface{}) (*workflowRun, error) {
+	state := s.current()
+
+	def, err := state.definitions.latest(event, s.isDeprecated)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs, err := def.resolveInputs(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &workflowRun{
+		ID:         s.generateWorkflowID(),
+		Event:      event,
+		Definition: def,
+		Inputs:     inputs,
+		Payload:    payload,
+		StartedAt:  time.Now(),
+		state:      state,
+		outputs:    make(map[string]interface{}),
+		documents:  make(map[string]string),
+		step:       "workflow_started",
+	}, nil
+}
+
+// auditRun writes an audit entry for a run, stamping the definition version
+func (s *BPOService) auditRun(run *workflowRun, action, status string, details map[string]interface{}, runErr error) {
+	if run.trace != nil {
+		entry := TraceEntry{
+			Timestamp: time.Now(),
+			Action:    action,
+			Status:    status,
+			Details:   details,
+			Branch:    run.branchPath,
+		}
+		if runErr != nil {
+			entry.Error = runErr.Error()
+		}
+		run.trace.add(entry)
+		return
+	}
+
+	entry := AuditEntry{
+		Timestamp:         time.Now(),
+		WorkflowID:        run.ID,
+		Event:             run.Event,
+		Action:            action,
+		Status:            status,
+		Details:           details,
+		Definition:        run.Definition.Name,
+		DefinitionVersion: run.Definition.Version,
+		Branch:            run.branchPath,
+	}
+	if runErr != nil {
+		entry.Error = runErr.Error()
+	}
+	if err := s.writeAuditEntry(entry); err != nil {
+		log.Printf("Failed to write audit entry: %v", err)
+	}
+}
+
+// executeRun runs the steps of the run's definition in order, starting at
+// run.next. It returns early with the suspension status when a step or an
+// admin pauses the run; the caller resumes it by calling again, after
+// advancing run.next past a suspending step.
+func (s *BPOService) executeRun(ctx context.Context, run *workflowRun) (*WorkflowResponse, error) {
+	if !run.started {
+		run.started = true
+		startDetails := make(map[string]interface{}, len(run.Inputs))
+		for name, value := range run.Inputs {
+			startDetails[name] = value
+		}
+		s.auditRun(run, "workflow_started", "success", startDetails, nil)
+	}
+
+	steps := run.Definition.Steps
+	for ; run.next < len(steps); run.next++ {
+		step := steps[run.next]
+		if response := s.pauseIfRequested(run, step.ID); response != nil {
+			return response, nil
+		}
+		if err := s.enterStep(ctx, run, step.ID); err != nil {
+			if cancelled := s.cancelledStep(run, step.ID, err); cancelled != nil {
+				return nil, cancelled
+			}
+			return nil, err
+		}
+
+		details, err := s.runStep(ctx, run, step)
+		var suspended *suspension
+		if errors.As(err, &suspended) {
+			s.setRunStatus(run, suspended.Status, nil)
+			return &WorkflowResponse{
+				Status:     suspended.Status,
+				WorkflowID: run.ID,
+				Message:    suspended.Message,
+			}, nil
+		}
+		if err != nil {
+			if cancelled := s.cancelledStep(run, step.ID, err); cancelled != nil {
+				return nil, cancelled
+			}
+			s.auditRun(run, step.ID, "failed", failureDetails(err), err)
+			err = fmt.Errorf("step %s failed: %w", step.ID, err)
+			// Compensations need the SoRs; skip them when shutdown cancelled
+			// the run. A dry run changed nothing, so has nothing to undo.
+			if ctx.Err() == nil && run.trace == nil {
+				err = s.compensate(ctx, run, err)
+			}
+			return nil, err
+		}
+		if details != nil {
+			s.auditRun(run, step.ID, "success", details, nil)
+		}
+	}
+
+	completedDetails := map[string]interface{}{
+		"final_document_url": run.documentURL,
+	}
+	if len(run.documents) > 0 {
+		completedDetails["documents"] = run.documents
+	}
+	s.auditRun(run, "workflow_completed", "success", completedDetails, nil)
+	s.setRunStatus(run, runCompleted, nil)
+
+	response := &WorkflowResponse{
+		Status:      "success",
+		WorkflowID:  run.ID,
+		Message:     "Workflow completed successfully",
+		DocumentURL: run.documentURL,
+	}
+	if len(run.documents) > 0 {
+		response.Documents = run.documents
+	}
+	return response, nil
+}
+
+// failureDetails returns what a failed step's audit entry records beyond
+// its error, such as the field-level errors of a rejected document plan
+func failureDetails(err error) map[string]interface{} {
+	var invalid *planInvalidError
+	if errors.As(err, &invalid) {
+		return invalid.details()
+	}
+	return nil
+}
+
+// runStep runs a single step if its condition holds. A skipped step is
+// audited here and returns nil details; the condition and its result are
+// added to the details of a step that runs. A dry run skips steps with side
+// effects in the same way. Completed steps that declare a compensation are
+// recorded so a later failure can undo them.
+func (s *BPOService) runStep(ctx context.Context, run *workflowRun, step StepDefinition) (map[string]interface{}, error) {
+	var condition map[string]interface{}
+	if step.When != "" {
+		result, err := evaluateCondition(step.When, run)
+		if err != nil {
+			return nil, fmt.Errorf("condition %q: %w", step.When, err)
+		}
+		if !result {
+			log.Printf("Workflow %s skipping %s: condition %q is false", run.ID, step.ID, step.When)
+			s.auditRun(run, step.ID, "skipped", map[string]interface{}{
+				"condition":        step.When,
+				"condition_result": false,
+			}, nil)
+			return nil, nil
+		}
+		condition = map[string]interface{}{
+			"condition":        step.When,
+			"condition_result": true,
+		}
+	}
+
+	if run.trace != nil && sideEffectSteps[step.Type] {
+		details := map[string]interface{}{
+			"reason": skippedInDryRun,
+			"type":   step.Type,
+		}
+		for key, value := range condition {
+			details[key] = value
+		}
+		s.auditRun(run, step.ID, "skipped", details, nil)
+		return nil, nil
+	}
+
+	details, err := stepTypes[step.Type](s, ctx, run, step)
+	if err != nil {
+		return nil, err
+	}
+	if step.Compensate != nil {
+		run.compensations = append(run.compensations, compensation{run: run, step: step})
+	}
+	if condition == nil {
+		return details, nil
+	}
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	for key, value := range condition {
+		details[key] = value
+	}
+	return details, nil
+}
+
+// enterStep records the step a workflow is about to run, refusing to start
+// it once the workflow has been cancelled by shutdown
+func (s *BPOService) enterStep(ctx context.Context, run *workflowRun, step string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("workflow interrupted before %s: %w", step, err)
+	}
+	s.setWorkflowStep(run, step)
+	return nil
+}
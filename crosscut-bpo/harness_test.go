@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"crosscut-contracts/bpo"
+)
+
+// harness runs the BPO against fake PLM and DocGen services (see
+// sors_test.go), each on its own httptest server in the test process, with
+// the audit trail in a temporary file. Failures can be injected into the
+// fakes' responses.
+type harness struct {
+	t *testing.T
+
+	service *BPOService
+	server  *http.Server
+	client  *bpo.Client
+
+	plm    *fakePLM
+	docgen *fakeDocGen
+	// faults sit in front of each SoR's router, by SoR name
+	faults map[string]*faultInjector
+
+	auditPath string
+}
+
+// newHarness starts the three services. configure, if given, adjusts the
+// BPO's configuration after environment overrides are applied, e.g. to
+// load definitions from a test directory.
+func newHarness(t *testing.T, configure ...func(*Config)) *harness {
+	t.Helper()
+	h := &harness{
+		t:         t,
+		plm:       newFakePLM(t),
+		docgen:    newFakeDocGen(),
+		auditPath: filepath.Join(t.TempDir(), "audit.json"),
+	}
+	h.faults = map[string]*faultInjector{
+		"plm":    {next: h.plm},
+		"docgen": {next: h.docgen},
+	}
+	plmServer := httptest.NewServer(h.faults["plm"])
+	docgenServer := httptest.NewServer(h.faults["docgen"])
+	t.Cleanup(plmServer.Close)
+	t.Cleanup(docgenServer.Close)
+
+	t.Setenv("PLM_SERVICE_URL", plmServer.URL)
+	t.Setenv("DOCGEN_SERVICE_URL", docgenServer.URL)
+	t.Setenv("AUDIT_BACKEND", auditBackendFile)
+	t.Setenv("AUDIT_LOG_PATH", h.auditPath)
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Retries back off briefly so injected failures do not slow tests down
+	cfg.Retry.InitialBackoff = Duration(10 * time.Millisecond)
+	cfg.Retry.MaxBackoff = Duration(50 * time.Millisecond)
+	for _, fn := range configure {
+		fn(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	h.service, err = NewBPOService(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCatalogue(h.service.current()); err != nil {
+		t.Fatal(err)
+	}
+	h.server = h.service.setupRoutes()
+	bpoServer := httptest.NewServer(h.server.Handler)
+	client, err := bpo.NewClient(bpoServer.URL, bpo.WithHTTPClient(bpoServer.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.client = client
+
+	// Cleanups run last in first out: in-flight workflows finish before
+	// the fakes go away
+	t.Cleanup(func() {
+		bpoServer.Close()
+		h.service.Shutdown(h.server, 5*time.Second)
+	})
+	return h
+}
+
+// newDefinitionsHarness starts the services with only the given workflow
+// definitions loaded
+func newDefinitionsHarness(t *testing.T, definitions ...string) *harness {
+	t.Helper()
+	dir := t.TempDir()
+	for i, definition := range definitions {
+		path := filepath.Join(dir, fmt.Sprintf("definition-%d.yaml", i))
+		if err := os.WriteFile(path, []byte(definition), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newHarness(t, func(cfg *Config) {
+		cfg.Workflows.DefinitionsDir = dir
+	})
+}
+
+// trigger fires a trigger event through the BPO API. A response outside
+// 2xx is returned as *bpo.Error.
+func (h *harness) trigger(event string, payload map[string]interface{}) (*bpo.WorkflowResponse, error) {
+	return bpo.Decode[bpo.WorkflowResponse](h.client.ExecuteWorkflow(context.Background(), nil, bpo.WorkflowRequest{
+		TriggerEvent: event,
+		Payload:      payload,
+	}))
+}
+
+// failedWorkflowID checks a trigger failed with a workflow error and
+// returns the ID of the failed workflow
+func failedWorkflowID(t *testing.T, err error) string {
+	t.Helper()
+	var apiErr *bpo.Error
+	if !errors.As(err, &apiErr) || apiErr.WorkflowID == "" {
+		t.Fatalf("error = %v, want a failed workflow", err)
+	}
+	return apiErr.WorkflowID
+}
+
+// dryRun simulates the workflow for a trigger event through the BPO API
+// and fails the test unless the request succeeds. The response tells
+// whether the simulated workflow would have succeeded.
+func (h *harness) dryRun(event string, payload map[string]interface{}) *bpo.WorkflowResponse {
+	h.t.Helper()
+	response, err := bpo.Decode[bpo.WorkflowResponse](h.client.ExecuteWorkflow(context.Background(), &bpo.ExecuteWorkflowParams{DryRun: true}, bpo.WorkflowRequest{
+		TriggerEvent: event,
+		Payload:      payload,
+	}))
+	if err != nil {
+		h.t.Fatalf("dry running %s: %v", event, err)
+	}
+	return response
+}
+
+// release triggers schematic.released for a product revision and fails
+// the test unless the request succeeds with a workflow ID
+func (h *harness) release(product, revision string) *bpo.WorkflowResponse {
+	h.t.Helper()
+	response, err := h.trigger("schematic.released", map[string]interface{}{
+		"product_name": product,
+		"revision":     revision,
+	})
+	if err != nil {
+		h.t.Fatalf("releasing %s rev %s: %v", product, revision, err)
+	}
+	return response
+}
+
+// createProduct adds a product to the fake PLM
+func (h *harness) createProduct(product plmProduct) {
+	h.plm.add(product)
+}
+
+// failRequests makes the next times requests to method and path on a SoR
+// fail with status, without reaching the fake. times <= 0 fails every
+// request for the rest of the test.
+func (h *harness) failRequests(sor, method, path string, status, times int) {
+	h.injector(sor).add(fault{method: method, path: path, status: status, remaining: times})
+}
+
+// hold makes requests to method and path on a SoR wait, without reaching
+// the fake, until the returned hold is released or the caller gives up
+func (h *harness) hold(sor, method, path string) *hold {
+	held := &hold{t: h.t, arrived: make(chan struct{}, 16), released: make(chan struct{})}
+	h.injector(sor).add(fault{method: method, path: path, hold: held})
+	h.t.Cleanup(held.release)
+	return held
+}
+
+// hold parks requests until released so a test can act while a workflow
+// is in the middle of a step
+type hold struct {
+	t        *testing.T
+	arrived  chan struct{}
+	released chan struct{}
+	once     sync.Once
+}
+
+// wait blocks until a request is being held
+func (hd *hold) wait() {
+	hd.t.Helper()
+	select {
+	case <-hd.arrived:
+	case <-time.After(5 * time.Second):
+		hd.t.Fatal("timed out waiting for a held request")
+	}
+}
+
+// release lets held and future requests through to the fake
+func (hd *hold) release() {
+	hd.once.Do(func() { close(hd.released) })
+}
+
+// triggerAsync fires a trigger event in the background; the returned
+// channel delivers the outcome once the workflow responds
+func (h *harness) triggerAsync(event string, payload map[string]interface{}) <-chan triggerResult {
+	done := make(chan triggerResult, 1)
+	go func() {
+		response, err := h.trigger(event, payload)
+		done <- triggerResult{response, err}
+	}()
+	return done
+}
+
+// triggerResult is the outcome of a trigger sent by triggerAsync
+type triggerResult struct {
+	response *bpo.WorkflowResponse
+	err      error
+}
+
+// await waits for a background trigger to respond
+func (h *harness) await(done <-chan triggerResult) triggerResult {
+	h.t.Helper()
+	select {
+	case result := <-done:
+		return result
+	case <-time.After(10 * time.Second):
+		h.t.Fatal("timed out waiting for the workflow to respond")
+		return triggerResult{}
+	}
+}
+
+// inflightID returns the ID of the only workflow in flight
+func (h *harness) inflightID() string {
+	h.t.Helper()
+	h.service.inflightMu.Lock()
+	defer h.service.inflightMu.Unlock()
+	if len(h.service.inflight) != 1 {
+		h.t.Fatalf("%d workflows in flight, want 1", len(h.service.inflight))
+	}
+	for id := range h.service.inflight {
+		return id
+	}
+	return ""
+}
+
+// eventually polls cond until it holds, failing the test after a few
+// seconds
+func (h *harness) eventually(what string, cond func() bool) {
+	h.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// requests returns how many requests to method and path a SoR received,
+// including those failed by an injected fault
+func (h *harness) requests(sor, method, path string) int {
+	return h.injector(sor).count(method, path)
+}
+
+func (h *harness) injector(sor string) *faultInjector {
+	h.t.Helper()
+	injector, ok := h.faults[sor]
+	if !ok {
+		h.t.Fatalf("unknown SoR %q", sor)
+	}
+	return injector
+}
+
+// auditLog returns every entry of the audit log. It reads under the
+// store's lock, since workflows in the background may be rewriting it.
+func (h *harness) auditLog() []AuditEntry {
+	h.t.Helper()
+	if store, ok := h.service.audit.(*fileAuditStore); ok {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+	}
+	data, err := os.ReadFile(h.auditPath)
+	if err != nil {
+		h.t.Fatalf("reading audit log: %v", err)
+	}
+	var all []AuditEntry
+	if err := json.Unmarshal(data, &all); err != nil {
+		h.t.Fatalf("decoding audit log: %v", err)
+	}
+	return all
+}
+
+// auditEntries returns the audit trail of a workflow, read from the audit
+// log
+func (h *harness) auditEntries(workflowID string) []AuditEntry {
+	h.t.Helper()
+	var entries []AuditEntry
+	for _, entry := range h.auditLog() {
+		if entry.WorkflowID == workflowID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// auditEntry returns a workflow's entry for action, failing the test if
+// there is none
+func (h *harness) auditEntry(workflowID, action string) AuditEntry {
+	h.t.Helper()
+	for _, entry := range h.auditEntries(workflowID) {
+		if entry.Action == action {
+			return entry
+		}
+	}
+	h.t.Fatalf("workflow %s has no %s audit entry", workflowID, action)
+	return AuditEntry{}
+}
+
+// assertAuditTrail checks a workflow's audit entries, in order, as
+// "action status" pairs such as "plm_consultation success"
+func (h *harness) assertAuditTrail(workflowID string, want ...string) {
+	h.t.Helper()
+	entries := h.auditEntries(workflowID)
+	got := make([]string, len(entries))
+	for i, entry := range entries {
+		got[i] = entry.Action + " " + entry.Status
+	}
+	h.assertSteps("audit trail of "+workflowID, got, want)
+}
+
+// assertTrace checks the trace of a dry run like assertAuditTrail
+func (h *harness) assertTrace(response *bpo.WorkflowResponse, want ...string) {
+	h.t.Helper()
+	got := make([]string, len(response.Trace))
+	for i, entry := range response.Trace {
+		got[i] = entry.Action + " " + entry.Status
+	}
+	h.assertSteps("trace of "+response.WorkflowID, got, want)
+}
+
+func (h *harness) assertSteps(what string, got, want []string) {
+	h.t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		h.t.Errorf("%s:\n  %s\nwant:\n  %s", what,
+			strings.Join(got, "\n  "), strings.Join(want, "\n  "))
+	}
+}
+
+// fault fails requests to one endpoint of a SoR. A hold delays the request
+// instead of failing it.
+type fault struct {
+	method string
+	path   string
+	status int
+	hold   *hold
+	// remaining is how many more requests fail; <= 0 means all of them
+	remaining int
+}
+
+// faultInjector sits in front of a fake SoR, failing requests that
+// match an injected fault and counting every request
+type faultInjector struct {
+	next http.Handler
+
+	mu     sync.Mutex
+	faults []*fault
+	counts map[string]int
+}
+
+func (f *faultInjector) add(injected fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, &injected)
+}
+
+func (f *faultInjector) count(method, path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.counts[method+" "+path]
+}
+
+// match counts a request and returns the fault it should fail with, if any
+func (f *faultInjector) match(r *http.Request) *fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.counts == nil {
+		f.counts = make(map[string]int)
+	}
+	f.counts[r.Method+" "+r.URL.Path]++
+
+	for i, injected := range f.faults {
+		if injected.method != r.Method || injected.path != r.URL.Path {
+			continue
+		}
+		if injected.remaining > 0 {
+			injected.remaining--
+			if injected.remaining == 0 {
+				f.faults = append(f.faults[:i], f.faults[i+1:]...)
+			}
+		}
+		matched := *injected
+		return &matched
+	}
+	return nil
+}
+
+func (f *faultInjector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	injected := f.match(r)
+	switch {
+	case injected == nil:
+		f.next.ServeHTTP(w, r)
+	case injected.hold != nil:
+		select {
+		case injected.hold.arrived <- struct{}{}:
+		default:
+		}
+		select {
+		case <-injected.hold.released:
+			f.next.ServeHTTP(w, r)
+		case <-r.Context().Done():
+		}
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(injected.status)
+		fmt.Fprintf(w, `{"error":"injected_failure","message":"%s %s failed by the test harness"}`, r.Method, r.URL.Path)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// readinessProbeTimeout bounds each individual dependency probe
+	readinessProbeTimeout = 2 * time.Second
+
+	// readinessSlowThreshold marks a reachable dependency as slow
+	readinessSlowThreshold = 500 * time.Millisecond
+)
+
+// Dependency probe outcomes
+const (
+	dependencyUp   = "up"
+	dependencySlow = "slow"
+	dependencyDown = "down"
+)
+
+// Overall readiness states
+const (
+	readinessReady    = "ready"
+	readinessDegraded = "degraded"
+	readinessNotReady = "not_ready"
+	readinessDraining = "draining"
+)
+
+// DependencyStatus reports the outcome of probing a single dependency
+type DependencyStatus struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Target    string `json:"target,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ReadinessResponse represents the response from the readiness endpoint
+type ReadinessResponse struct {
+	Status       string             `json:"status"`
+	Service      string             `json:"service"`
+	Version      string             `json:"version"`
+	CheckedAt    time.Time          `json:"checked_at"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// LivenessResponse represents the response from the liveness endpoint
+type LivenessResponse struct {
+	Status        string `json:"status"`
+	Service       string `json:"service"`
+	Version       string `json:"version"`
+	UptimeSeconds int    `json:"uptime_seconds"`
+}
+
+// probeAuditStore checks audit store writability
+func (s *BPOService) probeAuditStore() DependencyStatus {
+	start := time.Now()
+	status := DependencyStatus{
+		Name:   "audit_store",
+		Kind:   "audit",
+		Status: dependencyUp,
+		Target: s.audit.Target(),
+	}
+
+	if err := s.audit.Check(); err != nil {
+		status.Status = dependencyDown
+		status.Error = err.Error()
+	}
+	status.LatencyMs = time.Since(start).Milliseconds()
+
+	return status
+}
+
+// probeSoR calls the /health endpoint of a System of Record through the
+// same HTTP client workflows use, so its transport and timeout apply
+func (s *BPOService) probeSoR(ctx context.Context, sor *sorClient) DependencyStatus {
+	name := sor.name
+	status := DependencyStatus{
+		Name:   name,
+		Kind:   "sor",
+		Target: sor.baseURL + "/health",
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, status.Target, nil)
+		if err != nil {
+			return fmt.Errorf("failed to build health request: %w", err)
+		}
+
+		resp, err := sor.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to call %s health endpoint: %w", name, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s health endpoint returned %d", name, resp.StatusCode)
+		}
+
+		var body struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.Status != "" && body.Status != "healthy" {
+			return fmt.Errorf("%s reports status %q", name, body.Status)
+		}
+		return nil
+	}()
+	latency := time.Since(start)
+	status.LatencyMs = latency.Milliseconds()
+
+	switch {
+	case err != nil:
+		status.Status = dependencyDown
+		status.Error = err.Error()
+	case latency > readinessSlowThreshold:
+		status.Status = dependencySlow
+	default:
+		status.Status = dependencyUp
+	}
+
+	return status
+}
+
+// checkReadiness probes every dependency concurrently and aggregates the result.
+// Any dependency that is down makes the service not ready; a slow dependency
+// leaves it serving in a degraded state.
+func (s *BPOService) checkReadiness(ctx context.Context) ReadinessResponse {
+	dependencies := []DependencyStatus{s.probeAuditStore()}
+
+	sors := s.current().sors
+	names := make([]string, 0, len(sors))
+	for name := range sors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]DependencyStatus, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = s.probeSoR(ctx, sors[name])
+		}(i, name)
+	}
+	wg.Wait()
+	dependencies = append(dependencies, results...)
+
+	overall := readinessReady
+	if s.isDraining() {
+		overall = readinessDraining
+	}
+	for _, dep := range dependencies {
+		if overall == readinessDraining {
+			break
+		}
+		if dep.Status == dependencyDown {
+			overall = readinessNotReady
+			break
+		}
+		if dep.Status == dependencySlow {
+			overall = readinessDegraded
+		}
+	}
+
+	return ReadinessResponse{
+		Status:       overall,
+		Service:      "crosscut-bpo",
+		Version:      serviceVersion,
+		CheckedAt:    time.Now(),
+		Dependencies: dependencies,
+	}
+}
+
+// handleLivez reports whether the process is alive; it never consults dependencies
+func (s *BPOService) handleLivez(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(LivenessResponse{
+		Status:        "healthy",
+		Service:       "crosscut-bpo",
+		Version:       serviceVersion,
+		UptimeSeconds: int(time.Since(s.startTime).Seconds()),
+	})
+}
+
+// handleReadyz reports whether the service can currently execute workflows
+func (s *BPOService) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	response := s.checkReadiness(r.Context())
+	if response.Status == readinessNotReady || response.Status == readinessDraining {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"crosscut-contracts/bpo"
+)
+
+func TestAuditCheckDoesNotCreateLog(t *testing.T) {
+	dir := t.TempDir()
+	store := &fileAuditStore{path: filepath.Join(dir, "audit.json")}
+
+	if err := store.Check(); err != nil {
+		t.Fatalf("checking a missing log in a writable directory: %v", err)
+	}
+	if _, err := os.Stat(store.path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Check created the audit log (stat: %v)", err)
+	}
+
+	if err := store.Append(AuditEntry{Action: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Check(); err != nil {
+		t.Fatalf("checking an existing log: %v", err)
+	}
+	after, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Errorf("Check modified the audit log")
+	}
+	// The probe file is removed again
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("audit directory holds %v (%v), want only the log", entries, err)
+	}
+}
+
+func TestAuditCheckFailsWithoutDirectory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		filepath.Join(t.TempDir(), "missing", "audit.json"),
+		filepath.Join(file, "audit.json"),
+	} {
+		store := &fileAuditStore{path: path}
+		if err := store.Check(); err == nil {
+			t.Errorf("Check(%s) succeeded", path)
+		}
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	ready, err := bpo.Decode[bpo.ReadinessResponse](h.client.GetReadyz(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready.Status != readinessReady {
+		t.Errorf("status = %s, want %s: %+v", ready.Status, readinessReady, ready.Dependencies)
+	}
+	if _, err := os.Stat(h.auditPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("readiness probe created the audit log (stat: %v)", err)
+	}
+
+	// A SoR that is down makes the service not ready but leaves it alive
+	h.failRequests("plm", http.MethodGet, "/health", http.StatusServiceUnavailable, 0)
+	_, err = bpo.Decode[bpo.ReadinessResponse](h.client.GetReadyz(ctx))
+	var apiErr *bpo.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("readiness with PLM down: got %v, want 503", err)
+	}
+	readiness := h.service.checkReadiness(ctx)
+	if readiness.Status != readinessNotReady {
+		t.Errorf("status = %s, want %s", readiness.Status, readinessNotReady)
+	}
+	for _, dep := range readiness.Dependencies {
+		want := dependencyUp
+		if dep.Name == "plm" {
+			want = dependencyDown
+		}
+		if dep.Status != want {
+			t.Errorf("%s is %s, want %s", dep.Name, dep.Status, want)
+		}
+	}
+	live, err := bpo.Decode[bpo.LivenessResponse](h.client.GetLivez(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live.Status != "healthy" {
+		t.Errorf("liveness status = %s, want healthy", live.Status)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestReadinessProbesThroughSoRClient(t *testing.T) {
+	h := newHarness(t)
+
+	plm := h.service.current().sors["plm"]
+	transport := plm.client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	var probed []string
+	client := *plm.client
+	client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		probed = append(probed, req.URL.Path)
+		return transport.RoundTrip(req)
+	})
+	probe := *plm
+	probe.client = &client
+
+	status := h.service.probeSoR(context.Background(), &probe)
+	if status.Status != dependencyUp {
+		t.Errorf("status = %s, want %s: %s", status.Status, dependencyUp, status.Error)
+	}
+	if len(probed) != 1 || probed[0] != "/health" {
+		t.Errorf("SoR client made requests %v, want [/health]", probed)
+	}
+}
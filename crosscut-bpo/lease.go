@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// lease elects the replica that fires schedules. Replicas share a lock
+// file; whoever holds an exclusive lock on it leads until the process
+// exits, at which point the operating system releases the lock and another
+// replica takes over.
+type lease struct {
+	path string
+	// identity names this replica in the lock file
+	identity string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// newLease creates a lease on path. An empty path makes this replica the
+// leader unconditionally.
+func newLease(path string) *lease {
+	host, _ := os.Hostname()
+	return &lease{
+		path:     path,
+		identity: fmt.Sprintf("%s/%d", host, os.Getpid()),
+	}
+}
+
+// acquire takes the lease if no other replica holds it
+func (l *lease) acquire() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.path == "" || l.file != nil {
+		return true, nil
+	}
+
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// Record the holder so other replicas can report who leads
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(fmt.Sprintf("%s since %s\n", l.identity, time.Now().UTC().Format(time.RFC3339))), 0)
+	}
+	l.file = file
+	return true, nil
+}
+
+// holder describes the replica holding the lease
+func (l *lease) holder() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.path == "" || l.file != nil {
+		return l.identity
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// release gives the lease up so another replica can take over at once
+func (l *lease) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	l.file.Close()
+	l.file = nil
+}
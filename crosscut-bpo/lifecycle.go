@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// interruptGrace is how long shutdown waits for cancelled workflows to
+// unwind and record their own interruption before doing it on their behalf
+const interruptGrace = 2 * time.Second
+
+// errShuttingDown is returned when a workflow is refused because the
+// service is draining
+var errShuttingDown = errors.New("service is shutting down")
+
+// errRunBusy is returned when a run is already executing, e.g. a decision
+// arrives while the run is still unwinding from its suspension
+var errRunBusy = errors.New("workflow is already executing")
+
+// beginWorkflow registers a run as in flight. It fails once the service
+// has started draining so no new work is taken on.
+func (s *BPOService) beginWorkflow(run *workflowRun) error {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+
+	if s.draining {
+		return errShuttingDown
+	}
+	if _, ok := s.inflight[run.ID]; ok {
+		return errRunBusy
+	}
+
+	run.ctx, run.cancel = context.WithCancel(s.workflowCtx)
+	s.inflight[run.ID] = run
+	s.inflightWG.Add(1)
+	return nil
+}
+
+// setWorkflowStep records the step an in-flight run is executing
+func (s *BPOService) setWorkflowStep(run *workflowRun, step string) {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+	run.step = step
+}
+
+// endWorkflow removes a run from the in-flight set and records a failed
+// run's status. If the run ended because shutdown cancelled it, the
+// interruption is audited; cancellation by an admin was audited when it was
+// requested.
+func (s *BPOService) endWorkflow(run *workflowRun, err error) {
+	s.inflightMu.Lock()
+	_, ok := s.inflight[run.ID]
+	delete(s.inflight, run.ID)
+	if ok {
+		run.cancel()
+	}
+	s.inflightMu.Unlock()
+
+	if !ok {
+		return
+	}
+	defer s.inflightWG.Done()
+
+	s.runsMu.Lock()
+	cancelledBy := run.cancelledBy
+	s.runsMu.Unlock()
+
+	switch {
+	case err == nil:
+	case s.workflowCtx.Err() != nil:
+		s.markInterrupted(run)
+	case cancelledBy != "":
+		s.setRunStatus(run, runCancelled, fmt.Errorf("cancelled by %s", cancelledBy))
+	default:
+		s.setRunStatus(run, runFailed, err)
+	}
+}
+
+// markInterrupted writes the interruption audit entry for a run once
+func (s *BPOService) markInterrupted(run *workflowRun) {
+	s.inflightMu.Lock()
+	if run.interrupted {
+		s.inflightMu.Unlock()
+		return
+	}
+	run.interrupted = true
+	step := run.step
+	s.inflightMu.Unlock()
+
+	s.runsMu.Lock()
+	if run.status == runQueued {
+		step = runQueued
+	}
+	s.runsMu.Unlock()
+
+	log.Printf("Workflow %s interrupted during %s", run.ID, step)
+	s.auditRun(run, "workflow_interrupted", "interrupted", map[string]interface{}{
+		"last_step":  step,
+		"started_at": run.StartedAt,
+		"reason":     "service shutdown",
+	}, nil)
+	s.setRunStatus(run, runInterrupted, nil)
+}
+
+// waitInflight blocks until all in-flight workflows finish or ctx is done.
+// It reports whether the workflows drained.
+func (s *BPOService) waitInflight(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		s.inflightWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// isDraining reports whether shutdown has begun
+func (s *BPOService) isDraining() bool {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+	return s.draining
+}
+
+// Shutdown stops intake, waits up to timeout for in-flight workflows and
+// marks anything still unfinished as interrupted in the audit trail
+func (s *BPOService) Shutdown(server *http.Server, timeout time.Duration) {
+	s.inflightMu.Lock()
+	s.draining = true
+	pending := len(s.inflight)
+	s.inflightMu.Unlock()
+
+	// Queued batch items can no longer start
+	s.interruptQueuedRuns()
+
+	// Suspended runs cannot be resumed once the process exits
+	defer s.interruptSuspendedRuns()
+
+	log.Printf("Draining %d in-flight workflow(s), deadline %s", pending, timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Stop accepting connections and wait for open requests to finish
+	if err := server.Shutdown(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("HTTP server shutdown error: %v", err)
+	}
+
+	if s.waitInflight(ctx) {
+		log.Printf("All in-flight workflows finished")
+		return
+	}
+
+	log.Printf("Shutdown deadline reached, cancelling remaining workflows")
+	s.cancelWorkflows()
+
+	graceCtx, graceCancel := context.WithTimeout(context.Background(), interruptGrace)
+	defer graceCancel()
+	if s.waitInflight(graceCtx) {
+		return
+	}
+
+	// Workflows that did not unwind in time are recorded on their behalf
+	s.inflightMu.Lock()
+	remaining := make([]*workflowRun, 0, len(s.inflight))
+	for _, run := range s.inflight {
+		remaining = append(remaining, run)
+	}
+	s.inflightMu.Unlock()
+
+	for _, run := range remaining {
+		s.markInterrupted(run)
+	}
+}
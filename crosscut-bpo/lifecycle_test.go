@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"crosscut-contracts/bpo"
+)
+
+var routerRelease = map[string]interface{}{"product_name": "ROUTER-100", "revision": "C"}
+
+func TestShutdownDrainsInflightWorkflows(t *testing.T) {
+	h := newHarness(t)
+	held := h.hold("docgen", http.MethodPost, "/generate")
+	done := h.triggerAsync("schematic.released", routerRelease)
+	held.wait()
+	id := h.inflightID()
+
+	stopped := make(chan struct{})
+	go func() {
+		h.service.Shutdown(h.server, 5*time.Second)
+		close(stopped)
+	}()
+	h.eventually("draining to start", h.service.isDraining)
+
+	// No new work is taken on while draining
+	_, err := h.trigger("schematic.released", routerRelease)
+	var apiErr *bpo.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Code != "shutting_down" {
+		t.Errorf("trigger while draining: error = %v, want 503 shutting_down", err)
+	}
+	if readiness := h.service.checkReadiness(context.Background()); readiness.Status != readinessDraining {
+		t.Errorf("readiness = %s, want %s", readiness.Status, readinessDraining)
+	}
+	select {
+	case <-stopped:
+		t.Fatal("shutdown finished before the in-flight workflow")
+	default:
+	}
+
+	held.release()
+	result := h.await(done)
+	if result.err != nil || result.response.Status != "success" || result.response.WorkflowID != id {
+		t.Fatalf("in-flight workflow = %+v, %v; want it to complete", result.response, result.err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not finish once the workflow drained")
+	}
+	h.assertAuditTrail(id,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"high_voltage_safety skipped",
+		"document_plan_validated success",
+		"docgen_command success",
+		"workflow_completed success",
+	)
+}
+
+func TestShutdownInterruptsWorkflowsPastDeadline(t *testing.T) {
+	h := newHarness(t)
+	held := h.hold("docgen", http.MethodPost, "/generate")
+	done := h.triggerAsync("schematic.released", routerRelease)
+	held.wait()
+	id := h.inflightID()
+
+	h.service.Shutdown(h.server, 50*time.Millisecond)
+
+	var apiErr *bpo.Error
+	if result := h.await(done); !errors.As(result.err, &apiErr) || apiErr.WorkflowID != id {
+		t.Fatalf("interrupted workflow = %+v, %v; want an error", result.response, result.err)
+	}
+	h.assertAuditTrail(id,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"high_voltage_safety skipped",
+		"document_plan_validated success",
+		"docgen_command failed",
+		"workflow_interrupted interrupted",
+	)
+	if step := h.auditEntry(id, "workflow_interrupted").Details["last_step"]; step != "docgen_command" {
+		t.Errorf("interrupted during %v, want docgen_command", step)
+	}
+	status, err := bpo.Decode[bpo.WorkflowStatus](h.client.GetWorkflow(context.Background(), id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != runInterrupted {
+		t.Errorf("status = %s, want %s", status.Status, runInterrupted)
+	}
+}
+
+func TestShutdownInterruptsQueuedBatchItems(t *testing.T) {
+	h := newHarness(t)
+	held := h.hold("docgen", http.MethodPost, "/generate")
+
+	requests := make([]bpo.WorkflowRequest, 3)
+	for i := range requests {
+		requests[i] = bpo.WorkflowRequest{TriggerEvent: "schematic.released", Payload: routerRelease}
+	}
+	submitted, err := bpo.Decode[bpo.BatchStatus](h.client.ExecuteBatch(context.Background(), bpo.BatchRequest{Requests: requests, Concurrency: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	held.wait()
+	running := submitted.Items[0].WorkflowID
+
+	stopped := make(chan struct{})
+	go func() {
+		h.service.Shutdown(h.server, 5*time.Second)
+		close(stopped)
+	}()
+
+	// Queued items will never start, so they are interrupted while the
+	// running one drains
+	h.eventually("queued items to be interrupted", func() bool {
+		counts := h.batchStatus(submitted.BatchID).Counts
+		return counts[runRunning] == 1 && counts[runInterrupted] == 2
+	})
+	held.release()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not finish once the running item drained")
+	}
+
+	if status := h.status(running); status.Status != runCompleted {
+		t.Errorf("running item is %s, want %s", status.Status, runCompleted)
+	}
+	for _, item := range submitted.Items[1:] {
+		h.assertAuditTrail(item.WorkflowID, "workflow_interrupted interrupted")
+		if step := h.auditEntry(item.WorkflowID, "workflow_interrupted").Details["last_step"]; step != runQueued {
+			t.Errorf("queued item %d interrupted during %v, want %s", item.Index, step, runQueued)
+		}
+	}
+
+	// The slot the finished item frees is not handed to a queued one
+	time.Sleep(50 * time.Millisecond)
+	if generating := h.requests("docgen", http.MethodPost, "/generate"); generating != 1 {
+		t.Errorf("DocGen received %d generate requests, want 1", generating)
+	}
+	if counts := h.batchStatus(submitted.BatchID).Counts; counts[runCompleted] != 1 || counts[runInterrupted] != 2 {
+		t.Errorf("counts = %v, want 1 completed and 2 interrupted", counts)
+	}
+}
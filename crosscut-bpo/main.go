@@ -1,20 +1,31 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"crosscut-contracts"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
+// serviceVersion is reported by the health endpoints
+const serviceVersion = "1.0.0"
+
 // WorkflowRequest represents an incoming workflow trigger
 type WorkflowRequest struct {
 	TriggerEvent string                 `json:"trigger_event"`
@@ -27,6 +38,16 @@ type WorkflowResponse struct {
 	WorkflowID  string `json:"workflow_id"`
 	Message     string `json:"message"`
 	DocumentURL string `json:"document_url,omitempty"`
+	// Documents lists every document produced by parallel branches, keyed
+	// by branch
+	Documents map[string]string `json:"documents,omitempty"`
+	// ValidationErrors lists why DocGen rejected the document plan
+	ValidationErrors []ValidationError `json:"validation_errors,omitempty"`
+
+	// Set for dry runs: the plan that was built and what each step did
+	DryRun       bool          `json:"dry_run,omitempty"`
+	DocumentPlan *DocumentPlan `json:"document_plan,omitempty"`
+	Trace        []TraceEntry  `json:"trace,omitempty"`
 }
 
 // AuditEntry represents an entry in the audit log
@@ -38,121 +59,165 @@ type AuditEntry struct {
 	Status      string                 `json:"status"`
 	Details     map[string]interface{} `json:"details,omitempty"`
 	Error       string                 `json:"error,omitempty"`
-}
-
-// TemplatePlan represents a document plan template
-type TemplatePlan struct {
-	Product    string               `json:"product"`
-	Components []ComponentTemplate  `json:"components"`
-}
 
-// ComponentTemplate represents a component template needing enrichment
-type ComponentTemplate struct {
-	Name    string `json:"name"`
-	Voltage string `json:"voltage"`
+	// Definition and DefinitionVersion identify the workflow definition the
+	// entry was produced under
+	Definition        string `json:"definition,omitempty"`
+	DefinitionVersion int    `json:"definition_version,omitempty"`
+	// Branch names the parallel branch that produced the entry
+	Branch string `json:"branch,omitempty"`
 }
 
-// EnrichedPlan represents the enriched plan from PLM
-type EnrichedPlan struct {
-	Product    string               `json:"product"`
-	Components []EnrichedComponent  `json:"components"`
-}
-
-// EnrichedComponent represents a component with resolved voltage
-type EnrichedComponent struct {
-	Name    string `json:"name"`
-	Voltage string `json:"voltage"`
-}
+// Wire types exchanged with PLM and DocGen, shared through the contracts
+// module so the three services cannot drift apart
+type (
+	TemplatePlan       = contracts.TemplatePlan
+	ComponentTemplate  = contracts.ComponentTemplate
+	ProductComponents  = contracts.ProductComponents
+	ProductComponent   = contracts.ProductComponent
+	ProductRevision    = contracts.ProductRevision
+	EnrichedPlan       = contracts.EnrichedPlan
+	EnrichedComponent  = contracts.EnrichedComponent
+	DocumentPlan       = contracts.DocumentPlan
+	DocProps           = contracts.DocProps
+	ComponentInstance  = contracts.ComponentInstance
+	DocGenResponse     = contracts.GenerateResponse
+	ValidationResponse = contracts.ValidationResponse
+	ValidationError    = contracts.ValidationError
+)
 
-// DocumentPlan represents the final document plan for DocGen
-type DocumentPlan struct {
-	DocProps *DocProps           `json:"doc_props,omitempty"`
-	Body     []ComponentInstance `json:"body"`
+// BPOService handles business process orchestration
+type BPOService struct {
+	configPath  string
+	state       atomic.Pointer[runtimeState]
+	audit       AuditStore
+	startTime   time.Time
+	workflowSeq atomic.Uint64
+
+	// In-flight workflow tracking for graceful shutdown
+	inflightMu      sync.Mutex
+	inflight        map[string]*workflowRun
+	inflightWG      sync.WaitGroup
+	draining        bool
+	workflowCtx     context.Context
+	cancelWorkflows context.CancelFunc
+
+	// Runs by ID, kept while suspended and for a while after finishing
+	runsMu   sync.Mutex
+	runs     map[string]*workflowRun
+	finished []string
+
+	// Definition versions deprecated through the admin API
+	deprecatedMu sync.Mutex
+	deprecated   map[definitionKey]bool
+
+	// Time-based triggers, fired by the replica holding the lease
+	scheduler *scheduler
+
+	// Batches of triggers submitted together
+	batches batchRegistry
+
+	// OpenAPI document requests are validated against
+	api *apiSpec
 }
 
-// DocProps represents document metadata
-type DocProps struct {
-	Filename string `json:"filename,omitempty"`
-}
+// NewBPOService creates a new BPO service instance from a validated config.
+// configPath is re-read on reload; it may be empty.
+func NewBPOService(cfg *Config, configPath string) (*BPOService, error) {
+	audit, err := newAuditStore(cfg.Audit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit store: %w", err)
+	}
 
-// ComponentInstance represents a component instance in the document
-type ComponentInstance struct {
-	Component string                 `json:"component"`
-	Props     map[string]interface{} `json:"props"`
-}
+	state, err := newRuntimeState(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-// DocGenResponse represents response from DocGen service
-type DocGenResponse struct {
-	Status             string `json:"status"`
-	URL                string `json:"url"`
-	Filename           string `json:"filename"`
-	GenerationTimeMs   int    `json:"generation_time_ms"`
-	ComponentsRendered int    `json:"components_rendered"`
-}
+	api, err := loadAPISpec()
+	if err != nil {
+		return nil, err
+	}
 
-// BPOService handles business process orchestration
-type BPOService struct {
-	auditLogPath      string
-	plmServiceURL     string
-	docgenServiceURL  string
+	workflowCtx, cancelWorkflows := context.WithCancel(context.Background())
+	service := &BPOService{
+		configPath:      configPath,
+		audit:           audit,
+		startTime:       time.Now(),
+		inflight:        make(map[string]*workflowRun),
+		runs:            make(map[string]*workflowRun),
+		deprecated:      make(map[definitionKey]bool),
+		scheduler:       newScheduler(cfg.Scheduler),
+		batches:         batchRegistry{byID: make(map[string]*batch)},
+		api:             api,
+		workflowCtx:     workflowCtx,
+		cancelWorkflows: cancelWorkflows,
+	}
+	service.state.Store(state)
+	return service, nil
 }
 
-// NewBPOService creates a new BPO service instance
-func NewBPOService(auditLogPath, plmServiceURL, docgenServiceURL string) *BPOService {
-	return &BPOService{
-		auditLogPath:     auditLogPath,
-		plmServiceURL:    plmServiceURL,
-		docgenServiceURL: docgenServiceURL,
-	}
+// current returns the runtime snapshot used for newly triggered workflows
+func (s *BPOService) current() *runtimeState {
+	return s.state.Load()
 }
 
-// generateWorkflowID generates a unique workflow ID
+// generateWorkflowID generates a unique workflow ID. The sequence suffix keeps
+// IDs distinct for workflows triggered within the same second.
 func (s *BPOService) generateWorkflowID() string {
-	return fmt.Sprintf("wf-%d", time.Now().Unix())
+	return fmt.Sprintf("wf-%d-%d", time.Now().Unix(), s.workflowSeq.Add(1))
 }
 
-// writeAuditEntry writes an entry to the audit log
+// writeAuditEntry writes an entry to the audit trail
 func (s *BPOService) writeAuditEntry(entry AuditEntry) error {
-	absPath, err := filepath.Abs(s.auditLogPath)
+	return s.audit.Append(entry)
+}
+
+// listComponents asks the PLM service which test components a product has
+// in a revision, or in its current revision if revision is empty
+func listComponents(ctx context.Context, plm *sorClient, product, revision string) (*ProductComponents, error) {
+	path := "/products/" + url.PathEscape(product) + "/components"
+	if revision != "" {
+		path = "/products/" + url.PathEscape(product) + "/revisions/" + url.PathEscape(revision)
+	}
+	resp, err := plm.get(ctx, path)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+		return nil, fmt.Errorf("failed to call PLM service: %w", err)
 	}
+	defer resp.Body.Close()
 
-	// Read existing entries
-	var entries []AuditEntry
-	if data, err := os.ReadFile(absPath); err == nil && len(data) > 0 {
-		if err := json.Unmarshal(data, &entries); err != nil {
-			log.Printf("Warning: failed to unmarshal existing audit log: %v", err)
-			entries = []AuditEntry{} // Start fresh if corrupted
-		}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("PLM service returned %d: %s", resp.StatusCode, string(body))
 	}
 
-	// Append new entry
-	entries = append(entries, entry)
-
-	// Write back to file
-	data, err := json.MarshalIndent(entries, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal audit entries: %w", err)
+	if revision == "" {
+		var components ProductComponents
+		if err := json.NewDecoder(resp.Body).Decode(&components); err != nil {
+			return nil, fmt.Errorf("failed to decode PLM response: %w", err)
+		}
+		return &components, nil
 	}
 
-	if err := os.WriteFile(absPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write audit log: %w", err)
+	var rev ProductRevision
+	if err := json.NewDecoder(resp.Body).Decode(&rev); err != nil {
+		return nil, fmt.Errorf("failed to decode PLM response: %w", err)
 	}
-
-	return nil
+	return &ProductComponents{
+		Product:    rev.Product,
+		Revision:   rev.Revision,
+		Components: rev.Components,
+	}, nil
 }
 
 // consultPLM consults the PLM service for plan enrichment
-func (s *BPOService) consultPLM(template TemplatePlan) (*EnrichedPlan, error) {
-	url := s.plmServiceURL + "/enrich-plan"
-
+func consultPLM(ctx context.Context, plm *sorClient, template TemplatePlan) (*EnrichedPlan, error) {
 	jsonData, err := json.Marshal(template)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal template: %w", err)
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := plm.postJSON(ctx, "/enrich-plan", jsonData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call PLM service: %w", err)
 	}
@@ -172,15 +237,13 @@ func (s *BPOService) consultPLM(template TemplatePlan) (*EnrichedPlan, error) {
 }
 
 // commandDocGen commands the DocGen service to generate a document
-func (s *BPOService) commandDocGen(plan DocumentPlan) (*DocGenResponse, error) {
-	url := s.docgenServiceURL + "/generate"
-
+func commandDocGen(ctx context.Context, docgen *sorClient, plan DocumentPlan) (*DocGenResponse, error) {
 	jsonData, err := json.Marshal(plan)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal document plan: %w", err)
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := docgen.postJSON(ctx, "/generate", jsonData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call DocGen service: %w", err)
 	}
@@ -199,172 +262,95 @@ func (s *BPOService) commandDocGen(plan DocumentPlan) (*DocGenResponse, error) {
 	return &response, nil
 }
 
-// executeSchematicReleasedWorkflow executes the schematic released workflow
-func (s *BPOService) executeSchematicReleasedWorkflow(workflowID string, payload map[string]interface{}) (*WorkflowResponse, error) {
-	// Extract product information
-	productName, ok := payload["product_name"].(string)
-	if !ok {
-		return nil, fmt.Errorf("product_name is required in payload")
-	}
-
-	revision, ok := payload["revision"].(string)
-	if !ok {
-		revision = "A" // Default revision
-	}
-
-	// Step 1: Start workflow
-	if err := s.writeAuditEntry(AuditEntry{
-		Timestamp:  time.Now(),
-		WorkflowID: workflowID,
-		Event:      "schematic.released",
-		Action:     "workflow_started",
-		Status:     "success",
-		Details: map[string]interface{}{
-			"product_name": productName,
-			"revision":     revision,
-		},
-	}); err != nil {
-		log.Printf("Failed to write audit entry: %v", err)
-	}
-
-	// Step 2: Generate template plan
-	template := TemplatePlan{
-		Product: productName,
-		Components: []ComponentTemplate{
-			{
-				Name:    "PowerTest",
-				Voltage: "UNRESOLVED",
-			},
-		},
-	}
-
-	if err := s.writeAuditEntry(AuditEntry{
-		Timestamp:  time.Now(),
-		WorkflowID: workflowID,
-		Event:      "schematic.released",
-		Action:     "template_plan_generated",
-		Status:     "success",
-		Details: map[string]interface{}{
-			"template": template,
-		},
-	}); err != nil {
-		log.Printf("Failed to write audit entry: %v", err)
-	}
-
-	// Step 3: Consult PLM for enrichment
-	enriched, err := s.consultPLM(template)
+// validateDocumentPlan asks the DocGen service whether it would accept a
+// document plan. A rejected plan is a valid response, not an error.
+func validateDocumentPlan(ctx context.Context, docgen *sorClient, plan DocumentPlan) (*ValidationResponse, error) {
+	jsonData, err := json.Marshal(plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal document plan: %w", err)
+	}
+
+	resp, err := docgen.postJSON(ctx, "/validate-plan", jsonData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call DocGen service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		auditErr := s.writeAuditEntry(AuditEntry{
-			Timestamp:  time.Now(),
-			WorkflowID: workflowID,
-			Event:      "schematic.released",
-			Action:     "plm_consultation",
-			Status:     "failed",
-			Error:      err.Error(),
+		return nil, fmt.Errorf("failed to read DocGen response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return nil, fmt.Errorf("DocGen service returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var response ValidationResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode DocGen response: %w", err)
+	}
+	if resp.StatusCode == http.StatusBadRequest && response.Valid {
+		return nil, fmt.Errorf("DocGen service returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	return &response, nil
+}
+
+// writeJSON writes v as the JSON response body with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the standard error response body
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]string{
+		"error":   code,
+		"message": message,
+	})
+}
+
+// writeRunResult writes the outcome of executing a run. A run suspended
+// awaiting a decision is reported as 202 Accepted, and a run whose document
+// plan DocGen rejected as 422 with the validation errors.
+func writeRunResult(w http.ResponseWriter, run *workflowRun, response *WorkflowResponse, err error) {
+	if errors.Is(err, errRunCancelled) {
+		log.Printf("Workflow %s was cancelled: %v", run.ID, err)
+		writeJSON(w, http.StatusConflict, map[string]string{
+			"error":       "workflow_cancelled",
+			"message":     err.Error(),
+			"workflow_id": run.ID,
 		})
-		if auditErr != nil {
-			log.Printf("Failed to write audit entry: %v", auditErr)
-		}
-		return nil, fmt.Errorf("PLM consultation failed: %w", err)
-	}
-
-	if err := s.writeAuditEntry(AuditEntry{
-		Timestamp:  time.Now(),
-		WorkflowID: workflowID,
-		Event:      "schematic.released",
-		Action:     "plm_consultation",
-		Status:     "success",
-		Details: map[string]interface{}{
-			"enriched_plan": enriched,
-		},
-	}); err != nil {
-		log.Printf("Failed to write audit entry: %v", err)
-	}
-
-	// Step 4: Build document plan
-	filename := fmt.Sprintf("%s-DVT-Procedure-Rev-%s", productName, revision)
-
-	documentPlan := DocumentPlan{
-		DocProps: &DocProps{
-			Filename: filename,
-		},
-		Body: []ComponentInstance{
-			{
-				Component: "DocumentTitle",
-				Props: map[string]interface{}{
-					"document_title": "Design Verification Test Procedure",
-					"product_name":   productName,
-					"revision":       revision,
-				},
-			},
-		},
-	}
-
-	// Add TestBlock components from enriched plan
-	for _, comp := range enriched.Components {
-		documentPlan.Body = append(documentPlan.Body, ComponentInstance{
-			Component: "TestBlock",
-			Props: map[string]interface{}{
-				"test_name":    comp.Name,
-				"voltage":      comp.Voltage,
-				"product_name": productName,
-				"description":  "Validate power supply voltage requirements",
-			},
+		return
+	}
+	var invalid *planInvalidError
+	if errors.As(err, &invalid) {
+		log.Printf("Workflow %s failed: %v", run.ID, err)
+		writeJSON(w, http.StatusUnprocessableEntity, &WorkflowResponse{
+			Status:           "failed",
+			WorkflowID:       run.ID,
+			Message:          err.Error(),
+			ValidationErrors: invalid.Errors,
 		})
+		return
 	}
-
-	// Step 5: Command DocGen service
-	docGenResponse, err := s.commandDocGen(documentPlan)
 	if err != nil {
-		auditErr := s.writeAuditEntry(AuditEntry{
-			Timestamp:  time.Now(),
-			WorkflowID: workflowID,
-			Event:      "schematic.released",
-			Action:     "docgen_command",
-			Status:     "failed",
-			Error:      err.Error(),
+		log.Printf("Workflow execution failed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error":       "workflow_failed",
+			"message":     err.Error(),
+			"workflow_id": run.ID,
 		})
-		if auditErr != nil {
-			log.Printf("Failed to write audit entry: %v", auditErr)
-		}
-		return nil, fmt.Errorf("DocGen command failed: %w", err)
-	}
-
-	if err := s.writeAuditEntry(AuditEntry{
-		Timestamp:  time.Now(),
-		WorkflowID: workflowID,
-		Event:      "schematic.released",
-		Action:     "docgen_command",
-		Status:     "success",
-		Details: map[string]interface{}{
-			"document_url":        docGenResponse.URL,
-			"filename":           docGenResponse.Filename,
-			"generation_time_ms": docGenResponse.GenerationTimeMs,
-		},
-	}); err != nil {
-		log.Printf("Failed to write audit entry: %v", err)
-	}
-
-	// Step 6: Complete workflow
-	if err := s.writeAuditEntry(AuditEntry{
-		Timestamp:  time.Now(),
-		WorkflowID: workflowID,
-		Event:      "schematic.released",
-		Action:     "workflow_completed",
-		Status:     "success",
-		Details: map[string]interface{}{
-			"final_document_url": docGenResponse.URL,
-		},
-	}); err != nil {
-		log.Printf("Failed to write audit entry: %v", err)
-	}
-
-	return &WorkflowResponse{
-		Status:      "success",
-		WorkflowID:  workflowID,
-		Message:     "Workflow completed successfully",
-		DocumentURL: docGenResponse.URL,
-	}, nil
+		return
+	}
+
+	if response.Status != "success" {
+		log.Printf("Workflow %s is %s", run.ID, response.Status)
+		writeJSON(w, http.StatusAccepted, response)
+		return
+	}
+
+	log.Printf("Workflow %s completed successfully", run.ID)
+	writeJSON(w, http.StatusOK, response)
 }
 
 // setupRoutes configures the HTTP routes
@@ -376,18 +362,14 @@ func (s *BPOService) setupRoutes() *http.Server {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.SetHeader("Content-Type", "application/json"))
 
-	// Health check
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		response := map[string]interface{}{
-			"status":  "healthy",
-			"service": "crosscut-bpo",
-			"version": "1.0.0",
-		}
-		json.NewEncoder(w).Encode(response)
-	})
+	// Health checks: /health is kept as an alias of the liveness probe
+	r.Get("/health", s.handleLivez)
+	r.Get("/livez", s.handleLivez)
+	r.Get("/readyz", s.handleReadyz)
+	r.Get("/openapi.json", s.handleOpenAPI)
 
 	// Main workflow execution endpoint
-	r.Post("/v1/execute-workflow", func(w http.ResponseWriter, r *http.Request) {
+	r.With(s.authenticate, s.validateRequest).Post("/v1/execute-workflow", func(w http.ResponseWriter, r *http.Request) {
 		var request WorkflowRequest
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			log.Printf("Failed to decode request: %v", err)
@@ -399,19 +381,14 @@ func (s *BPOService) setupRoutes() *http.Server {
 			return
 		}
 
-		workflowID := s.generateWorkflowID()
-		log.Printf("Executing workflow %s for event: %s", workflowID, request.TriggerEvent)
-
-		var response *WorkflowResponse
-		var err error
-
-		switch request.TriggerEvent {
-		case "schematic.released":
-			response, err = s.executeSchematicReleasedWorkflow(workflowID, request.Payload)
-		default:
-			err = fmt.Errorf("unknown trigger event: %s", request.TriggerEvent)
+		// The spec has already checked dry_run is a boolean
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+		newRun := s.newRun
+		if dryRun {
+			newRun = s.newDryRun
 		}
 
+		run, err := newRun(request.TriggerEvent, request.Payload)
 		if err != nil {
 			log.Printf("Workflow execution failed: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -422,47 +399,146 @@ func (s *BPOService) setupRoutes() *http.Server {
 			return
 		}
 
-		log.Printf("Workflow %s completed successfully", workflowID)
-		json.NewEncoder(w).Encode(response)
+		if err := s.beginWorkflow(run); err != nil {
+			log.Printf("Rejecting workflow for event %s: %v", request.TriggerEvent, err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "shutting_down",
+				"message": err.Error(),
+			})
+			return
+		}
+		if dryRun {
+			log.Printf("Dry running workflow %s for event: %s (%s)", run.ID, request.TriggerEvent, run.Definition)
+			response, err := s.executeRun(run.ctx, run)
+			s.endWorkflow(run, err)
+			writeDryRunResult(w, run, response, err)
+			return
+		}
+		s.trackRun(run)
+		log.Printf("Executing workflow %s for event: %s (%s)", run.ID, request.TriggerEvent, run.Definition)
+
+		response, err := s.executeRun(run.ctx, run)
+		s.endWorkflow(run, err)
+		writeRunResult(w, run, response, err)
+	})
+
+	// Batches of triggers
+	r.With(s.authenticate, s.validateRequest).Post("/v1/execute-workflows:batch", s.handleExecuteBatch)
+	r.With(s.authenticate, s.validateRequest).Get("/v1/batches/{id}", s.handleGetBatch)
+
+	// Workflow runs
+	r.Route("/v1/workflows/{id}", func(r chi.Router) {
+		r.Use(s.authenticate, s.validateRequest)
+		r.Get("/", s.handleGetWorkflow)
+		r.Post("/approvals", s.handleApproval)
+	})
+
+	// Administration
+	r.Route("/v1/admin", func(r chi.Router) {
+		r.Use(s.authenticate, s.validateRequest)
+		r.Get("/workflow-definitions", s.handleListDefinitions)
+		r.Get("/workflow-definitions/{name}", s.handleGetDefinition)
+		r.Post("/workflow-definitions/{name}/versions/{version}/deprecation", s.handleDeprecateVersion)
+		r.Delete("/workflow-definitions/{name}/versions/{version}/deprecation", s.handleDeprecateVersion)
+		r.Post("/workflows/{id}/retry", s.handleRetryWorkflow)
+		r.Post("/workflows/{id}/cancel", s.handleCancelWorkflow)
+		r.Post("/workflows/{id}/pause", s.handlePauseWorkflow)
+		r.Post("/workflows/{id}/resume", s.handleResumeWorkflow)
+		r.Get("/schedules", s.handleListSchedules)
+		r.Get("/schedules/{name}", s.handleGetSchedule)
+		r.Post("/schedules/{name}/run", s.handleRunSchedule)
+		r.Post("/schedules/{name}/pause", s.handlePauseSchedule)
+		r.Delete("/schedules/{name}/pause", s.handlePauseSchedule)
 	})
 
+	cfg := s.current().config
 	return &http.Server{
-		Handler: r,
+		Addr:              cfg.Server.ListenAddr,
+		Handler:           r,
+		ReadHeaderTimeout: time.Duration(cfg.Timeouts.ReadHeader),
+		ReadTimeout:       time.Duration(cfg.Timeouts.Read),
+		WriteTimeout:      time.Duration(cfg.Timeouts.Write),
+		IdleTimeout:       time.Duration(cfg.Timeouts.Idle),
 	}
 }
 
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	configPath := flag.String("config", os.Getenv("CROSSCUT_CONFIG"), "path to the YAML configuration file")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flag.Parse()
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	auditLogPath := os.Getenv("AUDIT_LOG_PATH")
-	if auditLogPath == "" {
-		auditLogPath = "/app/data/audit-log.json"
+	if *printConfig {
+		out, err := cfg.Redacted().YAML()
+		if err != nil {
+			log.Fatalf("Failed to print configuration: %v", err)
+		}
+		fmt.Print(out)
+		return
 	}
 
-	plmServiceURL := os.Getenv("PLM_SERVICE_URL")
-	if plmServiceURL == "" {
-		plmServiceURL = "http://localhost:8081"
+	log.Printf("Starting CrossCut BPO Service on %s", cfg.Server.ListenAddr)
+	if *configPath != "" {
+		log.Printf("Config file: %s", *configPath)
+	}
+	log.Printf("Audit backend: %s (%s)", cfg.Audit.Backend, cfg.Audit.Path)
+	for _, name := range requiredSoRs {
+		log.Printf("%s service URL: %s", name, cfg.SoRs[name].URL)
 	}
 
-	docgenServiceURL := os.Getenv("DOCGEN_SERVICE_URL")
-	if docgenServiceURL == "" {
-		docgenServiceURL = "http://localhost:8082"
+	service, err := NewBPOService(cfg, *configPath)
+	if err != nil {
+		log.Fatalf("Failed to create BPO service: %v", err)
+	}
+	if err := verifyCatalogue(service.current()); err != nil {
+		log.Fatalf("Invalid test catalogue: %v", err)
+	}
+	for _, def := range service.current().definitions.definitions() {
+		log.Printf("Workflow %s handles %s (%s)", def, def.Trigger, def.Source)
 	}
+	for _, name := range service.current().templates.names() {
+		tmpl, _ := service.current().templates.find(name)
+		log.Printf("Document template %s (%s)", tmpl.Name, tmpl.Source)
+	}
+	for _, sc := range service.current().schedules {
+		log.Printf("Schedule %s fires %s on %q (%s)", sc.Name, sc.TriggerEvent, sc.Cron, sc.location)
+	}
+	server := service.setupRoutes()
 
-	log.Printf("Starting CrossCut BPO Service on port %s", port)
-	log.Printf("Audit log path: %s", auditLogPath)
-	log.Printf("PLM service URL: %s", plmServiceURL)
-	log.Printf("DocGen service URL: %s", docgenServiceURL)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	service := NewBPOService(auditLogPath, plmServiceURL, docgenServiceURL)
-	server := service.setupRoutes()
-	server.Addr = ":" + port
+	reloadCtx, stopReloader := context.WithCancel(context.Background())
+	defer stopReloader()
+	go service.runReloader(reloadCtx)
 
-	log.Printf("CrossCut BPO Service listening on :%s", port)
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
-	}
-}
\ No newline at end of file
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go service.runScheduler(schedulerCtx)
+
+	go func() {
+		log.Printf("CrossCut BPO Service listening on %s (TLS: %t)", server.Addr, cfg.Server.TLS.Enabled)
+		var err error
+		if cfg.Server.TLS.Enabled {
+			err = server.ListenAndServeTLS(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	stopReloader()
+	stopScheduler()
+	log.Printf("Shutdown signal received")
+	service.Shutdown(server, time.Duration(service.current().config.Timeouts.Shutdown))
+	log.Printf("CrossCut BPO Service stopped")
+}
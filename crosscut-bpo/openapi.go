@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"crosscut-contracts/bpo"
+	"crosscut-contracts/openapi"
+	"gopkg.in/yaml.v3"
+)
+
+// apiSpec is the BPO's OpenAPI document, served at /openapi.json and used
+// to validate requests before they reach a handler
+type apiSpec struct {
+	doc *openapi.Document
+	// json is the document as served
+	json []byte
+}
+
+// loadAPISpec parses the OpenAPI document shared through the contracts module
+func loadAPISpec() (*apiSpec, error) {
+	doc, err := openapi.Parse(bpo.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw interface{}
+	if err := yaml.Unmarshal(bpo.Spec, &raw); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert OpenAPI document to JSON: %w", err)
+	}
+	return &apiSpec{doc: doc, json: data}, nil
+}
+
+// handleOpenAPI serves the OpenAPI document
+func (s *BPOService) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.api.json)
+}
+
+// validateRequest rejects a request whose parameters or body do not match
+// the OpenAPI document with 400 and every problem found. Requests the
+// document does not describe are left for the router to refuse.
+func (s *BPOService) validateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, ok := s.api.doc.FindRoute(r.Method, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		err := s.api.doc.ValidateRequest(r, route, openapi.Options{})
+		var invalid *openapi.ValidationError
+		switch {
+		case errors.As(err, &invalid):
+			details := make([]ValidationError, len(invalid.Problems))
+			for i, problem := range invalid.Problems {
+				field, issue, _ := strings.Cut(problem, ": ")
+				details[i] = ValidationError{Field: field, Issue: issue}
+			}
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":   "invalid_request",
+				"message": fmt.Sprintf("Request does not match the API specification for %s %s", route.Method, route.Path),
+				"details": details,
+			})
+		case err != nil:
+			writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
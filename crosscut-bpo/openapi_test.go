@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"crosscut-contracts/openapi"
+	"github.com/go-chi/chi/v5"
+)
+
+// newTestService returns a BPO with the built-in definitions and an
+// in-memory audit store
+func newTestService(t *testing.T) *BPOService {
+	t.Helper()
+	t.Setenv("AUDIT_BACKEND", "memory")
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := NewBPOService(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+// serve sends a request to the BPO's router and returns the recorded response
+func serve(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestRoutesMatchSpec checks that the router and the OpenAPI document
+// describe the same endpoints
+func TestRoutesMatchSpec(t *testing.T) {
+	service := newTestService(t)
+	routes := service.setupRoutes().Handler.(chi.Routes)
+
+	var served []string
+	chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if route != "/" {
+			route = strings.TrimSuffix(route, "/")
+		}
+		served = append(served, method+" "+route)
+		return nil
+	})
+
+	var documented []string
+	for path, item := range service.api.doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	sort.Strings(served)
+	sort.Strings(documented)
+	if !reflect.DeepEqual(served, documented) {
+		t.Errorf("routes differ from the spec\nserved:     %v\ndocumented: %v", served, documented)
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	handler := newTestService(t).setupRoutes().Handler
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   []ValidationError
+	}{
+		{
+			name:   "missing trigger event",
+			method: http.MethodPost,
+			path:   "/v1/execute-workflow",
+			body:   `{"payload": {"product_name": "ROUTER-100"}}`,
+			want:   []ValidationError{{Field: "body.trigger_event", Issue: `property "trigger_event" is missing`}},
+		},
+		{
+			name:   "wrong payload type",
+			method: http.MethodPost,
+			path:   "/v1/execute-workflow",
+			body:   `{"trigger_event": "schematic.released", "payload": "ROUTER-100"}`,
+			want:   []ValidationError{{Field: "body.payload", Issue: "value must be an object"}},
+		},
+		{
+			name:   "dry_run not a boolean",
+			method: http.MethodPost,
+			path:   "/v1/execute-workflow?dry_run=maybe",
+			body:   `{"trigger_event": "schematic.released", "payload": {"product_name": "ROUTER-100"}}`,
+			want:   []ValidationError{{Field: "query.dry_run", Issue: "an invalid boolean"}},
+		},
+		{
+			name:   "empty batch",
+			method: http.MethodPost,
+			path:   "/v1/execute-workflows:batch",
+			body:   `{"requests": [], "concurrency": 0}`,
+			want: []ValidationError{
+				{Field: "body.concurrency", Issue: "number must be at least 1"},
+				{Field: "body.requests", Issue: "minimum number of items is 1"},
+			},
+		},
+		{
+			name:   "unknown decision",
+			method: http.MethodPost,
+			path:   "/v1/workflows/wf-1/approvals",
+			body:   `{"decision": "maybe"}`,
+			want:   []ValidationError{{Field: "body.decision", Issue: `value is not one of the allowed values ["approve","reject"]`}},
+		},
+		{
+			name:   "version not an integer",
+			method: http.MethodPost,
+			path:   "/v1/admin/workflow-definitions/schematic-released/versions/latest/deprecation",
+			want:   []ValidationError{{Field: "path.version", Issue: "an invalid integer"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(handler, tt.method, tt.path, tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", rec.Code, rec.Body)
+			}
+			var response struct {
+				Error   string            `json:"error"`
+				Details []ValidationError `json:"details"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Error != "invalid_request" || !reflect.DeepEqual(response.Details, tt.want) {
+				t.Errorf("response = %s, want details %+v", rec.Body, tt.want)
+			}
+		})
+	}
+
+	// An optional body may be left out
+	rec := serve(handler, http.MethodPost, "/v1/admin/workflows/wf-unknown/cancel", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("cancel without a body: status %d, want 404: %s", rec.Code, rec.Body)
+	}
+}
+
+// TestResponsesMatchSpec checks the JSON the BPO sends for requests that
+// need no SoR against the response schemas of the OpenAPI document
+func TestResponsesMatchSpec(t *testing.T) {
+	service := newTestService(t)
+	handler := service.setupRoutes().Handler
+	doc := service.api.doc
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/livez", "", http.StatusOK},
+		{http.MethodGet, "/openapi.json", "", http.StatusOK},
+		{http.MethodGet, "/v1/admin/workflow-definitions", "", http.StatusOK},
+		{http.MethodGet, "/v1/admin/workflow-definitions/schematic-released", "", http.StatusOK},
+		{http.MethodPost, "/v1/admin/workflow-definitions/schematic-released/versions/3/deprecation", "", http.StatusOK},
+		{http.MethodDelete, "/v1/admin/workflow-definitions/schematic-released/versions/3/deprecation", "", http.StatusOK},
+		{http.MethodGet, "/v1/admin/schedules", "", http.StatusOK},
+		{http.MethodGet, "/v1/workflows/wf-unknown", "", http.StatusNotFound},
+		{http.MethodGet, "/v1/batches/batch-unknown", "", http.StatusNotFound},
+		{http.MethodPost, "/v1/execute-workflow", `{}`, http.StatusBadRequest},
+		{http.MethodPost, "/v1/execute-workflows:batch", `{"requests": [{"trigger_event": "unknown.event"}]}`, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := serve(handler, tt.method, tt.path, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			route, ok := doc.FindRoute(tt.method, tt.path)
+			if !ok {
+				t.Fatal("spec has no route")
+			}
+			schema, err := doc.ResponseSchema(tt.method, route.Path, tt.status)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := bytes.TrimSpace(rec.Body.Bytes())
+			if err := doc.ValidateJSON(body, schema, openapi.Options{Strict: true}); err != nil {
+				t.Errorf("response does not match the spec: %v\n%s", err, body)
+			}
+		})
+	}
+}
+
+// TestDryRunResponseMatchesSpec checks a dry run's plan and trace against
+// the WorkflowResponse schema, running against the mocks
+func TestDryRunResponseMatchesSpec(t *testing.T) {
+	h := newHarness(t)
+	doc := h.service.api.doc
+	path := "/v1/execute-workflow"
+
+	rec := serve(h.service.setupRoutes().Handler, http.MethodPost, path+"?dry_run=true",
+		`{"trigger_event": "schematic.released", "payload": {"product_name": "ROUTER-100", "revision": "C"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", rec.Code, rec.Body)
+	}
+	route, ok := doc.FindRoute(http.MethodPost, path)
+	if !ok {
+		t.Fatal("spec has no route")
+	}
+	schema, err := doc.ResponseSchema(http.MethodPost, route.Path, http.StatusOK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := bytes.TrimSpace(rec.Body.Bytes())
+	if err := doc.ValidateJSON(body, schema, openapi.Options{Strict: true}); err != nil {
+		t.Errorf("response does not match the spec: %v\n%s", err, body)
+	}
+}
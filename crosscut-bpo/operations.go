@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// OperationRequest is the optional body of the admin workflow operations
+type OperationRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// decodeOperation reads the optional operation body
+func decodeOperation(r *http.Request) (OperationRequest, error) {
+	var request OperationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		return request, err
+	}
+	return request, nil
+}
+
+// operationRun resolves the run an admin operation targets and decodes the
+// request, writing the error response itself when either fails
+func (s *BPOService) operationRun(w http.ResponseWriter, r *http.Request) (*workflowRun, OperationRequest, bool) {
+	id := chi.URLParam(r, "id")
+	run, ok := s.findRun(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "workflow_not_found", fmt.Sprintf("Workflow %s is not known", id))
+		return nil, OperationRequest{}, false
+	}
+	request, err := decodeOperation(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Failed to decode JSON request")
+		return nil, OperationRequest{}, false
+	}
+	return run, request, true
+}
+
+// operationDetails records who performed an admin operation and why
+func operationDetails(actor string, request OperationRequest, extra map[string]interface{}) map[string]interface{} {
+	details := map[string]interface{}{
+		"actor": actor,
+	}
+	if request.Reason != "" {
+		details["reason"] = request.Reason
+	}
+	for key, value := range extra {
+		details[key] = value
+	}
+	return details
+}
+
+// beginOperation registers a run as executing again for retry or resume,
+// writing the error response itself on failure. check, if given, runs once
+// the run is known not to be executing.
+func (s *BPOService) beginOperation(w http.ResponseWriter, run *workflowRun, check func() error, from ...string) bool {
+	if err := s.beginWorkflow(run); err != nil {
+		if errors.Is(err, errShuttingDown) {
+			writeError(w, http.StatusServiceUnavailable, "shutting_down", err.Error())
+		} else {
+			writeError(w, http.StatusConflict, "workflow_busy", err.Error())
+		}
+		return false
+	}
+	if check != nil {
+		if err := check(); err != nil {
+			s.endWorkflow(run, nil)
+			writeError(w, http.StatusConflict, "invalid_state", err.Error())
+			return false
+		}
+	}
+	if err := s.reopenRun(run, from...); err != nil {
+		s.endWorkflow(run, nil)
+		writeError(w, http.StatusConflict, "invalid_state", err.Error())
+		return false
+	}
+	return true
+}
+
+// handleRetryWorkflow re-runs a failed workflow from the step that failed,
+// keeping the outputs of the steps before it. The retry uses the current
+// configuration, templates and SoR settings so a fixed dependency is picked
+// up; the definition version stays pinned. The audit entry records when the
+// snapshot the run had and the one it retries with were loaded.
+func (s *BPOService) handleRetryWorkflow(w http.ResponseWriter, r *http.Request) {
+	run, request, ok := s.operationRun(w, r)
+	if !ok {
+		return
+	}
+	// Compensated work has been undone, so later steps cannot rely on it
+	notCompensated := func() error {
+		if len(run.compensations) > 0 {
+			return errors.New("workflow was compensated; trigger it again instead")
+		}
+		return nil
+	}
+	if !s.beginOperation(w, run, notCompensated, runFailed) {
+		return
+	}
+
+	actor := callerFromContext(r.Context())
+	fromStep := run.Definition.Steps[run.next].ID
+	previous := run.state
+	run.state = s.current()
+	log.Printf("Workflow %s retried from %s by %s", run.ID, fromStep, actor)
+	s.auditRun(run, "workflow_retried", "success", operationDetails(actor, request, map[string]interface{}{
+		"from_step":                fromStep,
+		"state_loaded_at":          run.state.loadedAt.Format(time.RFC3339Nano),
+		"previous_state_loaded_at": previous.loadedAt.Format(time.RFC3339Nano),
+	}), nil)
+
+	response, err := s.executeRun(run.ctx, run)
+	s.endWorkflow(run, err)
+	writeRunResult(w, run, response, err)
+}
+
+// handleResumeWorkflow continues a paused workflow with its next step
+func (s *BPOService) handleResumeWorkflow(w http.ResponseWriter, r *http.Request) {
+	run, request, ok := s.operationRun(w, r)
+	if !ok {
+		return
+	}
+	if !s.beginOperation(w, run, nil, runPaused) {
+		return
+	}
+
+	actor := callerFromContext(r.Context())
+	log.Printf("Workflow %s resumed by %s", run.ID, actor)
+	s.auditRun(run, "workflow_resumed", "success", operationDetails(actor, request, map[string]interface{}{
+		"next_step": run.Definition.Steps[run.next].ID,
+	}), nil)
+
+	response, err := s.executeRun(run.ctx, run)
+	s.endWorkflow(run, err)
+	writeRunResult(w, run, response, err)
+}
+
+// handlePauseWorkflow asks a running workflow to pause before its next
+// step. The step in progress is allowed to finish.
+func (s *BPOService) handlePauseWorkflow(w http.ResponseWriter, r *http.Request) {
+	run, request, ok := s.operationRun(w, r)
+	if !ok {
+		return
+	}
+	actor := callerFromContext(r.Context())
+
+	s.runsMu.Lock()
+	status := run.status
+	if status == runRunning {
+		run.pauseRequestedBy = actor
+	}
+	s.runsMu.Unlock()
+	if status != runRunning {
+		writeError(w, http.StatusConflict, "invalid_state", fmt.Sprintf("workflow is %s, expected %s", status, runRunning))
+		return
+	}
+
+	log.Printf("Workflow %s pause requested by %s", run.ID, actor)
+	s.auditRun(run, "workflow_pause_requested", "success", operationDetails(actor, request, nil), nil)
+	writeJSON(w, http.StatusAccepted, WorkflowResponse{
+		Status:     "pause_requested",
+		WorkflowID: run.ID,
+		Message:    "Workflow will pause before its next step",
+	})
+}
+
+// pauseIfRequested suspends a run before step when an admin asked for it
+func (s *BPOService) pauseIfRequested(run *workflowRun, step string) *WorkflowResponse {
+	s.runsMu.Lock()
+	actor := run.pauseRequestedBy
+	if actor == "" || run.status != runRunning {
+		s.runsMu.Unlock()
+		return nil
+	}
+	run.pauseRequestedBy = ""
+	run.status = runPaused
+	s.runsMu.Unlock()
+
+	log.Printf("Workflow %s paused before %s", run.ID, step)
+	s.auditRun(run, "workflow_paused", runPaused, map[string]interface{}{
+		"requested_by": actor,
+		"next_step":    step,
+	}, nil)
+	return &WorkflowResponse{
+		Status:     runPaused,
+		WorkflowID: run.ID,
+		Message:    fmt.Sprintf("Workflow paused before %s", step),
+	}
+}
+
+// errRunCancelled is returned by a run whose step was cut short by cancel
+var errRunCancelled = errors.New("workflow cancelled")
+
+// runCancelledBy returns who cancelled a run, or "" if nobody did
+func (s *BPOService) runCancelledBy(run *workflowRun) string {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	return run.cancelledBy
+}
+
+// cancelledStep audits step as cancelled when an admin cancelled the run,
+// whether the step was cut short or never started, and returns the error
+// the run ends with. It returns nil if nobody cancelled the run.
+func (s *BPOService) cancelledStep(run *workflowRun, step string, err error) error {
+	actor := s.runCancelledBy(run)
+	if actor == "" {
+		return nil
+	}
+	s.auditRun(run, step, runCancelled, nil, err)
+	return fmt.Errorf("step %s cancelled by %s: %w", step, actor, errRunCancelled)
+}
+
+// handleCancelWorkflow stops a workflow. A suspended or queued workflow ends
+// at once; a running one has its current step cancelled and ends when it
+// unwinds. Completed steps are not compensated.
+func (s *BPOService) handleCancelWorkflow(w http.ResponseWriter, r *http.Request) {
+	run, request, ok := s.operationRun(w, r)
+	if !ok {
+		return
+	}
+	actor := callerFromContext(r.Context())
+	reason := fmt.Errorf("cancelled by %s", actor)
+
+	s.runsMu.Lock()
+	status := run.status
+	switch {
+	case isTerminal(status):
+		s.runsMu.Unlock()
+		writeError(w, http.StatusConflict, "invalid_state", fmt.Sprintf("workflow is already %s", status))
+		return
+	case status == runAwaitingApproval || status == runPaused || status == runQueued:
+		if run.approval != nil {
+			run.approval.stop()
+			run.approval = nil
+		}
+		run.cancelledBy = actor
+		s.setRunStatusLocked(run, runCancelled, reason)
+	default:
+		run.cancelledBy = actor
+	}
+	s.runsMu.Unlock()
+
+	// A running workflow notices the cancellation in its current step
+	s.inflightMu.Lock()
+	if _, ok := s.inflight[run.ID]; ok {
+		run.cancel()
+	}
+	s.inflightMu.Unlock()
+
+	log.Printf("Workflow %s cancelled by %s", run.ID, actor)
+	s.auditRun(run, "workflow_cancelled", runCancelled, operationDetails(actor, request, map[string]interface{}{
+		"previous_status": status,
+	}), nil)
+	writeJSON(w, http.StatusOK, WorkflowResponse{
+		Status:     runCancelled,
+		WorkflowID: run.ID,
+		Message:    reason.Error(),
+	})
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"crosscut-contracts/bpo"
+)
+
+// The audit entries of a release of ROUTER-100 up to its final two steps
+var releasePlanned = []string{
+	"workflow_started success",
+	"template_plan_generated success",
+	"plm_consultation success",
+	"document_plan_built success",
+	"high_voltage_safety skipped",
+}
+
+func TestPauseAndResume(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+	held := h.hold("docgen", http.MethodPost, "/validate-plan")
+	done := h.triggerAsync("schematic.released", routerRelease)
+	held.wait()
+	id := h.inflightID()
+
+	response, err := bpo.Decode[bpo.WorkflowResponse](h.client.PauseWorkflow(ctx, id, bpo.OperationRequest{Reason: "check the limits"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "pause_requested" {
+		t.Errorf("pause response = %+v", response)
+	}
+
+	// The step in progress finishes before the run pauses
+	held.release()
+	result := h.await(done)
+	if result.err != nil || result.response.Status != runPaused {
+		t.Fatalf("trigger = %+v, %v; want %s", result.response, result.err, runPaused)
+	}
+	if status := h.status(id); status.Status != runPaused {
+		t.Errorf("status = %s, want %s", status.Status, runPaused)
+	}
+	var apiErr *bpo.Error
+	if _, err := bpo.Decode[bpo.WorkflowResponse](h.client.PauseWorkflow(ctx, id, bpo.OperationRequest{})); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("pausing a paused workflow: error = %v, want 409", err)
+	}
+
+	response, err = bpo.Decode[bpo.WorkflowResponse](h.client.ResumeWorkflow(ctx, id, bpo.OperationRequest{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "success" || response.DocumentURL == "" {
+		t.Errorf("resume response = %+v, want the completed workflow", response)
+	}
+	h.assertAuditTrail(id, append(append([]string(nil), releasePlanned...),
+		"workflow_pause_requested success",
+		"document_plan_validated success",
+		"workflow_paused paused",
+		"workflow_resumed success",
+		"docgen_command success",
+		"workflow_completed success",
+	)...)
+	if next := h.auditEntry(id, "workflow_paused").Details["next_step"]; next != "docgen_command" {
+		t.Errorf("paused before %v, want docgen_command", next)
+	}
+	if _, err := bpo.Decode[bpo.WorkflowResponse](h.client.ResumeWorkflow(ctx, id, bpo.OperationRequest{})); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("resuming a completed workflow: error = %v, want 409", err)
+	}
+}
+
+func TestCancelRunningStep(t *testing.T) {
+	h := newHarness(t)
+	held := h.hold("docgen", http.MethodPost, "/generate")
+	done := h.triggerAsync("schematic.released", routerRelease)
+	held.wait()
+	id := h.inflightID()
+
+	response, err := bpo.Decode[bpo.WorkflowResponse](h.client.CancelWorkflow(context.Background(), id, bpo.OperationRequest{Reason: "wrong revision"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Status != runCancelled {
+		t.Errorf("cancel response = %+v", response)
+	}
+	var apiErr *bpo.Error
+	result := h.await(done)
+	if !errors.As(result.err, &apiErr) || apiErr.StatusCode != http.StatusConflict || apiErr.Code != "workflow_cancelled" {
+		t.Fatalf("trigger error = %v, want 409 workflow_cancelled", result.err)
+	}
+	h.eventually("the run to end", func() bool { return h.status(id).Status == runCancelled })
+	h.assertAuditTrail(id, append(append([]string(nil), releasePlanned...),
+		"document_plan_validated success",
+		"workflow_cancelled cancelled",
+		"docgen_command cancelled",
+	)...)
+	if reason := h.auditEntry(id, "workflow_cancelled").Details["reason"]; reason != "wrong revision" {
+		t.Errorf("cancellation reason = %v", reason)
+	}
+}
+
+func TestCancelBetweenSteps(t *testing.T) {
+	h := newHarness(t)
+	run, err := h.service.newRun("schematic.released", routerRelease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.service.beginWorkflow(run); err != nil {
+		t.Fatal(err)
+	}
+	h.service.trackRun(run)
+
+	// The cancellation lands while no step is executing
+	if _, err := bpo.Decode[bpo.WorkflowResponse](h.client.CancelWorkflow(context.Background(), run.ID, bpo.OperationRequest{})); err != nil {
+		t.Fatal(err)
+	}
+	response, err := h.service.executeRun(run.ctx, run)
+	h.service.endWorkflow(run, err)
+
+	if !errors.Is(err, errRunCancelled) {
+		t.Fatalf("executeRun = %+v, %v; want errRunCancelled", response, err)
+	}
+	recorder := httptest.NewRecorder()
+	writeRunResult(recorder, run, response, err)
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("response = %d %s, want 409", recorder.Code, recorder.Body)
+	}
+	h.assertAuditTrail(run.ID,
+		"workflow_cancelled cancelled",
+		"workflow_started success",
+		"template_plan_generated cancelled",
+	)
+	if status := h.status(run.ID); status.Status != runCancelled {
+		t.Errorf("status = %s, want %s", status.Status, runCancelled)
+	}
+	if n := h.requests("plm", http.MethodGet, "/products/ROUTER-100/revisions/C"); n != 0 {
+		t.Errorf("PLM received %d requests after the cancellation", n)
+	}
+}
+
+func TestCancelPausedWorkflow(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+	held := h.hold("docgen", http.MethodPost, "/validate-plan")
+	done := h.triggerAsync("schematic.released", routerRelease)
+	held.wait()
+	id := h.inflightID()
+	if _, err := bpo.Decode[bpo.WorkflowResponse](h.client.PauseWorkflow(ctx, id, bpo.OperationRequest{})); err != nil {
+		t.Fatal(err)
+	}
+	held.release()
+	h.await(done)
+
+	response, err := bpo.Decode[bpo.WorkflowResponse](h.client.CancelWorkflow(ctx, id, bpo.OperationRequest{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Status != runCancelled {
+		t.Errorf("cancel response = %+v", response)
+	}
+	if status := h.status(id); status.Status != runCancelled || status.FinishedAt == nil {
+		t.Errorf("status = %+v, want finished as %s", status, runCancelled)
+	}
+	var apiErr *bpo.Error
+	if _, err := bpo.Decode[bpo.WorkflowResponse](h.client.ResumeWorkflow(ctx, id, bpo.OperationRequest{})); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("resuming a cancelled workflow: error = %v, want 409", err)
+	}
+	if _, err := bpo.Decode[bpo.WorkflowResponse](h.client.CancelWorkflow(ctx, id, bpo.OperationRequest{})); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("cancelling twice: error = %v, want 409", err)
+	}
+	if n := h.requests("docgen", http.MethodPost, "/generate"); n != 0 {
+		t.Errorf("DocGen received %d generate requests, want none", n)
+	}
+}
+
+func TestRetryFailedWorkflow(t *testing.T) {
+	h := newHarness(t)
+	h.failRequests("docgen", http.MethodPost, "/generate", http.StatusInternalServerError, 1)
+
+	_, err := h.trigger("schematic.released", routerRelease)
+	id := failedWorkflowID(t, err)
+	if status := h.status(id); status.Status != runFailed {
+		t.Fatalf("status = %s, want %s", status.Status, runFailed)
+	}
+
+	response, err := bpo.Decode[bpo.WorkflowResponse](h.client.RetryWorkflow(context.Background(), id, bpo.OperationRequest{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Status != "success" || response.WorkflowID != id {
+		t.Errorf("retry response = %+v", response)
+	}
+	h.assertAuditTrail(id, append(append([]string(nil), releasePlanned...),
+		"document_plan_validated success",
+		"docgen_command failed",
+		"workflow_retried success",
+		"docgen_command success",
+		"workflow_completed success",
+	)...)
+	if from := h.auditEntry(id, "workflow_retried").Details["from_step"]; from != "docgen_command" {
+		t.Errorf("retried from %v, want docgen_command", from)
+	}
+	// Steps before the failure are not repeated
+	if n := h.requests("plm", http.MethodPost, "/enrich-plan"); n != 1 {
+		t.Errorf("PLM received %d enrich requests, want 1", n)
+	}
+}
+
+func TestRetryRecordsReloadedState(t *testing.T) {
+	h, _, _ := reloadHarness(t)
+	h.failRequests("docgen", http.MethodPost, "/generate", http.StatusInternalServerError, 1)
+
+	_, err := h.trigger("schematic.released", routerRelease)
+	id := failedWorkflowID(t, err)
+	started := h.service.current().loadedAt.Format(time.RFC3339Nano)
+	if err := h.service.reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := h.service.current().loadedAt.Format(time.RFC3339Nano)
+
+	if _, err := bpo.Decode[bpo.WorkflowResponse](h.client.RetryWorkflow(context.Background(), id, bpo.OperationRequest{})); err != nil {
+		t.Fatal(err)
+	}
+
+	details := h.auditEntry(id, "workflow_retried").Details
+	if details["previous_state_loaded_at"] != started || details["state_loaded_at"] != reloaded {
+		t.Errorf("retried with details %v, want state loaded at %s, previously %s", details, reloaded, started)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Join policies of a parallel step
+const (
+	joinAll  = "all"
+	joinAny  = "any"
+	joinNOfM = "n_of_m"
+)
+
+// outputBranches holds the outputs of each successful branch, by branch ID
+const outputBranches = "branches"
+
+// Branch outcomes recorded in the audit trail
+const (
+	branchSucceeded = "success"
+	branchFailed    = "failed"
+	branchCancelled = "cancelled"
+)
+
+// branchActions names the audit action recording each branch outcome
+var branchActions = map[string]string{
+	branchSucceeded: "branch_completed",
+	branchFailed:    "branch_failed",
+	branchCancelled: "branch_cancelled",
+}
+
+// parallelConfig is the `with` block of a parallel step
+type parallelConfig struct {
+	// Join decides when the step succeeds: every branch (all), one branch
+	// (any) or at least Required branches (n_of_m)
+	Join     string             `yaml:"join"`
+	Required int                `yaml:"required"`
+	Branches []branchDefinition `yaml:"branches"`
+}
+
+// branchDefinition is one sequence of steps run alongside the others
+type branchDefinition struct {
+	ID    string           `yaml:"id"`
+	Steps []StepDefinition `yaml:"steps"`
+}
+
+// required returns how many branches must succeed for the join to succeed
+func (c parallelConfig) required() int {
+	switch c.Join {
+	case joinAny:
+		return 1
+	case joinNOfM:
+		return c.Required
+	default:
+		return len(c.Branches)
+	}
+}
+
+// parseParallelConfig decodes a parallel step, applying the default join
+func parseParallelConfig(step StepDefinition) (parallelConfig, error) {
+	var cfg parallelConfig
+	if err := decodeWith(step, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Join == "" {
+		cfg.Join = joinAll
+	}
+	return cfg, nil
+}
+
+// validateParallelStep checks a parallel step and the steps of its branches
+func validateParallelStep(step StepDefinition) error {
+	cfg, err := parseParallelConfig(step)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	switch cfg.Join {
+	case joinAll, joinAny:
+		if cfg.Required != 0 {
+			problems = append(problems, fmt.Sprintf("required: only used with join %q", joinNOfM))
+		}
+	case joinNOfM:
+		if cfg.Required < 1 || cfg.Required > len(cfg.Branches) {
+			problems = append(problems, fmt.Sprintf("required: must be between 1 and the number of branches (%d)", len(cfg.Branches)))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("join: must be %q, %q or %q", joinAll, joinAny, joinNOfM))
+	}
+	if len(cfg.Branches) < 2 {
+		problems = append(problems, "branches: at least two branches are required")
+	}
+
+	seen := map[string]bool{}
+	for i, branch := range cfg.Branches {
+		path := fmt.Sprintf("branches[%d]", i)
+		if branch.ID == "" {
+			problems = append(problems, path+".id: must not be empty")
+		} else if seen[branch.ID] {
+			problems = append(problems, fmt.Sprintf("%s.id: %q is used more than once", path, branch.ID))
+		}
+		seen[branch.ID] = true
+
+		problems = append(problems, validateSteps(path+".steps", branch.Steps)...)
+		for j, nested := range branch.Steps {
+			if nested.Type == "wait_for_approval" {
+				problems = append(problems, fmt.Sprintf("%s.steps[%d].type: approvals cannot run inside a parallel branch", path, j))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// branch returns a copy of the run for executing one parallel branch. The
+// copy sees the outputs recorded so far but keeps its own from here on, as
+// well as its own compensations.
+func (r *workflowRun) branch(id string) *workflowRun {
+	outputs := make(map[string]interface{}, len(r.outputs))
+	for key, value := range r.outputs {
+		outputs[key] = value
+	}
+
+	path := id
+	if r.branchPath != "" {
+		path = r.branchPath + "/" + id
+	}
+	return &workflowRun{
+		ID:         r.ID,
+		Event:      r.Event,
+		Definition: r.Definition,
+		Inputs:     r.Inputs,
+		Payload:    r.Payload,
+		StartedAt:  r.StartedAt,
+		state:      r.state,
+		outputs:    outputs,
+		documents:  make(map[string]string),
+		branchPath: path,
+		trace:      r.trace,
+	}
+}
+
+// branchResult is the outcome of one branch of a parallel step
+type branchResult struct {
+	run    *workflowRun
+	status string
+	err    error
+}
+
+// stepParallel runs each branch concurrently and joins them according to
+// the step's policy. Once the outcome is decided the remaining branches are
+// cancelled. Outputs of successful branches are kept under "branches".
+func (s *BPOService) stepParallel(ctx context.Context, run *workflowRun, step StepDefinition) (map[string]interface{}, error) {
+	cfg, err := parseParallelConfig(step)
+	if err != nil {
+		return nil, err
+	}
+	required := cfg.required()
+
+	branchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]branchResult, len(cfg.Branches))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	succeeded, failed := 0, 0
+	for i, branch := range cfg.Branches {
+		i, branch := i, branch
+		branchRun := run.branch(branch.ID)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.executeBranch(branchCtx, branchRun, branch.Steps)
+
+			status := branchSucceeded
+			switch {
+			case err == nil:
+			case branchCtx.Err() != nil && ctx.Err() == nil:
+				status = branchCancelled
+			default:
+				status = branchFailed
+			}
+			s.auditRun(branchRun, branchActions[status], status, nil, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[i] = branchResult{run: branchRun, status: status, err: err}
+			switch status {
+			case branchSucceeded:
+				succeeded++
+			case branchFailed:
+				failed++
+			}
+			// Stop the other branches once the join can no longer change
+			if succeeded >= required || failed > len(cfg.Branches)-required {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	outcomes := make(map[string]string, len(results))
+	var problems []string
+	branchOutputs, _ := run.outputs[outputBranches].(map[string]map[string]interface{})
+	if branchOutputs == nil {
+		branchOutputs = make(map[string]map[string]interface{})
+	}
+	for i, result := range results {
+		id := cfg.Branches[i].ID
+		outcomes[id] = result.status
+		// Whatever a branch completed is undone if the workflow fails
+		run.compensations = append(run.compensations, result.run.compensations...)
+		if result.status != branchSucceeded {
+			if result.status == branchFailed {
+				problems = append(problems, fmt.Sprintf("%s: %v", id, result.err))
+			}
+			continue
+		}
+
+		branchOutputs[id] = result.run.outputs
+		if result.run.documentURL != "" {
+			run.documents[result.run.branchPath] = result.run.documentURL
+			if run.documentURL == "" {
+				run.documentURL = result.run.documentURL
+			}
+		}
+		for path, url := range result.run.documents {
+			run.documents[path] = url
+		}
+	}
+	run.outputs[outputBranches] = branchOutputs
+
+	details := map[string]interface{}{
+		"join":      cfg.Join,
+		"required":  required,
+		"succeeded": succeeded,
+		"branches":  outcomes,
+	}
+	if succeeded < required {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("Workflow %s: join %s of %s not satisfied (%d/%d succeeded)", run.ID, cfg.Join, step.ID, succeeded, required)
+		return nil, fmt.Errorf("join %s needed %d successful branch(es), got %d: %s", cfg.Join, required, succeeded, strings.Join(problems, "; "))
+	}
+	return details, nil
+}
+
+// executeBranch runs the steps of a parallel branch in order, auditing each
+// one against the branch
+func (s *BPOService) executeBranch(ctx context.Context, run *workflowRun, steps []StepDefinition) error {
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("branch stopped before %s: %w", step.ID, err)
+		}
+
+		details, err := s.runStep(ctx, run, step)
+		if err != nil {
+			status := "failed"
+			if ctx.Err() != nil {
+				status = branchCancelled
+			}
+			s.auditRun(run, step.ID, status, failureDetails(err), err)
+			return fmt.Errorf("step %s %s: %w", step.ID, status, err)
+		}
+		if details != nil {
+			s.auditRun(run, step.ID, "success", details, nil)
+		}
+	}
+	return nil
+}
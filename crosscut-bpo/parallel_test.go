@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// parallelDefinition builds a release whose document plan is handed to a
+// parallel step with the given join and branches
+func parallelDefinition(join string, branches string) string {
+	return fmt.Sprintf(`
+name: parallel-release
+version: 1
+trigger: release.parallel
+inputs:
+  product_name:
+    required: true
+  revision: {}
+steps:
+  - id: template_plan_generated
+    type: generate_template_plan
+  - id: plm_consultation
+    type: consult_plm
+  - id: document_plan_built
+    type: build_document_plan
+  - id: fan_out
+    type: parallel
+    with:
+      %s
+      branches:%s
+`, join, branches)
+}
+
+// Branches, each calling a different SoR endpoint so faults can target one
+const (
+	validateBranch = `
+        - id: validate
+          steps:
+            - {id: validated, type: validate_document_plan}`
+	generateBranch = `
+        - id: generate
+          steps:
+            - {id: generated, type: command_docgen}`
+	notifyBranch = `
+        - id: notify
+          steps:
+            - {id: notified, type: notify_plm, with: {status: documented}}`
+)
+
+// branchOutcomes returns how each branch of a workflow's parallel step
+// ended, from the audit trail
+func (h *harness) branchOutcomes(workflowID string) map[string]string {
+	h.t.Helper()
+	outcomes := map[string]string{}
+	for _, entry := range h.auditEntries(workflowID) {
+		for status, action := range branchActions {
+			if entry.Action == action {
+				outcomes[entry.Branch] = status
+			}
+		}
+	}
+	return outcomes
+}
+
+func TestAnyJoinCancelsRemainingBranches(t *testing.T) {
+	h := newDefinitionsHarness(t, parallelDefinition("join: any", validateBranch+generateBranch))
+	h.hold("docgen", http.MethodPost, "/generate")
+
+	response, err := h.trigger("release.parallel", routerRelease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Status != "success" {
+		t.Errorf("response = %+v", response)
+	}
+	want := map[string]string{"validate": branchSucceeded, "generate": branchCancelled}
+	if got := h.branchOutcomes(response.WorkflowID); !reflect.DeepEqual(got, want) {
+		t.Errorf("branch outcomes = %v, want %v", got, want)
+	}
+	entry := h.auditEntry(response.WorkflowID, "fan_out")
+	if entry.Status != "success" || entry.Details["succeeded"] != 1.0 {
+		t.Errorf("fan_out entry = %+v", entry)
+	}
+	if n := h.requests("docgen", http.MethodPost, "/generate"); n != 1 {
+		t.Errorf("DocGen received %d generate requests, want the one cancelled", n)
+	}
+}
+
+func TestNOfMJoinCancelsRemainingBranches(t *testing.T) {
+	h := newDefinitionsHarness(t, parallelDefinition("join: n_of_m\n      required: 2", validateBranch+notifyBranch+generateBranch))
+	h.hold("docgen", http.MethodPost, "/generate")
+
+	response, err := h.trigger("release.parallel", routerRelease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Status != "success" {
+		t.Errorf("response = %+v", response)
+	}
+	want := map[string]string{"validate": branchSucceeded, "notify": branchSucceeded, "generate": branchCancelled}
+	if got := h.branchOutcomes(response.WorkflowID); !reflect.DeepEqual(got, want) {
+		t.Errorf("branch outcomes = %v, want %v", got, want)
+	}
+}
+
+func TestNOfMJoinFailsOnceUnreachable(t *testing.T) {
+	h := newDefinitionsHarness(t, parallelDefinition("join: n_of_m\n      required: 2", validateBranch+notifyBranch+generateBranch))
+	h.hold("docgen", http.MethodPost, "/generate")
+	h.failRequests("docgen", http.MethodPost, "/validate-plan", http.StatusInternalServerError, 0)
+	h.failRequests("plm", http.MethodPost, "/products/ROUTER-100/release-status", http.StatusInternalServerError, 0)
+
+	_, err := h.trigger("release.parallel", routerRelease)
+
+	id := failedWorkflowID(t, err)
+	want := map[string]string{"validate": branchFailed, "notify": branchFailed, "generate": branchCancelled}
+	if got := h.branchOutcomes(id); !reflect.DeepEqual(got, want) {
+		t.Errorf("branch outcomes = %v, want %v", got, want)
+	}
+	if entry := h.auditEntry(id, "fan_out"); entry.Status != "failed" {
+		t.Errorf("fan_out entry = %+v, want failed", entry)
+	}
+}
+
+func TestAllJoinFailsOnFirstFailure(t *testing.T) {
+	h := newDefinitionsHarness(t, parallelDefinition("join: all", validateBranch+generateBranch))
+	h.hold("docgen", http.MethodPost, "/generate")
+	h.failRequests("docgen", http.MethodPost, "/validate-plan", http.StatusInternalServerError, 0)
+
+	_, err := h.trigger("release.parallel", routerRelease)
+
+	id := failedWorkflowID(t, err)
+	want := map[string]string{"validate": branchFailed, "generate": branchCancelled}
+	if got := h.branchOutcomes(id); !reflect.DeepEqual(got, want) {
+		t.Errorf("branch outcomes = %v, want %v", got, want)
+	}
+}
+
+func TestAllJoinCollectsBranchDocuments(t *testing.T) {
+	h := newDefinitionsHarness(t, parallelDefinition("join: all", validateBranch+generateBranch+notifyBranch))
+
+	response, err := h.trigger("release.parallel", routerRelease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"validate": branchSucceeded, "generate": branchSucceeded, "notify": branchSucceeded}
+	if got := h.branchOutcomes(response.WorkflowID); !reflect.DeepEqual(got, want) {
+		t.Errorf("branch outcomes = %v, want %v", got, want)
+	}
+	if len(response.Documents) != 1 || response.Documents["generate"] == "" || response.DocumentURL != response.Documents["generate"] {
+		t.Errorf("documents = %v, document_url = %s; want the generate branch's document", response.Documents, response.DocumentURL)
+	}
+}
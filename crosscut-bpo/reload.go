@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce coalesces bursts of file events (editors often write a
+// file several times when saving) into a single reload
+const reloadDebounce = 500 * time.Millisecond
+
+// reload re-reads the configuration and workflow definitions, validates
+// them and atomically swaps them in for newly triggered workflows. Running
+// workflows keep the snapshot they started with. On any error the current
+// snapshot stays in place.
+func (s *BPOService) reload(reason string) error {
+	cfg, err := LoadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+
+	old := s.current()
+
+	// These sections are bound when the process starts
+	if !reflect.DeepEqual(cfg.Server, old.config.Server) {
+		log.Printf("Reload: server settings changed but require a restart; keeping current values")
+		cfg.Server = old.config.Server
+	}
+	if !reflect.DeepEqual(cfg.Audit, old.config.Audit) {
+		log.Printf("Reload: audit settings changed but require a restart; keeping current values")
+		cfg.Audit = old.config.Audit
+	}
+	if !reflect.DeepEqual(cfg.Timeouts, old.config.Timeouts) {
+		log.Printf("Reload: timeout settings changed but require a restart; keeping current values")
+		cfg.Timeouts = old.config.Timeouts
+	}
+	if cfg.Scheduler.LeasePath != old.config.Scheduler.LeasePath || cfg.Scheduler.StatePath != old.config.Scheduler.StatePath {
+		log.Printf("Reload: scheduler lease and state paths changed but require a restart; keeping current values")
+		cfg.Scheduler.LeasePath = old.config.Scheduler.LeasePath
+		cfg.Scheduler.StatePath = old.config.Scheduler.StatePath
+	}
+
+	state, err := newRuntimeState(cfg)
+	if err != nil {
+		return err
+	}
+	if err := verifyCatalogue(state); err != nil {
+		return err
+	}
+	s.state.Store(state)
+
+	log.Printf("Reloaded configuration (%s)", reason)
+	for _, def := range state.definitions.definitions() {
+		prior, ok := old.definitions.find(def.key())
+		switch {
+		case !ok:
+			log.Printf("Reload: registered %s for %s", def, def.Trigger)
+		case prior.Digest != def.Digest:
+			log.Printf("Reload: %s changed (digest %s, was %s)", def, def.Digest, prior.Digest)
+		}
+	}
+	for _, def := range old.definitions.definitions() {
+		if _, ok := state.definitions.find(def.key()); !ok {
+			log.Printf("Reload: unregistered %s; running instances finish on it", def)
+		}
+	}
+	if len(state.schedules) != len(old.schedules) {
+		log.Printf("Reload: %d schedule(s) configured, was %d", len(state.schedules), len(old.schedules))
+	}
+	return nil
+}
+
+// watchedDirs returns the directories whose changes trigger a reload
+func (s *BPOService) watchedDirs() []string {
+	var dirs []string
+	if s.configPath != "" {
+		dirs = append(dirs, filepath.Dir(s.configPath))
+	}
+	if dir := s.current().config.Workflows.DefinitionsDir; dir != "" {
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	if dir := s.current().config.Documents.TemplatesDir; dir != "" {
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	return dirs
+}
+
+// isReloadTrigger reports whether a file event concerns the config file, a
+// workflow definition or a document template
+func (s *BPOService) isReloadTrigger(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	if s.configPath != "" && filepath.Clean(event.Name) == filepath.Clean(s.configPath) {
+		return true
+	}
+	cfg := s.current().config
+	for _, dir := range []string{cfg.Workflows.DefinitionsDir, cfg.Documents.TemplatesDir} {
+		if dir == "" || filepath.Dir(event.Name) != filepath.Clean(dir) {
+			continue
+		}
+		ext := filepath.Ext(event.Name)
+		return ext == ".yaml" || ext == ".yml"
+	}
+	return false
+}
+
+// runReloader reloads on SIGHUP and whenever the config file or a workflow
+// definition changes on disk, until ctx is cancelled
+func (s *BPOService) runReloader(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("File watching disabled, reload with SIGHUP only: %v", err)
+	} else {
+		defer watcher.Close()
+	}
+
+	watched := map[string]bool{}
+	syncWatches := func() {
+		if watcher == nil {
+			return
+		}
+		wanted := map[string]bool{}
+		for _, dir := range s.watchedDirs() {
+			wanted[dir] = true
+			if !watched[dir] {
+				if err := watcher.Add(dir); err != nil {
+					log.Printf("Failed to watch %s: %v", dir, err)
+					continue
+				}
+				watched[dir] = true
+			}
+		}
+		for dir := range watched {
+			if !wanted[dir] {
+				watcher.Remove(dir)
+				delete(watched, dir)
+			}
+		}
+	}
+	syncWatches()
+
+	doReload := func(reason string) {
+		if err := s.reload(reason); err != nil {
+			log.Printf("Reload (%s) rejected, keeping current configuration: %v", reason, err)
+			return
+		}
+		syncWatches()
+	}
+
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if watcher != nil {
+		events = watcher.Events
+		watchErrors = watcher.Errors
+	}
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	var changed string
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			doReload("SIGHUP")
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if s.isReloadTrigger(event) {
+				changed = event.Name
+				debounce.Reset(reloadDebounce)
+			}
+		case err, ok := <-watchErrors:
+			if !ok {
+				watchErrors = nil
+				continue
+			}
+			log.Printf("File watcher error: %v", err)
+		case <-debounce.C:
+			doReload("changed " + changed)
+		}
+	}
+}
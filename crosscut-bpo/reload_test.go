@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadHarness starts the services with workflow definitions copied into
+// a temporary directory and a config file pointing at it, so tests can
+// edit either and reload
+func reloadHarness(t *testing.T) (h *harness, definitionsDir, configPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	definitionsDir = filepath.Join(dir, "workflows")
+	if err := os.Mkdir(definitionsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	definition, err := os.ReadFile("workflows/schematic-released.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(definitionsDir, "schematic-released.yaml"), string(definition))
+	configPath = filepath.Join(dir, "config.yaml")
+	writeFile(t, configPath, "workflows:\n  definitions_dir: "+definitionsDir+"\n")
+
+	h = newHarness(t, func(cfg *Config) {
+		cfg.Workflows.DefinitionsDir = definitionsDir
+	})
+	h.service.configPath = configPath
+	return h, definitionsDir, configPath
+}
+
+// planOnlyDefinition is version 4 of schematic-released, which stops once
+// the document plan is built
+const planOnlyDefinition = `
+name: schematic-released
+version: 4
+trigger: schematic.released
+inputs:
+  product_name:
+    required: true
+  revision: {}
+steps:
+  - id: template_plan_generated
+    type: generate_template_plan
+  - id: plm_consultation
+    type: consult_plm
+  - id: document_plan_built
+    type: build_document_plan
+`
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadAppliesToNewWorkflowsOnly(t *testing.T) {
+	h, definitionsDir, _ := reloadHarness(t)
+	held := h.hold("docgen", http.MethodPost, "/generate")
+	done := h.triggerAsync("schematic.released", routerRelease)
+	held.wait()
+	running := h.inflightID()
+
+	writeFile(t, filepath.Join(definitionsDir, "schematic-released.yaml"), planOnlyDefinition)
+	if err := h.service.reload("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	response := h.release("ROUTER-100", "C")
+	h.assertAuditTrail(response.WorkflowID,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"workflow_completed success",
+	)
+	if version := h.auditEntry(response.WorkflowID, "workflow_started").DefinitionVersion; version != 4 {
+		t.Errorf("new workflow ran version %d, want 4", version)
+	}
+
+	// The workflow already running finishes on the version it started with
+	held.release()
+	if result := h.await(done); result.err != nil || result.response.Status != "success" {
+		t.Fatalf("running workflow = %+v, %v", result.response, result.err)
+	}
+	if entry := h.auditEntry(running, "docgen_command"); entry.Status != "success" || entry.DefinitionVersion != 3 {
+		t.Errorf("running workflow's docgen_command = %+v, want success on version 3", entry)
+	}
+}
+
+func TestRejectedReloadKeepsCurrentConfiguration(t *testing.T) {
+	h, definitionsDir, configPath := reloadHarness(t)
+	before := h.service.current()
+
+	writeFile(t, filepath.Join(definitionsDir, "broken.yaml"), `
+name: broken
+version: 1
+trigger: broken.released
+steps:
+  - id: first
+    type: no_such_step
+`)
+	err := h.service.reload("test")
+
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || !strings.Contains(err.Error(), "no_such_step") {
+		t.Fatalf("error = %v, want a ConfigError naming the unknown step type", err)
+	}
+	if h.service.current() != before {
+		t.Error("a rejected reload replaced the configuration")
+	}
+	h.release("ROUTER-100", "C")
+
+	// Settings bound at startup are kept even when the rest reloads
+	if err := os.Remove(filepath.Join(definitionsDir, "broken.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, configPath, "server:\n  listen_addr: \":9999\"\nworkflows:\n  definitions_dir: "+definitionsDir+"\n")
+	if err := h.service.reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	if h.service.current() == before {
+		t.Error("reload kept the old configuration")
+	}
+	if addr := h.service.current().config.Server.ListenAddr; addr != before.config.Server.ListenAddr {
+		t.Errorf("listen_addr = %s after reload, want %s until restart", addr, before.config.Server.ListenAddr)
+	}
+}
+
+func TestReloadTriggers(t *testing.T) {
+	h, definitionsDir, configPath := reloadHarness(t)
+
+	tests := []struct {
+		event fsnotify.Event
+		want  bool
+	}{
+		{fsnotify.Event{Name: configPath, Op: fsnotify.Write}, true},
+		{fsnotify.Event{Name: configPath, Op: fsnotify.Chmod}, false},
+		{fsnotify.Event{Name: filepath.Join(definitionsDir, "new.yaml"), Op: fsnotify.Create}, true},
+		{fsnotify.Event{Name: filepath.Join(definitionsDir, "old.yml"), Op: fsnotify.Remove}, true},
+		{fsnotify.Event{Name: filepath.Join(definitionsDir, ".new.yaml.swp"), Op: fsnotify.Write}, false},
+		{fsnotify.Event{Name: filepath.Join(filepath.Dir(configPath), "other.yaml"), Op: fsnotify.Write}, false},
+	}
+	for _, tt := range tests {
+		if got := h.service.isReloadTrigger(tt.event); got != tt.want {
+			t.Errorf("isReloadTrigger(%s) = %v, want %v", tt.event, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Workflow run statuses
+const (
+	runRunning          = "running"
+	runAwaitingApproval = "awaiting_approval"
+	runCompleted        = "completed"
+	runFailed           = "failed"
+	runRejected         = "rejected"
+	runInterrupted      = "interrupted"
+	runCompensated      = "compensated"
+	runPaused           = "paused"
+	runCancelled        = "cancelled"
+	// runQueued is a batch item waiting for a concurrency slot
+	runQueued = "queued"
+)
+
+// maxRetainedRuns bounds how many finished runs are kept for inspection
+const maxRetainedRuns = 1000
+
+// isTerminal reports whether a run in this status can no longer progress
+func isTerminal(status string) bool {
+	switch status {
+	case runCompleted, runFailed, runRejected, runInterrupted, runCompensated, runCancelled:
+		return true
+	}
+	return false
+}
+
+// WorkflowStatus is the externally visible state of a run
+type WorkflowStatus struct {
+	WorkflowID        string            `json:"workflow_id"`
+	Event             string            `json:"event"`
+	Definition        string            `json:"definition"`
+	DefinitionVersion int               `json:"definition_version"`
+	Status            string            `json:"status"`
+	CurrentStep       string            `json:"current_step,omitempty"`
+	StartedAt         time.Time         `json:"started_at"`
+	FinishedAt        *time.Time        `json:"finished_at,omitempty"`
+	DocumentURL       string            `json:"document_url,omitempty"`
+	Documents         map[string]string `json:"documents,omitempty"`
+	Error             string            `json:"error,omitempty"`
+	Approval          *pendingApproval  `json:"approval,omitempty"`
+}
+
+// trackRun registers a run so it can be looked up by ID
+func (s *BPOService) trackRun(run *workflowRun) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	run.status = runRunning
+	s.runs[run.ID] = run
+}
+
+// findRun returns a tracked run
+func (s *BPOService) findRun(id string) (*workflowRun, bool) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	run, ok := s.runs[id]
+	return run, ok
+}
+
+// setRunStatus moves a run to a new status. Finished runs are retained up
+// to maxRetainedRuns, oldest evicted first.
+func (s *BPOService) setRunStatus(run *workflowRun, status string, runErr error) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	s.setRunStatusLocked(run, status, runErr)
+}
+
+// setRunStatusLocked is setRunStatus for callers holding runsMu
+func (s *BPOService) setRunStatusLocked(run *workflowRun, status string, runErr error) {
+	if isTerminal(run.status) {
+		return
+	}
+	run.status = status
+	if runErr != nil {
+		run.err = runErr.Error()
+	}
+	if !isTerminal(status) {
+		return
+	}
+
+	now := time.Now()
+	run.finishedAt = &now
+	// Untracked runs, such as dry runs, are not retained
+	if s.runs[run.ID] != run {
+		return
+	}
+	s.finished = append(s.finished, run.ID)
+	for len(s.finished) > maxRetainedRuns {
+		delete(s.runs, s.finished[0])
+		s.finished = s.finished[1:]
+	}
+}
+
+// reopenRun moves a finished or suspended run in one of the given statuses
+// back to running so it can execute again
+func (s *BPOService) reopenRun(run *workflowRun, from ...string) error {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	allowed := false
+	for _, status := range from {
+		allowed = allowed || run.status == status
+	}
+	if !allowed {
+		return fmt.Errorf("workflow is %s, expected %s", run.status, strings.Join(from, " or "))
+	}
+
+	if isTerminal(run.status) {
+		for i, id := range s.finished {
+			if id == run.ID {
+				s.finished = append(s.finished[:i], s.finished[i+1:]...)
+				break
+			}
+		}
+	}
+	run.status = runRunning
+	run.err = ""
+	run.finishedAt = nil
+	return nil
+}
+
+// runStatus snapshots the externally visible state of a run
+func (s *BPOService) runStatus(run *workflowRun) WorkflowStatus {
+	s.inflightMu.Lock()
+	step := run.step
+	s.inflightMu.Unlock()
+
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	status := WorkflowStatus{
+		WorkflowID:        run.ID,
+		Event:             run.Event,
+		Definition:        run.Definition.Name,
+		DefinitionVersion: run.Definition.Version,
+		Status:            run.status,
+		CurrentStep:       step,
+		StartedAt:         run.StartedAt,
+		FinishedAt:        run.finishedAt,
+		Error:             run.err,
+	}
+	if run.approval != nil {
+		approval := *run.approval
+		status.Approval = &approval
+	}
+	// Step outputs are only stable once the run has finished
+	if isTerminal(run.status) {
+		status.CurrentStep = ""
+		status.DocumentURL = run.documentURL
+		if len(run.documents) > 0 {
+			status.Documents = run.documents
+		}
+	}
+	return status
+}
+
+// handleGetWorkflow reports the state of a workflow run
+func (s *BPOService) handleGetWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	run, ok := s.findRun(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "workflow_not_found", fmt.Sprintf("Workflow %s is not known", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.runStatus(run))
+}
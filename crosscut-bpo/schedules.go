@@ -0,0 +1,796 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/robfig/cron/v3"
+)
+
+// schedulerTick is how often the scheduler checks for due schedules and,
+// when it is not the leader, tries to take the lease
+const schedulerTick = time.Second
+
+// maxCatchUpRuns bounds how many missed occurrences run_all fires; older
+// ones are dropped and counted in the schedule_missed entry
+const maxCatchUpRuns = 50
+
+// schedulerActor identifies the scheduler in audit entries
+const schedulerActor = "scheduler"
+
+// errScheduleRunning is returned when a schedule fires while the workflow
+// it fired last is still running
+var errScheduleRunning = errors.New("previous run is still running")
+
+// schedule is a validated ScheduleConfig ready to compute occurrences
+type schedule struct {
+	ScheduleConfig
+	spec     cron.Schedule
+	location *time.Location
+}
+
+// compileSchedule parses a schedule's expression, zone and payload
+// templates. Errors name the offending field.
+func compileSchedule(cfg ScheduleConfig) (*schedule, error) {
+	if cfg.Cron == "" {
+		return nil, errors.New("cron: must not be empty")
+	}
+	spec, err := cron.ParseStandard(cfg.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("cron: %v", err)
+	}
+	location := time.UTC
+	if cfg.Timezone != "" {
+		if location, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("timezone: %v", err)
+		}
+	}
+	if cfg.TriggerEvent == "" {
+		return nil, errors.New("trigger_event: must not be empty")
+	}
+	switch cfg.MissedRuns {
+	case "", missedRunsSkip, missedRunsRunOnce, missedRunsRunAll:
+	default:
+		return nil, fmt.Errorf("missed_runs: %q is not one of %q, %q, %q", cfg.MissedRuns, missedRunsSkip, missedRunsRunOnce, missedRunsRunAll)
+	}
+	if _, err := renderPayload(cfg.Payload, payloadData{Schedule: cfg.Name}); err != nil {
+		return nil, fmt.Errorf("payload: %v", err)
+	}
+	return &schedule{ScheduleConfig: cfg, spec: spec, location: location}, nil
+}
+
+// next returns the first occurrence after t
+func (sc *schedule) next(t time.Time) time.Time {
+	return sc.spec.Next(t.In(sc.location))
+}
+
+// fingerprint changes whenever the schedule's timing changes
+func (sc *schedule) fingerprint() string {
+	return sc.Cron + " " + sc.location.String()
+}
+
+// compileSchedules compiles the configured schedules and checks that a
+// workflow handles each trigger event
+func compileSchedules(cfg SchedulerConfig, definitions *definitionRegistry) ([]*schedule, error) {
+	var problems []string
+	schedules := make([]*schedule, 0, len(cfg.Schedules))
+	for i, sc := range cfg.Schedules {
+		compiled, err := compileSchedule(sc)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("scheduler.schedules[%d].%v", i, err))
+			continue
+		}
+		if _, ok := definitions.byTrigger[sc.TriggerEvent]; !ok {
+			problems = append(problems, fmt.Sprintf("scheduler.schedules[%d].trigger_event: no workflow handles %q", i, sc.TriggerEvent))
+			continue
+		}
+		schedules = append(schedules, compiled)
+	}
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+	return schedules, nil
+}
+
+// payloadData is what payload templates are rendered with
+type payloadData struct {
+	Schedule    string
+	ScheduledAt time.Time
+	FiredAt     time.Time
+}
+
+// renderPayload renders every string in a payload template, including
+// those nested in maps and lists
+func renderPayload(payload map[string]interface{}, data payloadData) (map[string]interface{}, error) {
+	rendered := make(map[string]interface{}, len(payload))
+	for key, value := range payload {
+		out, err := renderPayloadValue(value, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		rendered[key] = out
+	}
+	return rendered, nil
+}
+
+// renderPayloadValue renders one payload value
+func renderPayloadValue(value interface{}, data payloadData) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		tmpl, err := template.New("payload").Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		return buf.String(), nil
+	case map[string]interface{}:
+		return renderPayload(v, data)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderPayloadValue(item, data)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// scheduleRecord is what the scheduler remembers about one schedule. It is
+// persisted to the state file so a restarted or newly elected replica
+// knows which occurrences were missed.
+type scheduleRecord struct {
+	LastScheduledAt *time.Time `json:"last_scheduled_at,omitempty"`
+	LastFiredAt     *time.Time `json:"last_fired_at,omitempty"`
+	LastWorkflowID  string     `json:"last_workflow_id,omitempty"`
+	Paused          bool       `json:"paused,omitempty"`
+	// ResumedAt is when the schedule was last resumed; occurrences before
+	// it were dropped while paused and are never caught up
+	ResumedAt *time.Time `json:"resumed_at,omitempty"`
+
+	// next is the next occurrence to fire, computed for fingerprint
+	next        time.Time
+	fingerprint string
+	// running is set while a workflow fired by the schedule executes
+	running bool
+}
+
+// scheduler fires configured schedules on the replica holding the lease
+type scheduler struct {
+	lease     *lease
+	statePath string
+
+	mu      sync.Mutex
+	leader  bool
+	records map[string]*scheduleRecord
+}
+
+// newScheduler creates the scheduler from the settings bound at startup
+func newScheduler(cfg SchedulerConfig) *scheduler {
+	return &scheduler{
+		lease:     newLease(cfg.LeasePath),
+		statePath: cfg.StatePath,
+		records:   make(map[string]*scheduleRecord),
+	}
+}
+
+// record returns the record of a schedule, creating it if needed. The
+// caller holds mu.
+func (sch *scheduler) record(name string) *scheduleRecord {
+	rec, ok := sch.records[name]
+	if !ok {
+		rec = &scheduleRecord{}
+		sch.records[name] = rec
+	}
+	return rec
+}
+
+// isLeader reports whether this replica fires schedules
+func (sch *scheduler) isLeader() bool {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	return sch.leader
+}
+
+// loadState reads the persisted schedule records. A missing file is an
+// empty state.
+func (sch *scheduler) loadState() error {
+	if sch.statePath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(sch.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read scheduler state: %w", err)
+	}
+	var records map[string]*scheduleRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("failed to decode scheduler state: %w", err)
+	}
+
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	for name, loaded := range records {
+		rec := sch.record(name)
+		rec.LastScheduledAt = loaded.LastScheduledAt
+		rec.LastFiredAt = loaded.LastFiredAt
+		rec.LastWorkflowID = loaded.LastWorkflowID
+		rec.Paused = loaded.Paused
+		rec.ResumedAt = loaded.ResumedAt
+	}
+	return nil
+}
+
+// saveState persists the schedule records, replacing the state file
+// atomically so a crash never leaves it half written. Only the leader
+// writes it. The caller holds mu.
+func (sch *scheduler) saveState() {
+	if sch.statePath == "" || !sch.leader {
+		return
+	}
+	data, err := json.MarshalIndent(sch.records, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode scheduler state: %v", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(sch.statePath), filepath.Base(sch.statePath)+".*.tmp")
+	if err != nil {
+		log.Printf("Failed to write scheduler state: %v", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), sch.statePath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("Failed to write scheduler state: %v", err)
+	}
+}
+
+// firing is one occurrence of a schedule that is due
+type firing struct {
+	schedule    *schedule
+	scheduledAt time.Time
+	// catchUp marks an occurrence fired late under the missed-run policy
+	catchUp bool
+}
+
+// runScheduler fires due schedules until ctx is cancelled. Replicas that do
+// not hold the lease keep trying to take it over.
+func (s *BPOService) runScheduler(ctx context.Context) {
+	sch := s.scheduler
+	defer sch.lease.release()
+
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+	for {
+		if !sch.isLeader() && s.becomeLeader() {
+			log.Printf("Scheduler: this replica fires schedules (%s)", sch.lease.identity)
+		}
+		if sch.isLeader() && !s.isDraining() {
+			s.fireDue(s.dueFirings(time.Now()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// becomeLeader takes the lease if it is free and loads the state the
+// previous leader left behind
+func (s *BPOService) becomeLeader() bool {
+	sch := s.scheduler
+	acquired, err := sch.lease.acquire()
+	if err != nil {
+		log.Printf("Scheduler: failed to take lease: %v", err)
+		return false
+	}
+	if !acquired {
+		return false
+	}
+	if err := sch.loadState(); err != nil {
+		log.Printf("Scheduler: %v; starting without history", err)
+	}
+	sch.mu.Lock()
+	sch.leader = true
+	sch.mu.Unlock()
+	return true
+}
+
+// dueFirings advances every active schedule to now and returns the
+// occurrences to fire. A schedule seen for the first time, or whose timing
+// changed, starts from now; one with history applies its missed-run policy
+// to the occurrences that passed while no replica was firing.
+func (s *BPOService) dueFirings(now time.Time) []firing {
+	sch := s.scheduler
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	var due []firing
+	changed := false
+	for _, sc := range s.current().schedules {
+		rec := sch.record(sc.Name)
+		if rec.fingerprint != sc.fingerprint() {
+			first := rec.fingerprint == "" && rec.LastScheduledAt != nil
+			rec.fingerprint = sc.fingerprint()
+			rec.next = sc.next(now)
+			if first && !rec.Paused {
+				last := *rec.LastScheduledAt
+				if rec.ResumedAt != nil && rec.ResumedAt.After(last) {
+					last = *rec.ResumedAt
+				}
+				due = append(due, s.missedFirings(sc, last, now)...)
+			}
+			continue
+		}
+		if now.Before(rec.next) {
+			continue
+		}
+		scheduledAt := rec.next
+		rec.next = sc.next(now)
+		if rec.Paused {
+			// Occurrences while paused are dropped, not caught up later
+			continue
+		}
+		due = append(due, firing{schedule: sc, scheduledAt: scheduledAt})
+		changed = true
+	}
+	if changed {
+		sch.saveState()
+	}
+	return due
+}
+
+// missedFirings applies a schedule's missed-run policy to the occurrences
+// after last and up to now
+func (s *BPOService) missedFirings(sc *schedule, last, now time.Time) []firing {
+	var missed []time.Time
+	var first time.Time
+	total := 0
+	for t := sc.next(last); !t.After(now); t = sc.next(t) {
+		if total == 0 {
+			first = t
+		}
+		total++
+		missed = append(missed, t)
+		if len(missed) > maxCatchUpRuns {
+			missed = missed[1:]
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	details := map[string]interface{}{
+		"missed_runs":    total,
+		"policy":         sc.MissedRuns,
+		"last_scheduled": last,
+		"first_missed":   first,
+		"latest_missed":  missed[len(missed)-1],
+	}
+	if sc.MissedRuns == missedRunsRunAll && total > len(missed) {
+		details["dropped_runs"] = total - len(missed)
+	}
+	log.Printf("Scheduler: %s missed %d run(s) since %s, policy %s", sc.Name, total, last.Format(time.RFC3339), sc.MissedRuns)
+	s.auditSchedule(sc.Name, "schedule_missed", "missed", details, nil)
+
+	var firings []firing
+	switch sc.MissedRuns {
+	case missedRunsRunOnce:
+		firings = append(firings, firing{schedule: sc, scheduledAt: missed[len(missed)-1], catchUp: true})
+	case missedRunsRunAll:
+		for _, t := range missed {
+			firings = append(firings, firing{schedule: sc, scheduledAt: t, catchUp: true})
+		}
+	}
+	return firings
+}
+
+// fireDue fires the occurrences returned by dueFirings. Catch-up
+// occurrences of a schedule run one after another in the background, each
+// waiting for the previous workflow to finish.
+func (s *BPOService) fireDue(due []firing) {
+	var catchUps [][]firing
+	bySchedule := make(map[string]int)
+	for _, f := range due {
+		if !f.catchUp {
+			s.fireSchedule(f, schedulerActor)
+			continue
+		}
+		i, ok := bySchedule[f.schedule.Name]
+		if !ok {
+			i = len(catchUps)
+			bySchedule[f.schedule.Name] = i
+			catchUps = append(catchUps, nil)
+		}
+		catchUps[i] = append(catchUps[i], f)
+	}
+	for _, firings := range catchUps {
+		if err := s.claimSchedule(firings[0], schedulerActor); err != nil {
+			continue
+		}
+		go s.catchUp(firings)
+	}
+}
+
+// fireSchedule triggers the schedule's workflow for one occurrence and runs
+// it in the background. A schedule whose previous workflow is still running
+// is skipped rather than run twice at once.
+func (s *BPOService) fireSchedule(f firing, actor string) (*workflowRun, error) {
+	if err := s.claimSchedule(f, actor); err != nil {
+		return nil, err
+	}
+	run, err := s.startFiring(f, actor)
+	if err != nil {
+		s.releaseSchedule(f.schedule)
+		return nil, err
+	}
+	go func() {
+		s.finishFiring(run)
+		s.releaseSchedule(f.schedule)
+	}()
+	return run, nil
+}
+
+// catchUp fires missed occurrences in order, holding the schedule for the
+// whole sequence so they neither overlap each other nor a regular firing.
+// The caller has claimed the schedule.
+func (s *BPOService) catchUp(firings []firing) {
+	defer s.releaseSchedule(firings[0].schedule)
+	for _, f := range firings {
+		run, err := s.startFiring(f, schedulerActor)
+		if errors.Is(err, errShuttingDown) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		s.finishFiring(run)
+	}
+}
+
+// firingDetails describes an occurrence in audit entries
+func firingDetails(f firing, actor string) map[string]interface{} {
+	details := map[string]interface{}{
+		"schedule":      f.schedule.Name,
+		"scheduled_at":  f.scheduledAt,
+		"trigger_event": f.schedule.TriggerEvent,
+		"actor":         actor,
+	}
+	if f.catchUp {
+		details["catch_up"] = true
+	}
+	return details
+}
+
+// claimSchedule marks a schedule as running, or records the occurrence as
+// skipped when the workflow it fired last is still running
+func (s *BPOService) claimSchedule(f firing, actor string) error {
+	sch := s.scheduler
+	sc := f.schedule
+	sch.mu.Lock()
+	rec := sch.record(sc.Name)
+	if rec.running {
+		sch.mu.Unlock()
+		err := fmt.Errorf("%w: %s", errScheduleRunning, rec.LastWorkflowID)
+		log.Printf("Scheduler: skipping %s: %v", sc.Name, err)
+		s.auditSchedule(sc.Name, "schedule_skipped", "skipped", firingDetails(f, actor), err)
+		return err
+	}
+	rec.running = true
+	sch.mu.Unlock()
+	return nil
+}
+
+// releaseSchedule lets a schedule fire again
+func (s *BPOService) releaseSchedule(sc *schedule) {
+	sch := s.scheduler
+	sch.mu.Lock()
+	sch.record(sc.Name).running = false
+	sch.mu.Unlock()
+}
+
+// startFiring starts the workflow for one occurrence of a claimed schedule
+// and records it as the schedule's last firing
+func (s *BPOService) startFiring(f firing, actor string) (*workflowRun, error) {
+	sch := s.scheduler
+	sc := f.schedule
+	firedAt := time.Now()
+	details := firingDetails(f, actor)
+
+	run, err := s.startScheduledRun(sc, f.scheduledAt, firedAt)
+	if err != nil {
+		log.Printf("Scheduler: %s failed to fire: %v", sc.Name, err)
+		s.auditSchedule(sc.Name, "schedule_failed", "failed", details, err)
+		return nil, err
+	}
+
+	sch.mu.Lock()
+	rec := sch.record(sc.Name)
+	rec.LastScheduledAt = &f.scheduledAt
+	rec.LastFiredAt = &firedAt
+	rec.LastWorkflowID = run.ID
+	sch.saveState()
+	sch.mu.Unlock()
+
+	log.Printf("Scheduler: %s fired workflow %s for %s", sc.Name, run.ID, f.scheduledAt.Format(time.RFC3339))
+	s.auditRun(run, "schedule_fired", "success", details, nil)
+	return run, nil
+}
+
+// finishFiring executes a workflow started by startFiring to its end
+func (s *BPOService) finishFiring(run *workflowRun) {
+	_, err := s.executeRun(run.ctx, run)
+	s.endWorkflow(run, err)
+	if err != nil {
+		log.Printf("Scheduled workflow %s failed: %v", run.ID, err)
+	}
+}
+
+// startScheduledRun renders the schedule's payload and registers the run
+func (s *BPOService) startScheduledRun(sc *schedule, scheduledAt, firedAt time.Time) (*workflowRun, error) {
+	payload, err := renderPayload(sc.Payload, payloadData{
+		Schedule:    sc.Name,
+		ScheduledAt: scheduledAt.In(sc.location),
+		FiredAt:     firedAt.In(sc.location),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render payload: %w", err)
+	}
+	run, err := s.newRun(sc.TriggerEvent, payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.beginWorkflow(run); err != nil {
+		return nil, err
+	}
+	s.trackRun(run)
+	return run, nil
+}
+
+// auditSchedule writes an audit entry about a schedule rather than a run
+func (s *BPOService) auditSchedule(name, action, status string, details map[string]interface{}, scheduleErr error) {
+	entry := AuditEntry{
+		Timestamp: time.Now(),
+		Event:     "schedule",
+		Action:    action,
+		Status:    status,
+		Details:   map[string]interface{}{"schedule": name},
+	}
+	for key, value := range details {
+		entry.Details[key] = value
+	}
+	if scheduleErr != nil {
+		entry.Error = scheduleErr.Error()
+	}
+	if err := s.writeAuditEntry(entry); err != nil {
+		log.Printf("Failed to write audit entry: %v", err)
+	}
+}
+
+// ScheduleInfo describes a schedule for the admin API
+type ScheduleInfo struct {
+	Name            string                 `json:"name"`
+	Cron            string                 `json:"cron"`
+	Timezone        string                 `json:"timezone"`
+	TriggerEvent    string                 `json:"trigger_event"`
+	Payload         map[string]interface{} `json:"payload,omitempty"`
+	MissedRuns      string                 `json:"missed_runs"`
+	Paused          bool                   `json:"paused"`
+	Running         bool                   `json:"running"`
+	NextRunAt       *time.Time             `json:"next_run_at,omitempty"`
+	LastScheduledAt *time.Time             `json:"last_scheduled_at,omitempty"`
+	LastFiredAt     *time.Time             `json:"last_fired_at,omitempty"`
+	LastWorkflowID  string                 `json:"last_workflow_id,omitempty"`
+	LastStatus      string                 `json:"last_status,omitempty"`
+}
+
+// ScheduleList is the response of GET /v1/admin/schedules
+type ScheduleList struct {
+	// Leader reports whether the replica answering fires schedules;
+	// LeaseHolder names the replica that does
+	Leader      bool           `json:"leader"`
+	LeaseHolder string         `json:"lease_holder,omitempty"`
+	Schedules   []ScheduleInfo `json:"schedules"`
+}
+
+// findSchedule returns a configured schedule by name
+func (s *BPOService) findSchedule(name string) (*schedule, bool) {
+	for _, sc := range s.current().schedules {
+		if sc.Name == name {
+			return sc, true
+		}
+	}
+	return nil, false
+}
+
+// describeSchedule reports a schedule's configuration and history
+func (s *BPOService) describeSchedule(sc *schedule) ScheduleInfo {
+	info := ScheduleInfo{
+		Name:         sc.Name,
+		Cron:         sc.Cron,
+		Timezone:     sc.location.String(),
+		TriggerEvent: sc.TriggerEvent,
+		Payload:      sc.Payload,
+		MissedRuns:   sc.MissedRuns,
+	}
+
+	sch := s.scheduler
+	sch.mu.Lock()
+	if rec, ok := sch.records[sc.Name]; ok {
+		info.Paused = rec.Paused
+		info.Running = rec.running
+		info.LastScheduledAt = rec.LastScheduledAt
+		info.LastFiredAt = rec.LastFiredAt
+		info.LastWorkflowID = rec.LastWorkflowID
+		if rec.fingerprint == sc.fingerprint() && !rec.Paused {
+			next := rec.next
+			info.NextRunAt = &next
+		}
+	}
+	sch.mu.Unlock()
+
+	if info.NextRunAt == nil && !info.Paused {
+		next := sc.next(time.Now())
+		info.NextRunAt = &next
+	}
+	if info.LastWorkflowID != "" {
+		if run, ok := s.findRun(info.LastWorkflowID); ok {
+			info.LastStatus = s.runStatus(run).Status
+		}
+	}
+	return info
+}
+
+// refreshState shows the leader's history on replicas that do not fire
+// schedules themselves
+func (s *BPOService) refreshState() {
+	if s.scheduler.isLeader() {
+		return
+	}
+	if err := s.scheduler.loadState(); err != nil {
+		log.Printf("Scheduler: %v", err)
+	}
+}
+
+// handleListSchedules serves GET /v1/admin/schedules
+func (s *BPOService) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	s.refreshState()
+	schedules := s.current().schedules
+	list := ScheduleList{
+		Leader:      s.scheduler.isLeader(),
+		LeaseHolder: s.scheduler.lease.holder(),
+		Schedules:   make([]ScheduleInfo, 0, len(schedules)),
+	}
+	for _, sc := range schedules {
+		list.Schedules = append(list.Schedules, s.describeSchedule(sc))
+	}
+	sort.Slice(list.Schedules, func(i, j int) bool {
+		return list.Schedules[i].Name < list.Schedules[j].Name
+	})
+	writeJSON(w, http.StatusOK, list)
+}
+
+// scheduleFromRequest resolves the schedule named in the URL, writing the
+// error response itself when it is not configured
+func (s *BPOService) scheduleFromRequest(w http.ResponseWriter, r *http.Request) (*schedule, bool) {
+	name := chi.URLParam(r, "name")
+	sc, ok := s.findSchedule(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "schedule_not_found", fmt.Sprintf("Schedule %s is not configured", name))
+	}
+	return sc, ok
+}
+
+// handleGetSchedule serves GET /v1/admin/schedules/{name}
+func (s *BPOService) handleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	sc, ok := s.scheduleFromRequest(w, r)
+	if !ok {
+		return
+	}
+	s.refreshState()
+	writeJSON(w, http.StatusOK, s.describeSchedule(sc))
+}
+
+// handleRunSchedule fires a schedule immediately, outside its cron timing.
+// Only the replica firing schedules accepts it, so the overlap guard and
+// the recorded history stay in one place.
+func (s *BPOService) handleRunSchedule(w http.ResponseWriter, r *http.Request) {
+	sc, ok := s.scheduleFromRequest(w, r)
+	if !ok {
+		return
+	}
+	sch := s.scheduler
+	if !sch.isLeader() {
+		writeError(w, http.StatusConflict, "not_leader", fmt.Sprintf("schedules are managed by %s", sch.lease.holder()))
+		return
+	}
+	actor := callerFromContext(r.Context())
+	run, err := s.fireSchedule(firing{schedule: sc, scheduledAt: time.Now()}, actor)
+	switch {
+	case errors.Is(err, errShuttingDown):
+		writeError(w, http.StatusServiceUnavailable, "shutting_down", err.Error())
+		return
+	case errors.Is(err, errScheduleRunning):
+		writeError(w, http.StatusConflict, "schedule_running", err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "schedule_failed", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, WorkflowResponse{
+		Status:     runRunning,
+		WorkflowID: run.ID,
+		Message:    fmt.Sprintf("Schedule %s fired by %s", sc.Name, actor),
+	})
+}
+
+// handlePauseSchedule pauses (POST) or resumes (DELETE) a schedule.
+// Occurrences while paused are dropped. The decision is persisted with the
+// scheduler state, so only the replica firing schedules accepts it.
+func (s *BPOService) handlePauseSchedule(w http.ResponseWriter, r *http.Request) {
+	sc, ok := s.scheduleFromRequest(w, r)
+	if !ok {
+		return
+	}
+	sch := s.scheduler
+	if !sch.isLeader() {
+		writeError(w, http.StatusConflict, "not_leader", fmt.Sprintf("schedules are managed by %s", sch.lease.holder()))
+		return
+	}
+
+	paused := r.Method == http.MethodPost
+	action := "schedule_paused"
+	if !paused {
+		action = "schedule_resumed"
+	}
+
+	now := time.Now()
+	sch.mu.Lock()
+	rec := sch.record(sc.Name)
+	rec.Paused = paused
+	// Resuming starts from the next occurrence, not those passed while
+	// paused, including after a restart
+	rec.next = sc.next(now)
+	rec.fingerprint = sc.fingerprint()
+	if !paused {
+		rec.ResumedAt = &now
+	}
+	sch.saveState()
+	sch.mu.Unlock()
+
+	actor := callerFromContext(r.Context())
+	log.Printf("%s %s by %s", action, sc.Name, actor)
+	s.auditSchedule(sc.Name, action, "success", map[string]interface{}{
+		"actor": actor,
+	}, nil)
+	writeJSON(w, http.StatusOK, s.describeSchedule(sc))
+}
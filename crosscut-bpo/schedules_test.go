@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"crosscut-contracts/bpo"
+)
+
+// hourlyRouter is the schedule the scheduler tests fire
+const hourlyRouter = "hourly-router"
+
+// scheduleHarness starts the services with hourlyRouter configured under
+// the given missed-run policy. The scheduler loop does not run; tests
+// drive it through dueFirings and fireDue with the time they choose.
+func scheduleHarness(t *testing.T, missedRuns, leasePath, statePath string) *harness {
+	t.Helper()
+	return newHarness(t, func(cfg *Config) {
+		cfg.Scheduler = SchedulerConfig{
+			LeasePath: leasePath,
+			StatePath: statePath,
+			Schedules: []ScheduleConfig{{
+				Name:         hourlyRouter,
+				Cron:         "@every 1h",
+				TriggerEvent: "schematic.released",
+				Payload:      routerRelease,
+				MissedRuns:   missedRuns,
+			}},
+		}
+	})
+}
+
+// writeScheduleState writes a scheduler state file holding rec for
+// hourlyRouter
+func writeScheduleState(t *testing.T, path string, rec scheduleRecord) {
+	t.Helper()
+	data, err := json.Marshal(map[string]scheduleRecord{hourlyRouter: rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, string(data))
+}
+
+// lead makes the harness's service the replica firing schedules
+func (h *harness) lead() {
+	h.t.Helper()
+	if !h.service.becomeLeader() {
+		h.t.Fatal("failed to take the scheduler lease")
+	}
+}
+
+// scheduleEntries returns the audit entries with action, in order
+func (h *harness) scheduleEntries(action string) []AuditEntry {
+	h.t.Helper()
+	var entries []AuditEntry
+	for _, entry := range h.auditLog() {
+		if entry.Action == action {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// scheduleRunning reports whether hourlyRouter's last workflow is running
+func (h *harness) scheduleRunning() bool {
+	sch := h.service.scheduler
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	return sch.record(hourlyRouter).running
+}
+
+// scheduledAt returns the occurrence a schedule_fired entry stands for
+func scheduledAt(t *testing.T, entry AuditEntry) time.Time {
+	t.Helper()
+	at, err := time.Parse(time.RFC3339Nano, entry.Details["scheduled_at"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return at
+}
+
+func TestScheduleMissedRuns(t *testing.T) {
+	now := time.Now()
+	last := now.Add(-3*time.Hour - 30*time.Minute)
+	missed := []time.Time{last.Add(time.Hour), last.Add(2 * time.Hour), last.Add(3 * time.Hour)}
+
+	for _, tt := range []struct {
+		policy string
+		want   []time.Time
+	}{
+		{missedRunsSkip, nil},
+		{missedRunsRunOnce, missed[2:]},
+		{missedRunsRunAll, missed},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			statePath := filepath.Join(t.TempDir(), "state.json")
+			writeScheduleState(t, statePath, scheduleRecord{LastScheduledAt: &last})
+			h := scheduleHarness(t, tt.policy, "", statePath)
+			h.lead()
+
+			h.service.fireDue(h.service.dueFirings(now))
+			h.eventually("catch-up runs to finish", func() bool {
+				return len(h.scheduleEntries("schedule_fired")) == len(tt.want) && !h.scheduleRunning()
+			})
+
+			entries := h.scheduleEntries("schedule_missed")
+			if len(entries) != 1 {
+				t.Fatalf("%d schedule_missed entries, want 1", len(entries))
+			}
+			if got := entries[0].Details["missed_runs"]; got != float64(3) {
+				t.Errorf("missed_runs = %v, want 3", got)
+			}
+			fired := h.scheduleEntries("schedule_fired")
+			for i, entry := range fired {
+				if at := scheduledAt(t, entry); !at.Equal(tt.want[i].Truncate(time.Second)) {
+					t.Errorf("firing %d is for %s, want %s", i, at, tt.want[i])
+				}
+				if entry.Details["catch_up"] != true {
+					t.Errorf("firing %d is not marked catch_up", i)
+				}
+				if status := h.status(entry.WorkflowID).Status; status != runCompleted {
+					t.Errorf("workflow %s is %s, want %s", entry.WorkflowID, status, runCompleted)
+				}
+			}
+			if skipped := h.scheduleEntries("schedule_skipped"); len(skipped) != 0 {
+				t.Errorf("%d catch-up runs skipped, want none", len(skipped))
+			}
+		})
+	}
+}
+
+func TestScheduleRunAllRunsOneAtATime(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	now := time.Now()
+	last := now.Add(-3*time.Hour - 30*time.Minute)
+	writeScheduleState(t, statePath, scheduleRecord{LastScheduledAt: &last})
+	h := scheduleHarness(t, missedRunsRunAll, "", statePath)
+	h.lead()
+
+	held := h.hold("docgen", http.MethodPost, "/generate")
+	h.service.fireDue(h.service.dueFirings(now))
+	held.wait()
+
+	// The next occurrence waits for the first workflow instead of being
+	// skipped as an overlap
+	time.Sleep(50 * time.Millisecond)
+	if fired := h.scheduleEntries("schedule_fired"); len(fired) != 1 {
+		t.Fatalf("%d occurrences fired while the first was running, want 1", len(fired))
+	}
+	h.inflightID()
+
+	held.release()
+	h.eventually("all catch-up runs to finish", func() bool {
+		return len(h.scheduleEntries("schedule_fired")) == 3 && !h.scheduleRunning()
+	})
+	if skipped := h.scheduleEntries("schedule_skipped"); len(skipped) != 0 {
+		t.Errorf("%d catch-up runs skipped, want none", len(skipped))
+	}
+	var previous time.Time
+	for _, entry := range h.scheduleEntries("schedule_fired") {
+		at := scheduledAt(t, entry)
+		if !at.After(previous) {
+			t.Errorf("occurrence %s fired after %s", at, previous)
+		}
+		previous = at
+	}
+}
+
+func TestScheduleReportsDroppedCatchUpRuns(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	now := time.Now()
+	last := now.Add(-60*time.Hour - 30*time.Minute)
+	writeScheduleState(t, statePath, scheduleRecord{LastScheduledAt: &last})
+	h := scheduleHarness(t, missedRunsRunAll, "", statePath)
+	h.lead()
+
+	due := h.service.dueFirings(now)
+	if len(due) != maxCatchUpRuns {
+		t.Fatalf("%d catch-up runs due, want %d", len(due), maxCatchUpRuns)
+	}
+	// The latest occurrences are kept
+	if want := last.Add(60 * time.Hour).Truncate(time.Second); !due[len(due)-1].scheduledAt.Equal(want) {
+		t.Errorf("latest catch-up run is for %s, want %s", due[len(due)-1].scheduledAt, want)
+	}
+
+	entry := h.scheduleEntries("schedule_missed")[0]
+	if got := entry.Details["missed_runs"]; got != float64(60) {
+		t.Errorf("missed_runs = %v, want 60", got)
+	}
+	if got := entry.Details["dropped_runs"]; got != float64(60-maxCatchUpRuns) {
+		t.Errorf("dropped_runs = %v, want %d", got, 60-maxCatchUpRuns)
+	}
+	first, err := time.Parse(time.RFC3339Nano, entry.Details["first_missed"].(string))
+	if err != nil || !first.Equal(last.Add(time.Hour).Truncate(time.Second)) {
+		t.Errorf("first_missed = %v, want %s", entry.Details["first_missed"], last.Add(time.Hour))
+	}
+}
+
+func TestScheduleSkipsOverlappingOccurrence(t *testing.T) {
+	h := scheduleHarness(t, missedRunsSkip, "", "")
+	h.lead()
+	ctx := context.Background()
+
+	held := h.hold("docgen", http.MethodPost, "/generate")
+	started, err := bpo.Decode[bpo.WorkflowResponse](h.client.RunSchedule(ctx, hourlyRouter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	held.wait()
+
+	// The cron occurrence that comes due meanwhile is skipped
+	now := time.Now()
+	h.service.dueFirings(now)
+	if due := h.service.dueFirings(now.Add(time.Hour)); len(due) != 1 {
+		t.Fatalf("%d occurrences due, want 1", len(due))
+	} else {
+		h.service.fireDue(due)
+	}
+	skipped := h.scheduleEntries("schedule_skipped")
+	if len(skipped) != 1 {
+		t.Fatalf("%d schedule_skipped entries, want 1", len(skipped))
+	}
+	if skipped[0].Error != errScheduleRunning.Error()+": "+started.WorkflowID {
+		t.Errorf("skipped because %q", skipped[0].Error)
+	}
+
+	// So is a manual run
+	_, err = bpo.Decode[bpo.WorkflowResponse](h.client.RunSchedule(ctx, hourlyRouter))
+	var apiErr *bpo.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict || apiErr.Code != "schedule_running" {
+		t.Errorf("run while running: error = %v, want 409 schedule_running", err)
+	}
+
+	held.release()
+	h.eventually("the run to finish", func() bool { return !h.scheduleRunning() })
+	if fired := h.scheduleEntries("schedule_fired"); len(fired) != 1 || fired[0].WorkflowID != started.WorkflowID {
+		t.Errorf("fired %+v, want only %s", fired, started.WorkflowID)
+	}
+	if _, err := bpo.Decode[bpo.WorkflowResponse](h.client.RunSchedule(ctx, hourlyRouter)); err != nil {
+		t.Errorf("run once the previous finished: %v", err)
+	}
+}
+
+func TestScheduleResumeDoesNotCatchUpPausedOccurrences(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	last := time.Now().Add(-10 * time.Hour)
+	writeScheduleState(t, statePath, scheduleRecord{LastScheduledAt: &last, Paused: true})
+	h := scheduleHarness(t, missedRunsRunAll, "", statePath)
+	h.lead()
+	ctx := context.Background()
+
+	if due := h.service.dueFirings(time.Now()); len(due) != 0 {
+		t.Fatalf("%d occurrences due while paused, want none", len(due))
+	}
+	info, err := bpo.Decode[bpo.ScheduleInfo](h.client.ResumeSchedule(ctx, hourlyRouter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Paused {
+		t.Fatal("schedule still paused")
+	}
+
+	// After a restart, only occurrences since the resume are caught up
+	h.service.scheduler = newScheduler(h.service.current().config.Scheduler)
+	h.lead()
+	resumedAt := *h.service.scheduler.records[hourlyRouter].ResumedAt
+	due := h.service.dueFirings(resumedAt.Add(90 * time.Minute))
+	if len(due) != 1 {
+		t.Fatalf("%d occurrences due after the restart, want 1", len(due))
+	}
+	if want := resumedAt.Add(time.Hour).Truncate(time.Second); !due[0].scheduledAt.Equal(want) {
+		t.Errorf("caught up %s, want %s", due[0].scheduledAt, want)
+	}
+}
+
+func TestScheduleLeaderLease(t *testing.T) {
+	leasePath := filepath.Join(t.TempDir(), "scheduler.lease")
+	first := scheduleHarness(t, missedRunsSkip, leasePath, "")
+	second := scheduleHarness(t, missedRunsSkip, leasePath, "")
+	ctx := context.Background()
+
+	first.lead()
+	if second.service.becomeLeader() {
+		t.Fatal("second replica took a lease that is held")
+	}
+	list, err := bpo.Decode[bpo.ScheduleList](second.client.ListSchedules(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Leader || list.LeaseHolder == "" {
+		t.Errorf("second replica reports leader %t, holder %q", list.Leader, list.LeaseHolder)
+	}
+
+	// Only the leader fires or pauses schedules
+	var apiErr *bpo.Error
+	if _, err := bpo.Decode[bpo.WorkflowResponse](second.client.RunSchedule(ctx, hourlyRouter)); !errors.As(err, &apiErr) || apiErr.Code != "not_leader" {
+		t.Errorf("run on a follower: error = %v, want 409 not_leader", err)
+	}
+	if _, err := bpo.Decode[bpo.ScheduleInfo](second.client.PauseSchedule(ctx, hourlyRouter)); !errors.As(err, &apiErr) || apiErr.Code != "not_leader" {
+		t.Errorf("pause on a follower: error = %v, want 409 not_leader", err)
+	}
+
+	// The lease passes on once the leader gives it up
+	first.service.scheduler.lease.release()
+	if !second.service.becomeLeader() {
+		t.Fatal("second replica did not take the released lease")
+	}
+	started, err := bpo.Decode[bpo.WorkflowResponse](second.client.RunSchedule(ctx, hourlyRouter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.eventually("the run to finish", func() bool { return !second.scheduleRunning() })
+	if status := second.status(started.WorkflowID).Status; status != runCompleted {
+		t.Errorf("workflow %s is %s, want %s", started.WorkflowID, status, runCompleted)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// sorClient calls a System of Record with the configured timeout and retries
+type sorClient struct {
+	name    string
+	baseURL string
+	client  *http.Client
+	retry   RetryConfig
+}
+
+// newSoRClients builds a client for every configured SoR
+func newSoRClients(cfg *Config) map[string]*sorClient {
+	clients := make(map[string]*sorClient, len(cfg.SoRs))
+	for name, sor := range cfg.SoRs {
+		clients[name] = &sorClient{
+			name:    name,
+			baseURL: sor.URL,
+			client:  &http.Client{Timeout: time.Duration(sor.Timeout)},
+			retry:   cfg.retryFor(name),
+		}
+	}
+	return clients
+}
+
+// retryableStatus reports whether a response status is worth retrying
+func retryableStatus(code int) bool {
+	return code == http.StatusBadGateway ||
+		code == http.StatusServiceUnavailable ||
+		code == http.StatusGatewayTimeout
+}
+
+// postJSON posts a JSON body to path, retrying transport failures and
+// gateway errors with exponential backoff. It aborts if ctx is cancelled.
+func (c *sorClient) postJSON(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	return c.do(ctx, http.MethodPost, path, body)
+}
+
+// get sends a GET to path with the same retry policy as postJSON
+func (c *sorClient) get(ctx context.Context, path string) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, path, nil)
+}
+
+// delete sends a DELETE to path with the same retry policy as postJSON
+func (c *sorClient) delete(ctx context.Context, path string) (*http.Response, error) {
+	return c.do(ctx, http.MethodDelete, path, nil)
+}
+
+// do sends a request with an optional JSON body, retrying transport
+// failures and gateway errors with exponential backoff
+func (c *sorClient) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	url := c.baseURL + path
+	backoff := time.Duration(c.retry.InitialBackoff)
+
+	var lastErr error
+	for attempt := 1; attempt <= c.retry.MaxAttempts; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, reader)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.client.Do(req)
+		switch {
+		case err != nil:
+			lastErr = err
+		case retryableStatus(resp.StatusCode) && attempt < c.retry.MaxAttempts:
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			lastErr = fmt.Errorf("%s returned %d", c.name, resp.StatusCode)
+		default:
+			return resp, nil
+		}
+
+		if attempt == c.retry.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+		log.Printf("%s call to %s failed (attempt %d/%d), retrying in %s: %v",
+			c.name, path, attempt, c.retry.MaxAttempts, backoff, lastErr)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+		if limit := time.Duration(c.retry.MaxBackoff); backoff > limit {
+			backoff = limit
+		}
+	}
+
+	return nil, lastErr
+}
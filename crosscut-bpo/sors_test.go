@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"crosscut-contracts"
+	"github.com/go-chi/chi/v5"
+)
+
+// The harness serves PLM and DocGen from the fakes below rather than the
+// mocks, so the BPO module does not depend on them. The fakes answer the
+// requests the BPO makes as the mocks do; the mocks' tests replay the
+// contracts recorded in testdata/contracts to keep the two in line, and the
+// e2e module runs the BPO against the mocks themselves.
+
+// plmProduct is a product held by the fake PLM, in the form of
+// data/plm-data.json. Voltage and Components belong to the current
+// revision, Revision; earlier revisions keep their own.
+type plmProduct struct {
+	Name       string             `json:"name"`
+	Voltage    string             `json:"voltage"`
+	Revision   string             `json:"revision"`
+	Components []ProductComponent `json:"components"`
+	Revisions  []plmRevision      `json:"revisions,omitempty"`
+}
+
+// plmRevision is an earlier revision of a product
+type plmRevision struct {
+	Revision   string             `json:"revision"`
+	Voltage    string             `json:"voltage"`
+	Components []ProductComponent `json:"components"`
+}
+
+// fakePLM serves products, their revisions and release statuses
+type fakePLM struct {
+	chi.Router
+
+	mu       sync.Mutex
+	products map[string]plmProduct
+	statuses map[string]contracts.ReleaseStatus
+}
+
+// newFakePLM starts the fake PLM with the products of data/plm-data.json
+func newFakePLM(t *testing.T) *fakePLM {
+	t.Helper()
+	data, err := os.ReadFile("../data/plm-data.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Products []plmProduct `json:"products"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("decoding PLM data: %v", err)
+	}
+
+	plm := &fakePLM{
+		Router:   chi.NewRouter(),
+		products: make(map[string]plmProduct),
+		statuses: make(map[string]contracts.ReleaseStatus),
+	}
+	for _, product := range file.Products {
+		plm.products[product.Name] = product
+	}
+	plm.routes()
+	return plm
+}
+
+// add adds or replaces a product
+func (p *fakePLM) add(product plmProduct) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.products[product.Name] = product
+}
+
+// revision finds a revision of a product, "" being the current one. It
+// returns the error code PLM answers with if there is none.
+func (p *fakePLM) revision(name, rev string) (ProductRevision, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	product, ok := p.products[name]
+	if !ok {
+		return ProductRevision{}, "product_not_found"
+	}
+	revision := ProductRevision{
+		Product:    product.Name,
+		Revision:   product.Revision,
+		Current:    true,
+		Voltage:    product.Voltage,
+		Components: product.Components,
+	}
+	if rev != "" && rev != product.Revision {
+		found := false
+		for _, earlier := range product.Revisions {
+			if earlier.Revision == rev {
+				revision = ProductRevision{
+					Product:    product.Name,
+					Revision:   earlier.Revision,
+					Voltage:    earlier.Voltage,
+					Components: earlier.Components,
+				}
+				found = true
+			}
+		}
+		if !found {
+			return ProductRevision{}, "revision_not_found"
+		}
+	}
+	if revision.Components == nil {
+		revision.Components = []ProductComponent{}
+	}
+	return revision, ""
+}
+
+// enrich resolves the voltage and test type of each component of a
+// template plan from the revision it names. Components PLM does not list
+// have the test type "unknown" and, like unresolved voltages, the
+// product's voltage.
+func (p *fakePLM) enrich(template TemplatePlan) (EnrichedPlan, string) {
+	revision, code := p.revision(template.Product, template.Revision)
+	if code != "" {
+		return EnrichedPlan{}, code
+	}
+	enriched := EnrichedPlan{
+		Product:    template.Product,
+		Revision:   revision.Revision,
+		Components: make([]EnrichedComponent, len(template.Components)),
+	}
+	for i, comp := range template.Components {
+		voltage, testType := comp.Voltage, "unknown"
+		for _, listed := range revision.Components {
+			if listed.Name == comp.Name {
+				voltage, testType = listed.Voltage, listed.TestType
+				if testType == "" {
+					testType = "unknown"
+				}
+				break
+			}
+		}
+		if voltage == "" || voltage == "UNRESOLVED" {
+			voltage = revision.Voltage
+		}
+		enriched.Components[i] = EnrichedComponent{Name: comp.Name, Voltage: voltage, TestType: testType}
+	}
+	return enriched, ""
+}
+
+// notFound answers a request for something PLM does not hold
+func (p *fakePLM) notFound(w http.ResponseWriter, code, product, rev string) {
+	message := fmt.Sprintf("Product %s not found in PLM system", product)
+	if code == "revision_not_found" {
+		message = fmt.Sprintf("Product %s has no revision %s", product, rev)
+	}
+	writeError(w, http.StatusNotFound, code, message)
+}
+
+// routes serves the PLM endpoints the BPO calls
+func (p *fakePLM) routes() {
+	p.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+	})
+	p.Get("/products/{name}/components", func(w http.ResponseWriter, r *http.Request) {
+		name, rev := chi.URLParam(r, "name"), r.URL.Query().Get("revision")
+		revision, code := p.revision(name, rev)
+		if code != "" {
+			p.notFound(w, code, name, rev)
+			return
+		}
+		writeJSON(w, http.StatusOK, ProductComponents{
+			Product:    revision.Product,
+			Revision:   revision.Revision,
+			Components: revision.Components,
+		})
+	})
+	p.Get("/products/{name}/revisions/{rev}", func(w http.ResponseWriter, r *http.Request) {
+		name, rev := chi.URLParam(r, "name"), chi.URLParam(r, "rev")
+		revision, code := p.revision(name, rev)
+		if code != "" {
+			p.notFound(w, code, name, rev)
+			return
+		}
+		writeJSON(w, http.StatusOK, revision)
+	})
+	p.Post("/enrich-plan", func(w http.ResponseWriter, r *http.Request) {
+		var template TemplatePlan
+		if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid template plan format")
+			return
+		}
+		enriched, code := p.enrich(template)
+		if code != "" {
+			p.notFound(w, code, template.Product, template.Revision)
+			return
+		}
+		writeJSON(w, http.StatusOK, enriched)
+	})
+	p.Get("/products/{name}/release-status", func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+		p.mu.Lock()
+		status, ok := p.statuses[name]
+		p.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "status_not_found", fmt.Sprintf("No release status recorded for %s", name))
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	})
+	p.Post("/products/{name}/release-status", func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+		if _, code := p.revision(name, ""); code != "" {
+			p.notFound(w, code, name, "")
+			return
+		}
+		var update ReleaseStatusUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid release status format")
+			return
+		}
+		status := contracts.ReleaseStatus{Product: name, ReleaseStatusUpdate: update, UpdatedAt: time.Now()}
+		p.mu.Lock()
+		p.statuses[name] = status
+		p.mu.Unlock()
+		writeJSON(w, http.StatusOK, status)
+	})
+}
+
+// fakeDocGen validates document plans and pretends to render them
+type fakeDocGen struct {
+	chi.Router
+
+	mu        sync.Mutex
+	documents map[string]DocGenResponse
+}
+
+// docgenComponents are the component types DocGen can render
+var docgenComponents = []string{"DocumentTitle", "TestBlock", "AuthorBlock", "DocumentSubject"}
+
+func newFakeDocGen() *fakeDocGen {
+	docgen := &fakeDocGen{
+		Router:    chi.NewRouter(),
+		documents: make(map[string]DocGenResponse),
+	}
+	docgen.routes()
+	return docgen
+}
+
+// validate lists what DocGen refuses in a plan: unknown component types,
+// components without props and header props without a header component
+func (d *fakeDocGen) validate(plan DocumentPlan) []ValidationError {
+	var problems []ValidationError
+	known := func(component string) bool {
+		for _, available := range docgenComponents {
+			if component == available {
+				return true
+			}
+		}
+		return false
+	}
+
+	if props := plan.DocProps; props != nil && props.HeaderComponent != "" {
+		if !known(props.HeaderComponent) {
+			problems = append(problems, ValidationError{Field: "doc_props.header_component", Issue: "Unknown component type: " + props.HeaderComponent})
+		}
+	} else if props != nil && len(props.HeaderProps) > 0 {
+		problems = append(problems, ValidationError{Field: "doc_props.header_props", Issue: "Header props require a header component"})
+	}
+
+	var check func(path string, comp ComponentInstance)
+	check = func(path string, comp ComponentInstance) {
+		if !known(comp.Component) {
+			problems = append(problems, ValidationError{Field: path + ".component", Issue: "Unknown component type: " + comp.Component})
+		}
+		if len(comp.Props) == 0 {
+			problems = append(problems, ValidationError{Field: path + ".props", Issue: "Component props cannot be empty"})
+		}
+		for i, child := range comp.Children {
+			check(fmt.Sprintf("%s.children[%d]", path, i), child)
+		}
+	}
+	for i, comp := range plan.Body {
+		check(fmt.Sprintf("body[%d]", i), comp)
+	}
+	return problems
+}
+
+// countComponents counts components including nested children
+func countComponents(components []ComponentInstance) int {
+	count := len(components)
+	for _, comp := range components {
+		count += countComponents(comp.Children)
+	}
+	return count
+}
+
+// routes serves the DocGen endpoints the BPO calls
+func (d *fakeDocGen) routes() {
+	d.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+	})
+	d.Get("/components", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, contracts.ComponentsResponse{Components: docgenComponents, Count: len(docgenComponents)})
+	})
+	d.Post("/validate-plan", func(w http.ResponseWriter, r *http.Request) {
+		var plan DocumentPlan
+		if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+			writeJSON(w, http.StatusBadRequest, ValidationResponse{Message: "Invalid document plan format"})
+			return
+		}
+		if problems := d.validate(plan); len(problems) > 0 {
+			writeJSON(w, http.StatusBadRequest, ValidationResponse{Message: "Document plan validation failed", Errors: problems})
+			return
+		}
+		validated := countComponents(plan.Body)
+		writeJSON(w, http.StatusOK, ValidationResponse{Valid: true, Message: "Document plan is valid", ComponentsValidated: &validated})
+	})
+	d.Post("/generate", func(w http.ResponseWriter, r *http.Request) {
+		var plan DocumentPlan
+		if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+			writeError(w, http.StatusBadRequest, "validation_failed", "Invalid document plan format")
+			return
+		}
+		if problems := d.validate(plan); len(problems) > 0 {
+			writeJSON(w, http.StatusBadRequest, contracts.ErrorResponse{Error: "validation_failed", Message: "Document plan validation failed", Details: problems})
+			return
+		}
+		filename := "generated-document"
+		if plan.DocProps != nil && plan.DocProps.Filename != "" {
+			filename = plan.DocProps.Filename
+		}
+		document := DocGenResponse{
+			Status:             "success",
+			URL:                "gcs://fake-bucket/" + filename + ".docx",
+			Filename:           filename + ".docx",
+			GenerationTimeMs:   120,
+			ComponentsRendered: countComponents(plan.Body),
+		}
+		d.mu.Lock()
+		d.documents[document.Filename] = document
+		d.mu.Unlock()
+		writeJSON(w, http.StatusOK, document)
+	})
+	d.Delete("/documents/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		filename := chi.URLParam(r, "filename")
+		d.mu.Lock()
+		document, ok := d.documents[filename]
+		delete(d.documents, filename)
+		d.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "document_not_found", fmt.Sprintf("Document %s not found", filename))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted", "filename": filename, "url": document.URL})
+	})
+}
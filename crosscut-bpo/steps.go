@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// documentDVTProcedure is the template built when a build_document_plan
+// step names none
+const documentDVTProcedure = "dvt_procedure"
+
+// documentPlanConfig is the optional `with` block of a build_document_plan
+// step
+type documentPlanConfig struct {
+	// Document names the document template to build; templates are checked
+	// to exist when definitions and templates are loaded together
+	Document string `yaml:"document"`
+}
+
+// parseDocumentPlanConfig decodes a build_document_plan step, defaulting to
+// the DVT procedure
+func parseDocumentPlanConfig(step StepDefinition) (documentPlanConfig, error) {
+	var cfg documentPlanConfig
+	if err := decodeWith(step, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Document == "" {
+		cfg.Document = documentDVTProcedure
+	}
+	return cfg, nil
+}
+
+// validateDocumentPlanStep checks a build_document_plan step
+func validateDocumentPlanStep(step StepDefinition) error {
+	_, err := parseDocumentPlanConfig(step)
+	return err
+}
+
+// Keys under which built-in steps store their outputs on a run
+const (
+	outputTemplatePlan   = "template_plan"
+	outputEnrichedPlan   = "enriched_plan"
+	outputDocumentPlan   = "document_plan"
+	outputDocGenResponse = "docgen_response"
+)
+
+// output fetches a typed step output recorded earlier in the run
+func output[T any](run *workflowRun, key string) (T, error) {
+	value, ok := run.outputs[key].(T)
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("no %s available; is an earlier step missing from the definition?", key)
+	}
+	return value, nil
+}
+
+// revision is the product revision the run works on: the one PLM resolved
+// for the template plan, which is the current revision when the trigger
+// named none
+func (run *workflowRun) revision() string {
+	if template, ok := run.outputs[outputTemplatePlan].(*TemplatePlan); ok && template.Revision != "" {
+		return template.Revision
+	}
+	return run.Inputs["revision"]
+}
+
+// withRevision returns inputs with revision in place of the requested one
+func withRevision(inputs map[string]string, revision string) map[string]string {
+	if revision == "" || inputs["revision"] == revision {
+		return inputs
+	}
+	resolved := make(map[string]string, len(inputs)+1)
+	for name, value := range inputs {
+		resolved[name] = value
+	}
+	resolved["revision"] = revision
+	return resolved
+}
+
+// unresolvedVoltage marks a template value PLM must resolve
+const unresolvedVoltage = "UNRESOLVED"
+
+// stepGenerateTemplatePlan asks PLM which test components the requested
+// revision of the product has, or its current revision when none is
+// requested, and builds the template plan of values PLM must resolve, one
+// entry per component
+func (s *BPOService) stepGenerateTemplatePlan(ctx context.Context, run *workflowRun, step StepDefinition) (map[string]interface{}, error) {
+	plm, err := run.sor("plm")
+	if err != nil {
+		return nil, err
+	}
+	productName := run.Inputs["product_name"]
+
+	product, err := listComponents(ctx, plm, productName, run.Inputs["revision"])
+	if err != nil {
+		return nil, err
+	}
+	if len(product.Components) == 0 {
+		return nil, fmt.Errorf("PLM lists no test components for %s", productName)
+	}
+
+	template := &TemplatePlan{
+		Product:    productName,
+		Revision:   product.Revision,
+		Components: make([]ComponentTemplate, len(product.Components)),
+	}
+	for i, comp := range product.Components {
+		template.Components[i] = ComponentTemplate{
+			Name:    comp.Name,
+			Voltage: unresolvedVoltage,
+		}
+	}
+	run.outputs[outputTemplatePlan] = template
+
+	return map[string]interface{}{
+		"template":     template,
+		"plm_revision": product.Revision,
+	}, nil
+}
+
+// stepConsultPLM asks PLM to resolve the template plan
+func (s *BPOService) stepConsultPLM(ctx context.Context, run *workflowRun, step StepDefinition) (map[string]interface{}, error) {
+	template, err := output[*TemplatePlan](run, outputTemplatePlan)
+	if err != nil {
+		return nil, err
+	}
+	plm, err := run.sor("plm")
+	if err != nil {
+		return nil, err
+	}
+
+	enriched, err := consultPLM(ctx, plm, *template)
+	if err != nil {
+		return nil, err
+	}
+	run.outputs[outputEnrichedPlan] = enriched
+
+	return map[string]interface{}{
+		"enriched_plan": enriched,
+	}, nil
+}
+
+// stepBuildDocumentPlan renders the step's document template with the
+// trigger payload and the enriched plan into a DocGen document plan
+func (s *BPOService) stepBuildDocumentPlan(ctx context.Context, run *workflowRun, step StepDefinition) (map[string]interface{}, error) {
+	cfg, err := parseDocumentPlanConfig(step)
+	if err != nil {
+		return nil, err
+	}
+	enriched, err := output[*EnrichedPlan](run, outputEnrichedPlan)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, ok := run.state.templates.find(cfg.Document)
+	if !ok {
+		return nil, fmt.Errorf("no document template %q", cfg.Document)
+	}
+
+	documentPlan, err := tmpl.render(templateData{
+		Payload: run.Payload,
+		Inputs:  withRevision(run.Inputs, run.revision()),
+		Plan:    enriched,
+	}, run.state.config.TestCatalogue)
+	if err != nil {
+		return nil, err
+	}
+	run.outputs[outputDocumentPlan] = documentPlan
+
+	return map[string]interface{}{
+		"template":        tmpl.Name,
+		"template_digest": tmpl.Digest,
+		"components":      len(documentPlan.Body),
+	}, nil
+}
+
+// testBlockConfig is the `with` block of an add_test_block step
+type testBlockConfig struct {
+	TestName    string `yaml:"test_name"`
+	Description string `yaml:"description"`
+	// Voltage defaults to the highest voltage in the enriched plan
+	Voltage string `yaml:"voltage"`
+	// Section nests the block in the last top-level component of this
+	// type instead of appending it to the body
+	Section string `yaml:"section"`
+}
+
+// parseTestBlockConfig decodes and checks an add_test_block step
+func parseTestBlockConfig(step StepDefinition) (testBlockConfig, error) {
+	var cfg testBlockConfig
+	if err := decodeWith(step, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.TestName == "" {
+		return cfg, fmt.Errorf("test_name: must not be empty")
+	}
+	if cfg.Description == "" {
+		return cfg, fmt.Errorf("description: must not be empty")
+	}
+	return cfg, nil
+}
+
+// validateTestBlockStep checks an add_test_block step
+func validateTestBlockStep(step StepDefinition) error {
+	_, err := parseTestBlockConfig(step)
+	return err
+}
+
+// highestVoltage returns the enriched component voltage with the most volts
+func highestVoltage(enriched *EnrichedPlan) string {
+	highest, max := "", 0.0
+	for _, comp := range enriched.Components {
+		volts, err := parseVolts(comp.Voltage)
+		if err == nil && (highest == "" || volts > max) {
+			highest, max = comp.Voltage, volts
+		}
+	}
+	return highest
+}
+
+// stepAddTestBlock appends an extra TestBlock to the document plan, or to
+// one of its sections, such as a safety test required only for some products
+func (s *BPOService) stepAddTestBlock(ctx context.Context, run *workflowRun, step StepDefinition) (map[string]interface{}, error) {
+	cfg, err := parseTestBlockConfig(step)
+	if err != nil {
+		return nil, err
+	}
+	documentPlan, err := output[*DocumentPlan](run, outputDocumentPlan)
+	if err != nil {
+		return nil, err
+	}
+
+	voltage := cfg.Voltage
+	if voltage == "" {
+		enriched, err := output[*EnrichedPlan](run, outputEnrichedPlan)
+		if err != nil {
+			return nil, err
+		}
+		voltage = highestVoltage(enriched)
+	}
+
+	block := ComponentInstance{
+		Component: "TestBlock",
+		Props: map[string]interface{}{
+			"test_name":    cfg.TestName,
+			"voltage":      voltage,
+			"product_name": run.Inputs["product_name"],
+			"description":  cfg.Description,
+		},
+	}
+
+	// The plan may be shared with parallel branches, so extend a copy
+	extended := *documentPlan
+	extended.Body = append([]ComponentInstance(nil), documentPlan.Body...)
+	if cfg.Section == "" {
+		extended.Body = append(extended.Body, block)
+	} else {
+		section := -1
+		for i, comp := range extended.Body {
+			if comp.Component == cfg.Section {
+				section = i
+			}
+		}
+		if section < 0 {
+			return nil, fmt.Errorf("document plan has no %s section", cfg.Section)
+		}
+		extended.Body[section].Children = append(append([]ComponentInstance(nil), extended.Body[section].Children...), block)
+	}
+	run.outputs[outputDocumentPlan] = &extended
+
+	details := map[string]interface{}{
+		"test_name": cfg.TestName,
+		"voltage":   voltage,
+	}
+	if cfg.Section != "" {
+		details["section"] = cfg.Section
+	}
+	return details, nil
+}
+
+// planInvalidError reports a document plan DocGen refused to accept
+type planInvalidError struct {
+	Message string
+	Errors  []ValidationError
+}
+
+func (e *planInvalidError) Error() string {
+	issues := make([]string, len(e.Errors))
+	for i, problem := range e.Errors {
+		issues[i] = problem.Field + ": " + problem.Issue
+	}
+	return fmt.Sprintf("%s: %s", e.Message, strings.Join(issues, "; "))
+}
+
+// details records the rejection on the failed step's audit entry
+func (e *planInvalidError) details() map[string]interface{} {
+	return map[string]interface{}{
+		"valid":  false,
+		"errors": e.Errors,
+	}
+}
+
+// stepValidateDocumentPlan asks DocGen to validate the document plan before
+// anything is generated, failing the run with DocGen's field-level errors
+func (s *BPOService) stepValidateDocumentPlan(ctx context.Context, run *workflowRun, step StepDefinition) (map[string]interface{}, error) {
+	documentPlan, err := output[*DocumentPlan](run, outputDocumentPlan)
+	if err != nil {
+		return nil, err
+	}
+	docgen, err := run.sor("docgen")
+	if err != nil {
+		return nil, err
+	}
+
+	validation, err := validateDocumentPlan(ctx, docgen, *documentPlan)
+	if err != nil {
+		return nil, err
+	}
+	if !validation.Valid {
+		return nil, &planInvalidError{Message: validation.Message, Errors: validation.Errors}
+	}
+
+	details := map[string]interface{}{
+		"valid": true,
+	}
+	if validation.ComponentsValidated != nil {
+		details["components_validated"] = *validation.ComponentsValidated
+	}
+	return details, nil
+}
+
+// stepCommandDocGen commands DocGen to render the document plan
+func (s *BPOService) stepCommandDocGen(ctx context.Context, run *workflowRun, step StepDefinition) (map[string]interface{}, error) {
+	documentPlan, err := output[*DocumentPlan](run, outputDocumentPlan)
+	if err != nil {
+		return nil, err
+	}
+	docgen, err := run.sor("docgen")
+	if err != nil {
+		return nil, err
+	}
+
+	docGenResponse, err := commandDocGen(ctx, docgen, *documentPlan)
+	if err != nil {
+		return nil, err
+	}
+	run.outputs[outputDocGenResponse] = docGenResponse
+	run.documentURL = docGenResponse.URL
+
+	return map[string]interface{}{
+		"document_url":       docGenResponse.URL,
+		"filename":           docGenResponse.Filename,
+		"generation_time_ms": docGenResponse.GenerationTimeMs,
+	}, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"crosscut-contracts/bpo"
+)
+
+// templateComponents returns the component names of the template plan a
+// workflow built, from its audit trail
+func (h *harness) templateComponents(workflowID string) []string {
+	h.t.Helper()
+	entry := h.auditEntry(workflowID, "template_plan_generated")
+	template, _ := entry.Details["template"].(map[string]interface{})
+	components, _ := template["components"].([]interface{})
+	names := make([]string, len(components))
+	for i, component := range components {
+		names[i], _ = component.(map[string]interface{})["name"].(string)
+	}
+	return names
+}
+
+func TestTemplatePlanListsPLMComponents(t *testing.T) {
+	h := newHarness(t)
+
+	for _, tt := range []struct {
+		product, revision string
+		want              []string
+	}{
+		{"ROUTER-100", "C", []string{"PowerTest", "ThermalTest", "EthernetPortTest"}},
+		{"ROUTER-100", "A", []string{"PowerTest", "ThermalTest"}},
+	} {
+		response := h.release(tt.product, tt.revision)
+		h.assertSteps(tt.product+" rev "+tt.revision, h.templateComponents(response.WorkflowID), tt.want)
+
+		entry := h.auditEntry(response.WorkflowID, "template_plan_generated")
+		if entry.Details["plm_revision"] != tt.revision {
+			t.Errorf("plm_revision = %v, want %s", entry.Details["plm_revision"], tt.revision)
+		}
+		if n := h.requests("plm", http.MethodGet, "/products/"+tt.product+"/revisions/"+tt.revision); n != 1 {
+			t.Errorf("PLM received %d requests for rev %s, want 1", n, tt.revision)
+		}
+	}
+}
+
+func TestTemplatePlanFollowsProductChanges(t *testing.T) {
+	h := newHarness(t)
+	h.createProduct(plmProduct{
+		Name:     "GATEWAY-50",
+		Voltage:  "12V",
+		Revision: "A",
+		Components: []ProductComponent{
+			{Name: "PowerTest", Voltage: "12V", TestType: "power_supply_validation"},
+		},
+	})
+
+	response := h.release("GATEWAY-50", "A")
+
+	// Only what PLM lists for the product is planned, not a fixed set
+	h.assertSteps("GATEWAY-50 components", h.templateComponents(response.WorkflowID), []string{"PowerTest"})
+}
+
+func TestProductWithoutComponentsFailsWorkflow(t *testing.T) {
+	h := newHarness(t)
+	h.createProduct(plmProduct{Name: "BLANK-1", Voltage: "5V", Revision: "A"})
+
+	_, err := h.trigger("schematic.released", map[string]interface{}{"product_name": "BLANK-1", "revision": "A"})
+
+	var apiErr *bpo.Error
+	if !errors.As(err, &apiErr) || !strings.Contains(apiErr.Message, "PLM lists no test components for BLANK-1") {
+		t.Fatalf("error = %v, want no test components", err)
+	}
+	h.assertAuditTrail(apiErr.WorkflowID,
+		"workflow_started success",
+		"template_plan_generated failed",
+	)
+	if n := h.requests("plm", http.MethodPost, "/enrich-plan"); n != 0 {
+		t.Errorf("PLM received %d enrich requests, want none", n)
+	}
+}
+
+// invalidNoteHarness starts the services with a workflow whose document
+// template uses a component DocGen cannot render
+func invalidNoteHarness(t *testing.T) *harness {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "definition.yaml"), `
+name: signed-note
+version: 1
+trigger: note.signed
+inputs:
+  product_name:
+    required: true
+  revision: {}
+steps:
+  - id: template_plan_generated
+    type: generate_template_plan
+  - id: plm_consultation
+    type: consult_plm
+  - id: document_plan_built
+    type: build_document_plan
+    with:
+      document: signed_note
+  - id: document_plan_validated
+    type: validate_document_plan
+  - id: docgen_command
+    type: command_docgen
+`)
+	templates := t.TempDir()
+	writeFile(t, filepath.Join(templates, "signed-note.yaml"), `
+name: signed_note
+doc_props:
+  filename: "{{ .Inputs.product_name }}-Signed-Note"
+body:
+  - component: TestBlock
+    props:
+      test_name: "{{ .Inputs.product_name }}"
+  - component: SignatureBlock
+    props:
+      signed_by: qa-lead
+`)
+	return newHarness(t, func(cfg *Config) {
+		cfg.Workflows.DefinitionsDir = dir
+		cfg.Documents.TemplatesDir = templates
+	})
+}
+
+func TestRejectedPlanFailsBeforeGeneration(t *testing.T) {
+	h := invalidNoteHarness(t)
+
+	_, err := h.trigger("note.signed", routerRelease)
+
+	var apiErr *bpo.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("error = %v, want 422", err)
+	}
+	want := []bpo.ValidationError{{Field: "body[1].component", Issue: "Unknown component type: SignatureBlock"}}
+	if !reflect.DeepEqual(apiErr.Details, want) {
+		t.Errorf("validation errors = %+v, want %+v", apiErr.Details, want)
+	}
+	h.assertAuditTrail(apiErr.WorkflowID,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"document_plan_validated failed",
+	)
+	if n := h.requests("docgen", http.MethodPost, "/generate"); n != 0 {
+		t.Errorf("DocGen received %d generate requests, want none", n)
+	}
+
+	// A dry run reports the same errors in a successful response
+	response := h.dryRun("note.signed", routerRelease)
+	if response.Status != "failed" || !reflect.DeepEqual(response.ValidationErrors, want) {
+		t.Errorf("dry run = %+v, want the validation errors", response)
+	}
+}
+
+func TestValidPlanReportsComponentsValidated(t *testing.T) {
+	h := newHarness(t)
+
+	response := h.release("ROUTER-100", "C")
+
+	entry := h.auditEntry(response.WorkflowID, "document_plan_validated")
+	// The title and the three components PLM lists
+	if entry.Details["valid"] != true || entry.Details["components_validated"] != float64(4) {
+		t.Errorf("document_plan_validated details = %v, want 4 valid components", entry.Details)
+	}
+}
+
+func TestUnavailableValidationFailsWorkflow(t *testing.T) {
+	h := newHarness(t)
+	h.failRequests("docgen", http.MethodPost, "/validate-plan", http.StatusInternalServerError, 0)
+
+	_, err := h.trigger("schematic.released", routerRelease)
+
+	var apiErr *bpo.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || len(apiErr.Details) != 0 {
+		t.Fatalf("error = %v, want 500 without validation errors", err)
+	}
+	if n := h.requests("docgen", http.MethodPost, "/generate"); n != 0 {
+		t.Errorf("DocGen received %d generate requests, want none", n)
+	}
+}
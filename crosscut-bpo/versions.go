@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// DefinitionVersionInfo describes one registered version of a workflow
+type DefinitionVersionInfo struct {
+	Version      int    `json:"version"`
+	Digest       string `json:"digest,omitempty"`
+	Source       string `json:"source,omitempty"`
+	Registered   bool   `json:"registered"`
+	Deprecated   bool   `json:"deprecated"`
+	Latest       bool   `json:"latest"`
+	RunningCount int    `json:"running_count"`
+}
+
+// DefinitionInfo describes a workflow and all of its versions
+type DefinitionInfo struct {
+	Name     string                  `json:"name"`
+	Trigger  string                  `json:"trigger"`
+	Versions []DefinitionVersionInfo `json:"versions"`
+}
+
+// isDeprecated reports whether a version was deprecated through the admin API
+func (s *BPOService) isDeprecated(key definitionKey) bool {
+	s.deprecatedMu.Lock()
+	defer s.deprecatedMu.Unlock()
+	return s.deprecated[key]
+}
+
+// setDeprecated records a deprecation decision; it survives reloads
+func (s *BPOService) setDeprecated(key definitionKey, deprecated bool) {
+	s.deprecatedMu.Lock()
+	defer s.deprecatedMu.Unlock()
+	if deprecated {
+		s.deprecated[key] = true
+	} else {
+		delete(s.deprecated, key)
+	}
+}
+
+// runningCounts returns the number of unfinished runs per definition
+// version: those executing, plus tracked runs that are queued, paused or
+// awaiting approval
+func (s *BPOService) runningCounts() map[definitionKey]int {
+	unfinished := make(map[string]*workflowRun)
+	s.inflightMu.Lock()
+	for id, run := range s.inflight {
+		unfinished[id] = run
+	}
+	s.inflightMu.Unlock()
+
+	s.runsMu.Lock()
+	for id, run := range s.runs {
+		if !isTerminal(run.status) {
+			unfinished[id] = run
+		}
+	}
+	s.runsMu.Unlock()
+
+	counts := make(map[definitionKey]int)
+	for _, run := range unfinished {
+		counts[run.Definition.key()]++
+	}
+	return counts
+}
+
+// describeDefinitions reports every registered workflow version, plus any
+// version no longer registered that still has runs in flight
+func (s *BPOService) describeDefinitions() []DefinitionInfo {
+	registry := s.current().definitions
+	counts := s.runningCounts()
+
+	var infos []DefinitionInfo
+	for _, name := range registry.names() {
+		versions := registry.versions(name)
+		info := DefinitionInfo{Name: name, Trigger: versions[0].Trigger}
+
+		var latest *WorkflowDefinition
+		if def, err := registry.latest(info.Trigger, s.isDeprecated); err == nil {
+			latest = def
+		}
+
+		seen := map[int]bool{}
+		for _, def := range versions {
+			seen[def.Version] = true
+			info.Versions = append(info.Versions, DefinitionVersionInfo{
+				Version:      def.Version,
+				Digest:       def.Digest,
+				Source:       def.Source,
+				Registered:   true,
+				Deprecated:   def.Deprecated || s.isDeprecated(def.key()),
+				Latest:       def == latest,
+				RunningCount: counts[def.key()],
+			})
+		}
+		for key, count := range counts {
+			if key.Name == name && !seen[key.Version] {
+				info.Versions = append(info.Versions, DefinitionVersionInfo{
+					Version:      key.Version,
+					Deprecated:   s.isDeprecated(key),
+					RunningCount: count,
+				})
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// handleListDefinitions lists workflow definitions and their versions
+func (s *BPOService) handleListDefinitions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"definitions": s.describeDefinitions(),
+	})
+}
+
+// handleGetDefinition describes a single workflow's versions
+func (s *BPOService) handleGetDefinition(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	for _, info := range s.describeDefinitions() {
+		if info.Name == name {
+			writeJSON(w, http.StatusOK, info)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "definition_not_found", fmt.Sprintf("Workflow definition %s is not registered", name))
+}
+
+// handleDeprecateVersion deprecates (POST) or reinstates (DELETE) a version.
+// Deprecated versions are never pinned by new triggers; running instances
+// are unaffected.
+func (s *BPOService) handleDeprecateVersion(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Version must be an integer")
+		return
+	}
+
+	key := definitionKey{Name: name, Version: version}
+	def, ok := s.current().definitions.find(key)
+	if !ok {
+		writeError(w, http.StatusNotFound, "definition_not_found", fmt.Sprintf("Workflow definition %s@%d is not registered", name, version))
+		return
+	}
+
+	deprecate := r.Method == http.MethodPost
+	s.setDeprecated(key, deprecate)
+
+	action := "definition_deprecated"
+	if !deprecate {
+		action = "definition_reinstated"
+	}
+	caller := callerFromContext(r.Context())
+	log.Printf("%s %s by %s", action, def, caller)
+	if err := s.writeAuditEntry(AuditEntry{
+		Timestamp:         time.Now(),
+		Event:             "admin",
+		Action:            action,
+		Status:            "success",
+		Definition:        def.Name,
+		DefinitionVersion: def.Version,
+		Details: map[string]interface{}{
+			"actor": caller,
+		},
+	}); err != nil {
+		log.Printf("Failed to write audit entry: %v", err)
+	}
+
+	for _, info := range s.describeDefinitions() {
+		if info.Name == name {
+			writeJSON(w, http.StatusOK, info)
+			return
+		}
+	}
+}
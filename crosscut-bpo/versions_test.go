@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"crosscut-contracts/bpo"
+)
+
+func TestDeprecationChoosesVersionForNewTriggers(t *testing.T) {
+	h, definitionsDir, _ := reloadHarness(t)
+	writeFile(t, filepath.Join(definitionsDir, "schematic-released-v4.yaml"), planOnlyDefinition)
+	if err := h.service.reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	releasedVersion := func() int {
+		t.Helper()
+		response := h.release("ROUTER-100", "C")
+		return h.auditEntry(response.WorkflowID, "workflow_started").DefinitionVersion
+	}
+	latestVersion := func(info *bpo.DefinitionInfo) int {
+		for _, v := range info.Versions {
+			if v.Latest {
+				return v.Version
+			}
+		}
+		return 0
+	}
+
+	if v := releasedVersion(); v != 4 {
+		t.Errorf("trigger ran version %d, want the latest, 4", v)
+	}
+
+	info, err := bpo.Decode[bpo.DefinitionInfo](h.client.DeprecateVersion(ctx, "schematic-released", 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Versions) != 2 || !info.Versions[1].Deprecated || latestVersion(info) != 3 {
+		t.Errorf("after deprecating version 4: %+v", info.Versions)
+	}
+	if v := releasedVersion(); v != 3 {
+		t.Errorf("trigger ran version %d after version 4 was deprecated, want 3", v)
+	}
+	if actor := h.auditEntry("", "definition_deprecated").Details["actor"]; actor != anonymousCaller {
+		t.Errorf("deprecation audited for %v, want %s", actor, anonymousCaller)
+	}
+
+	// Deprecation survives a reload
+	if err := h.service.reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	if v := releasedVersion(); v != 3 {
+		t.Errorf("trigger ran version %d after a reload, want 3", v)
+	}
+
+	info, err = bpo.Decode[bpo.DefinitionInfo](h.client.ReinstateVersion(ctx, "schematic-released", 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latestVersion(info) != 4 {
+		t.Errorf("after reinstating version 4: %+v", info.Versions)
+	}
+	if v := releasedVersion(); v != 4 {
+		t.Errorf("trigger ran version %d after version 4 was reinstated, want 4", v)
+	}
+
+	// Every version deprecated leaves nothing to run
+	for _, version := range []int{3, 4} {
+		if _, err := bpo.Decode[bpo.DefinitionInfo](h.client.DeprecateVersion(ctx, "schematic-released", version)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.trigger("schematic.released", routerRelease); err == nil {
+		t.Error("trigger succeeded with every version deprecated")
+	}
+
+	var apiErr *bpo.Error
+	if _, err := bpo.Decode[bpo.DefinitionInfo](h.client.DeprecateVersion(ctx, "schematic-released", 9)); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("deprecating an unknown version: error = %v, want 404", err)
+	}
+}
+
+func TestRunningCountsIncludeUnregisteredVersions(t *testing.T) {
+	h, definitionsDir, _ := reloadHarness(t)
+	held := h.hold("docgen", http.MethodPost, "/generate")
+	done := h.triggerAsync("schematic.released", routerRelease)
+	held.wait()
+	ctx := context.Background()
+
+	info, err := bpo.Decode[bpo.DefinitionInfo](h.client.GetDefinition(ctx, "schematic-released"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Versions) != 1 || info.Versions[0].Version != 3 || info.Versions[0].RunningCount != 1 {
+		t.Errorf("with a run in flight: %+v", info.Versions)
+	}
+
+	// Replacing version 3 on disk leaves its running instance listed
+	if err := os.Remove(filepath.Join(definitionsDir, "schematic-released.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(definitionsDir, "schematic-released-v4.yaml"), planOnlyDefinition)
+	if err := h.service.reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	info, err = bpo.Decode[bpo.DefinitionInfo](h.client.GetDefinition(ctx, "schematic-released"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bpo.DefinitionVersionInfo{
+		{Version: 4, Registered: true, Latest: true},
+		{Version: 3, RunningCount: 1},
+	}
+	if len(info.Versions) != len(want) {
+		t.Fatalf("versions = %+v, want %+v", info.Versions, want)
+	}
+	for i, v := range info.Versions {
+		v.Digest, v.Source = "", ""
+		if v != want[i] {
+			t.Errorf("versions[%d] = %+v, want %+v", i, v, want[i])
+		}
+	}
+
+	held.release()
+	h.await(done)
+	info, err = bpo.Decode[bpo.DefinitionInfo](h.client.GetDefinition(ctx, "schematic-released"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Versions) != 1 || info.Versions[0].RunningCount != 0 {
+		t.Errorf("once the run finished: %+v", info.Versions)
+	}
+}
@@ -0,0 +1,8 @@
+// Package e2e runs the CrossCut BPO against the PLM and DocGen mocks. The
+// tests build the BPO binary and start it with the mocks on httptest
+// servers in the test process, so workflows can be tested across the three
+// services without docker-compose.
+//
+// The tests live in a module of their own so that the BPO's module does
+// not depend on the mocks.
+package e2e
@@ -0,0 +1,308 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"crosscut-contracts/bpo"
+	"crosscut-contracts/chaos"
+)
+
+func TestReleaseEndToEnd(t *testing.T) {
+	h := newHarness(t)
+
+	response := h.release("ROUTER-100", "C")
+
+	if response.Status != "success" || !strings.Contains(response.DocumentURL, "ROUTER-100-DVT-Procedure-Rev-C") {
+		t.Errorf("response = %+v", response)
+	}
+	h.assertAuditTrail(response.WorkflowID,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"high_voltage_safety skipped",
+		"document_plan_validated success",
+		"docgen_command success",
+		"workflow_completed success",
+	)
+	if n := h.requests("docgen", http.MethodPost, "/generate"); n != 1 {
+		t.Errorf("DocGen received %d generate requests, want 1", n)
+	}
+}
+
+func TestTransientSoRFailuresAreRetried(t *testing.T) {
+	h := newHarness(t)
+	h.failRequests("plm", http.MethodPost, "/enrich-plan", http.StatusServiceUnavailable, 1)
+	h.dropConnections("docgen", http.MethodPost, "/generate", 1)
+
+	response := h.release("ROUTER-100", "C")
+
+	if response.Status != "success" {
+		t.Errorf("response = %+v", response)
+	}
+	if n := h.requests("plm", http.MethodPost, "/enrich-plan"); n != 2 {
+		t.Errorf("PLM received %d enrich requests, want 2", n)
+	}
+	if n := h.requests("docgen", http.MethodPost, "/generate"); n != 2 {
+		t.Errorf("DocGen received %d generate requests, want 2", n)
+	}
+}
+
+func TestSoRFailureFailsWorkflow(t *testing.T) {
+	h := newHarness(t)
+	h.failRequests("docgen", http.MethodPost, "/generate", http.StatusInternalServerError, 0)
+
+	_, err := h.trigger("schematic.released", map[string]interface{}{
+		"product_name": "ROUTER-100",
+		"revision":     "C",
+	})
+
+	var apiErr *bpo.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || apiErr.Code != "workflow_failed" {
+		t.Fatalf("error = %v, want 500 workflow_failed", err)
+	}
+	// A 500 is not retried
+	if n := h.requests("docgen", http.MethodPost, "/generate"); n != 1 {
+		t.Errorf("DocGen received %d generate requests, want 1", n)
+	}
+	entry := h.auditEntry(apiErr.WorkflowID, "docgen_command")
+	if entry.Status != "failed" || !strings.Contains(entry.Error, "DocGen service returned 500") {
+		t.Errorf("docgen_command entry = %+v", entry)
+	}
+
+	// The next release goes through once DocGen recovers
+	h.clearFaults()
+	h.release("ROUTER-100", "C")
+}
+
+func TestFailingProductFailsOnlyItsWorkflow(t *testing.T) {
+	h := newHarness(t)
+	h.configureChaos("docgen", chaos.Config{
+		Seed:     1,
+		Products: map[string]chaos.ProductFailure{"SWITCH-200": {Rate: 1, Status: http.StatusServiceUnavailable}},
+	})
+
+	_, err := h.trigger("schematic.released", map[string]interface{}{
+		"product_name": "SWITCH-200",
+		"revision":     "A",
+	})
+
+	var apiErr *bpo.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != "workflow_failed" {
+		t.Fatalf("error = %v, want workflow_failed", err)
+	}
+	// The plan reaches DocGen for validation first; a 503 is retried until
+	// the attempts run out
+	if n := h.requests("docgen", http.MethodPost, "/validate-plan"); n != retryAttempts {
+		t.Errorf("DocGen received %d validation requests, want %d", n, retryAttempts)
+	}
+	entry := h.auditEntry(apiErr.WorkflowID, "document_plan_validated")
+	if entry.Status != "failed" || !strings.Contains(entry.Error, "503") {
+		t.Errorf("document_plan_validated entry = %+v", entry)
+	}
+
+	response := h.release("ROUTER-100", "C")
+	if response.Status != "success" {
+		t.Errorf("response = %+v", response)
+	}
+}
+
+func TestUnknownProductFailsWorkflow(t *testing.T) {
+	h := newHarness(t)
+
+	_, err := h.trigger("schematic.released", map[string]interface{}{"product_name": "ROUTER-999"})
+
+	var apiErr *bpo.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want *bpo.Error", err)
+	}
+	h.assertAuditTrail(apiErr.WorkflowID,
+		"workflow_started success",
+		"template_plan_generated failed",
+	)
+}
+
+func TestUnknownRevisionFailsWorkflow(t *testing.T) {
+	h := newHarness(t)
+
+	_, err := h.trigger("schematic.released", map[string]interface{}{"product_name": "ROUTER-100", "revision": "Z"})
+
+	var apiErr *bpo.Error
+	if !errors.As(err, &apiErr) || !strings.Contains(apiErr.Message, "revision_not_found") {
+		t.Fatalf("error = %v, want the PLM revision_not_found", err)
+	}
+	h.assertAuditTrail(apiErr.WorkflowID,
+		"workflow_started success",
+		"template_plan_generated failed",
+	)
+	if n := h.requests("plm", http.MethodPost, "/enrich-plan"); n != 0 {
+		t.Errorf("PLM received %d enrich requests, want none", n)
+	}
+}
+
+func TestEarlierRevisionUsesItsOwnValues(t *testing.T) {
+	h := newHarness(t)
+
+	response := h.dryRun("schematic.released", map[string]interface{}{"product_name": "ROUTER-100", "revision": "B"})
+
+	if response.Status != "success" {
+		t.Fatalf("response = %+v", response)
+	}
+	// Rev B drove the Ethernet ports at 5V, rev C at 3.3V
+	plan, err := json.Marshal(response.DocumentPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(plan), `"5V"`) || strings.Contains(string(plan), `"3.3V"`) {
+		t.Errorf("document plan = %s, want rev B's voltages", plan)
+	}
+	if n := h.requests("plm", http.MethodGet, "/products/ROUTER-100/revisions/B"); n != 1 {
+		t.Errorf("PLM received %d requests for rev B, want 1", n)
+	}
+}
+
+func TestReleaseWithoutRevisionUsesCurrentRevision(t *testing.T) {
+	h := newHarness(t)
+	payload := map[string]interface{}{"product_name": "ROUTER-100"}
+
+	// ROUTER-100's current revision is C, which drives the Ethernet ports
+	// at 3.3V
+	plan := documentPlan(t, h.dryRun("schematic.released", payload))
+	if plan.DocProps == nil || plan.DocProps.Filename != "ROUTER-100-DVT-Procedure-Rev-C" {
+		t.Errorf("doc_props = %+v, want rev C's filename", plan.DocProps)
+	}
+	if revision := plan.Body[0].Props["revision"]; revision != "C" {
+		t.Errorf("title revision = %v, want C", revision)
+	}
+	encoded, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"3.3V"`) || strings.Contains(string(encoded), `"5V"`) {
+		t.Errorf("document plan = %s, want rev C's voltages", encoded)
+	}
+
+	response, err := h.trigger("schematic.released", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(response.DocumentURL, "ROUTER-100-DVT-Procedure-Rev-C") {
+		t.Errorf("document URL = %s, want rev C's document", response.DocumentURL)
+	}
+	if revision := h.auditEntry(response.WorkflowID, "template_plan_generated").Details["plm_revision"]; revision != "C" {
+		t.Errorf("plm_revision = %v, want C", revision)
+	}
+	if n := h.requests("plm", http.MethodGet, "/products/ROUTER-100/components"); n != 2 {
+		t.Errorf("PLM received %d requests for the current components, want 2", n)
+	}
+}
+
+func TestFailedReleaseIsCompensated(t *testing.T) {
+	h := newHarness(t, "WORKFLOW_DEFINITIONS_DIR=testdata/workflows")
+	h.failRequests("docgen", http.MethodPost, "/validate-plan", http.StatusInternalServerError, 0)
+
+	_, err := h.trigger("release.compensated", map[string]interface{}{
+		"product_name": "ROUTER-100",
+		"revision":     "C",
+	})
+
+	var apiErr *bpo.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want *bpo.Error", err)
+	}
+	h.assertAuditTrail(apiErr.WorkflowID,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"docgen_command success",
+		"plm_release_recorded success",
+		"document_plan_validated failed",
+		"plm_release_recorded_compensation success",
+		"docgen_command_compensation success",
+		"workflow_compensated compensated",
+	)
+	if n := h.requests("docgen", http.MethodDelete, "/documents/ROUTER-100-DVT-Procedure-Rev-C.docx"); n != 1 {
+		t.Errorf("DocGen received %d delete requests, want 1", n)
+	}
+	if n := h.requests("plm", http.MethodPost, "/products/ROUTER-100/release-status"); n != 2 {
+		t.Errorf("PLM received %d release status updates, want 2", n)
+	}
+}
+
+func TestDryRunSkipsSideEffects(t *testing.T) {
+	h := newHarness(t)
+	payload := map[string]interface{}{"product_name": "ROUTER-100", "revision": "C"}
+
+	response := h.dryRun("schematic.released", payload)
+
+	if response.Status != "success" || !response.DryRun || response.DocumentURL != "" {
+		t.Errorf("response = %+v", response)
+	}
+	if body, _ := response.DocumentPlan["body"].([]interface{}); len(body) == 0 {
+		t.Errorf("document plan = %v, want the built plan", response.DocumentPlan)
+	}
+	h.assertTrace(response,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"high_voltage_safety skipped",
+		"document_plan_validated success",
+		"docgen_command skipped",
+		"workflow_completed success",
+	)
+	if reason := response.Trace[6].Details["reason"]; reason != "dry_run" {
+		t.Errorf("docgen_command skipped for %v, want dry_run", reason)
+	}
+	if n := h.requests("docgen", http.MethodPost, "/validate-plan"); n != 1 {
+		t.Errorf("DocGen received %d validation requests, want 1", n)
+	}
+	if n := h.requests("docgen", http.MethodPost, "/generate"); n != 0 {
+		t.Errorf("DocGen received %d generate requests, want none", n)
+	}
+
+	// A dry run leaves no audit entries and no run to look up
+	h.release("ROUTER-100", "C")
+	if entries := h.auditEntries(response.WorkflowID); len(entries) != 0 {
+		t.Errorf("dry run wrote %d audit entries", len(entries))
+	}
+	var apiErr *bpo.Error
+	if _, err := bpo.Decode[bpo.WorkflowStatus](h.client.GetWorkflow(context.Background(), response.WorkflowID)); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("GetWorkflow(%s) error = %v, want 404", response.WorkflowID, err)
+	}
+}
+
+func TestFailedDryRunIsNotCompensated(t *testing.T) {
+	h := newHarness(t, "WORKFLOW_DEFINITIONS_DIR=testdata/workflows")
+	h.failRequests("docgen", http.MethodPost, "/validate-plan", http.StatusInternalServerError, 0)
+
+	response := h.dryRun("release.compensated", map[string]interface{}{
+		"product_name": "ROUTER-100",
+		"revision":     "C",
+	})
+
+	if response.Status != "failed" || !strings.Contains(response.Message, "DocGen service returned 500") {
+		t.Errorf("response = %+v", response)
+	}
+	h.assertTrace(response,
+		"workflow_started success",
+		"template_plan_generated success",
+		"plm_consultation success",
+		"document_plan_built success",
+		"docgen_command skipped",
+		"plm_release_recorded skipped",
+		"document_plan_validated failed",
+	)
+	if n := h.requests("plm", http.MethodPost, "/products/ROUTER-100/release-status"); n != 0 {
+		t.Errorf("PLM received %d release status updates, want none", n)
+	}
+	if n := h.requests("docgen", http.MethodDelete, "/documents/ROUTER-100-DVT-Procedure-Rev-C.docx"); n != 0 {
+		t.Errorf("DocGen received %d delete requests, want none", n)
+	}
+}
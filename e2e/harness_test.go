@@ -0,0 +1,472 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"crosscut-contracts"
+	"crosscut-contracts/bpo"
+	"crosscut-contracts/chaos"
+	"mock-docgen-service/docgen"
+	"mock-plm-service/plm"
+)
+
+// retryAttempts is how often the BPO tries a SoR request that fails with a
+// retryable error
+const retryAttempts = 3
+
+// bpoBinary is the BPO built by TestMain
+var bpoBinary string
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+// run builds the BPO for the tests and runs them
+func run(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "crosscut-e2e-")
+	if err != nil {
+		log.Printf("creating a build directory: %v", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	bpoBinary = filepath.Join(dir, "crosscut-bpo")
+	build := exec.Command("go", "build", "-o", bpoBinary, ".")
+	build.Dir = "../crosscut-bpo"
+	if out, err := build.CombinedOutput(); err != nil {
+		log.Printf("building the BPO: %v\n%s", err, out)
+		return 1
+	}
+	return m.Run()
+}
+
+// harness runs the BPO binary against the PLM and DocGen mocks, each on
+// its own httptest server in the test process, with the audit trail in a
+// temporary file. Failures can be injected into the mocks' responses.
+type harness struct {
+	t *testing.T
+
+	client *bpo.Client
+
+	plm    *plm.Service
+	docgen *docgen.Service
+	// faults sit in front of each SoR's router, by SoR name
+	faults map[string]*faultInjector
+
+	auditPath string
+}
+
+// newHarness starts the mocks and the BPO. env, if given, adds KEY=value
+// settings to the BPO's environment, e.g. to load definitions from a test
+// directory.
+func newHarness(t *testing.T, env ...string) *harness {
+	t.Helper()
+	dir := t.TempDir()
+
+	// The PLM mock gets its own copy of the product data
+	plmData := filepath.Join(dir, "plm-data.json")
+	data, err := os.ReadFile("../data/plm-data.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(plmData, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	plmService, err := plm.NewService(plmData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docgenService := docgen.NewService()
+
+	h := &harness{
+		t:      t,
+		plm:    plmService,
+		docgen: docgenService,
+		faults: map[string]*faultInjector{
+			"plm":    {next: plmService.Handler()},
+			"docgen": {next: docgenService.Handler()},
+		},
+		auditPath: filepath.Join(dir, "audit.json"),
+	}
+	plmServer := httptest.NewServer(h.faults["plm"])
+	docgenServer := httptest.NewServer(h.faults["docgen"])
+	t.Cleanup(plmServer.Close)
+	t.Cleanup(docgenServer.Close)
+
+	// Retries back off briefly so injected failures do not slow tests down
+	configPath := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("retry:\n  max_attempts: %d\n  initial_backoff: 10ms\n  max_backoff: 50ms\n", retryAttempts)
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	addr := freeAddr(t)
+	cmd := exec.Command(bpoBinary, "--config", configPath)
+	cmd.Env = append(os.Environ(),
+		"LISTEN_ADDR="+addr,
+		"PLM_SERVICE_URL="+plmServer.URL,
+		"DOCGEN_SERVICE_URL="+docgenServer.URL,
+		"AUDIT_BACKEND=file",
+		"AUDIT_LOG_PATH="+h.auditPath,
+	)
+	cmd.Env = append(cmd.Env, env...)
+	// Written by the process until it exits, read only afterwards
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("starting the BPO: %v", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	// Cleanups run last in first out: in-flight workflows finish before
+	// the mocks go away
+	t.Cleanup(func() {
+		cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-exited:
+		case <-time.After(10 * time.Second):
+			cmd.Process.Kill()
+			<-exited
+			t.Error("the BPO did not shut down")
+		}
+		if t.Failed() {
+			t.Logf("BPO output:\n%s", output.String())
+		}
+	})
+
+	client, err := bpo.NewClient("http://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.client = client
+	h.waitReady(exited)
+	return h
+}
+
+// freeAddr returns a local address no one is listening on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// waitReady waits for the BPO to answer liveness probes, failing the test
+// if the process exits first
+func (h *harness) waitReady(exited <-chan error) {
+	h.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		_, err := bpo.Decode[bpo.LivenessResponse](h.client.GetLivez(context.Background()))
+		if err == nil {
+			return
+		}
+		select {
+		case err := <-exited:
+			h.t.Fatalf("the BPO exited on start: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatalf("the BPO did not start: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// trigger fires a trigger event through the BPO API. A response outside
+// 2xx is returned as *bpo.Error.
+func (h *harness) trigger(event string, payload map[string]interface{}) (*bpo.WorkflowResponse, error) {
+	return bpo.Decode[bpo.WorkflowResponse](h.client.ExecuteWorkflow(context.Background(), nil, bpo.WorkflowRequest{
+		TriggerEvent: event,
+		Payload:      payload,
+	}))
+}
+
+// dryRun simulates the workflow for a trigger event through the BPO API
+// and fails the test unless the request succeeds. The response tells
+// whether the simulated workflow would have succeeded.
+func (h *harness) dryRun(event string, payload map[string]interface{}) *bpo.WorkflowResponse {
+	h.t.Helper()
+	response, err := bpo.Decode[bpo.WorkflowResponse](h.client.ExecuteWorkflow(context.Background(), &bpo.ExecuteWorkflowParams{DryRun: true}, bpo.WorkflowRequest{
+		TriggerEvent: event,
+		Payload:      payload,
+	}))
+	if err != nil {
+		h.t.Fatalf("dry running %s: %v", event, err)
+	}
+	return response
+}
+
+// release triggers schematic.released for a product revision and fails
+// the test unless the request succeeds with a workflow ID
+func (h *harness) release(product, revision string) *bpo.WorkflowResponse {
+	h.t.Helper()
+	response, err := h.trigger("schematic.released", map[string]interface{}{
+		"product_name": product,
+		"revision":     revision,
+	})
+	if err != nil {
+		h.t.Fatalf("releasing %s rev %s: %v", product, revision, err)
+	}
+	return response
+}
+
+// documentPlan decodes the document plan of a dry run
+func documentPlan(t *testing.T, response *bpo.WorkflowResponse) contracts.DocumentPlan {
+	t.Helper()
+	data, err := json.Marshal(response.DocumentPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan contracts.DocumentPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+// failRequests makes the next times requests to method and path on a SoR
+// fail with status, without reaching the mock. times <= 0 fails every
+// request until clearFaults.
+func (h *harness) failRequests(sor, method, path string, status, times int) {
+	h.injector(sor).add(fault{method: method, path: path, status: status, remaining: times})
+}
+
+// dropConnections makes the next times requests to method and path on a
+// SoR fail at the transport level: the connection is closed without a
+// response. times <= 0 drops every request until clearFaults.
+func (h *harness) dropConnections(sor, method, path string, times int) {
+	h.injector(sor).add(fault{method: method, path: path, remaining: times})
+}
+
+// configureChaos sets the fault injection built into a SoR mock, which
+// fails requests at random but repeatably for a given seed. clearFaults
+// turns it off again.
+func (h *harness) configureChaos(sor string, cfg chaos.Config) {
+	h.t.Helper()
+	injectors := map[string]*chaos.Injector{
+		"plm":    h.plm.Chaos(),
+		"docgen": h.docgen.Chaos(),
+	}
+	injector, ok := injectors[sor]
+	if !ok {
+		h.t.Fatalf("unknown SoR %q", sor)
+	}
+	if err := injector.Configure(cfg); err != nil {
+		h.t.Fatalf("configuring chaos on %s: %v", sor, err)
+	}
+}
+
+// clearFaults removes every fault injected into the SoRs
+func (h *harness) clearFaults() {
+	for _, injector := range h.faults {
+		injector.clear()
+	}
+	h.plm.Chaos().Configure(chaos.Config{})
+	h.docgen.Chaos().Configure(chaos.Config{})
+}
+
+// requests returns how many requests to method and path a SoR received,
+// including those failed by an injected fault
+func (h *harness) requests(sor, method, path string) int {
+	return h.injector(sor).count(method, path)
+}
+
+func (h *harness) injector(sor string) *faultInjector {
+	h.t.Helper()
+	injector, ok := h.faults[sor]
+	if !ok {
+		h.t.Fatalf("unknown SoR %q", sor)
+	}
+	return injector
+}
+
+// auditEntry is an entry of the BPO's audit log
+type auditEntry struct {
+	WorkflowID string                 `json:"workflow_id"`
+	Action     string                 `json:"action"`
+	Status     string                 `json:"status"`
+	Details    map[string]interface{} `json:"details"`
+	Error      string                 `json:"error"`
+}
+
+// auditLog returns every entry of the audit log. The BPO rewrites the
+// file for each entry, so a read that catches it half written is retried.
+func (h *harness) auditLog() []auditEntry {
+	h.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(h.auditPath)
+		if err != nil {
+			h.t.Fatalf("reading audit log: %v", err)
+		}
+		var all []auditEntry
+		err = json.Unmarshal(data, &all)
+		if err == nil {
+			return all
+		}
+		var syntaxErr *json.SyntaxError
+		partial := errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF)
+		if !partial || time.Now().After(deadline) {
+			h.t.Fatalf("decoding audit log: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// auditEntries returns the audit trail of a workflow, read from the audit
+// log
+func (h *harness) auditEntries(workflowID string) []auditEntry {
+	h.t.Helper()
+	var entries []auditEntry
+	for _, entry := range h.auditLog() {
+		if entry.WorkflowID == workflowID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// auditEntry returns a workflow's entry for action, failing the test if
+// there is none
+func (h *harness) auditEntry(workflowID, action string) auditEntry {
+	h.t.Helper()
+	for _, entry := range h.auditEntries(workflowID) {
+		if entry.Action == action {
+			return entry
+		}
+	}
+	h.t.Fatalf("workflow %s has no %s audit entry", workflowID, action)
+	return auditEntry{}
+}
+
+// assertAuditTrail checks a workflow's audit entries, in order, as
+// "action status" pairs such as "plm_consultation success"
+func (h *harness) assertAuditTrail(workflowID string, want ...string) {
+	h.t.Helper()
+	entries := h.auditEntries(workflowID)
+	got := make([]string, len(entries))
+	for i, entry := range entries {
+		got[i] = entry.Action + " " + entry.Status
+	}
+	h.assertSteps("audit trail of "+workflowID, got, want)
+}
+
+// assertTrace checks the trace of a dry run like assertAuditTrail
+func (h *harness) assertTrace(response *bpo.WorkflowResponse, want ...string) {
+	h.t.Helper()
+	got := make([]string, len(response.Trace))
+	for i, entry := range response.Trace {
+		got[i] = entry.Action + " " + entry.Status
+	}
+	h.assertSteps("trace of "+response.WorkflowID, got, want)
+}
+
+func (h *harness) assertSteps(what string, got, want []string) {
+	h.t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		h.t.Errorf("%s:\n  %s\nwant:\n  %s", what,
+			strings.Join(got, "\n  "), strings.Join(want, "\n  "))
+	}
+}
+
+// fault fails requests to one endpoint of a SoR. A zero status closes the
+// connection instead of responding.
+type fault struct {
+	method string
+	path   string
+	status int
+	// remaining is how many more requests fail; <= 0 means all of them
+	remaining int
+}
+
+// faultInjector sits in front of a mock's router, failing requests that
+// match an injected fault and counting every request
+type faultInjector struct {
+	next http.Handler
+
+	mu     sync.Mutex
+	faults []*fault
+	counts map[string]int
+}
+
+func (f *faultInjector) add(injected fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, &injected)
+}
+
+func (f *faultInjector) clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = nil
+}
+
+func (f *faultInjector) count(method, path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.counts[method+" "+path]
+}
+
+// match counts a request and returns the fault it should fail with, if any
+func (f *faultInjector) match(r *http.Request) *fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.counts == nil {
+		f.counts = make(map[string]int)
+	}
+	f.counts[r.Method+" "+r.URL.Path]++
+
+	for i, injected := range f.faults {
+		if injected.method != r.Method || injected.path != r.URL.Path {
+			continue
+		}
+		if injected.remaining > 0 {
+			injected.remaining--
+			if injected.remaining == 0 {
+				f.faults = append(f.faults[:i], f.faults[i+1:]...)
+			}
+		}
+		matched := *injected
+		return &matched
+	}
+	return nil
+}
+
+func (f *faultInjector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	injected := f.match(r)
+	switch {
+	case injected == nil:
+		f.next.ServeHTTP(w, r)
+	case injected.status == 0:
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			panic(err)
+		}
+		conn.Close()
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(injected.status)
+		fmt.Fprintf(w, `{"error":"injected_failure","message":"%s %s failed by the test harness"}`, r.Method, r.URL.Path)
+	}
+}
@@ -0,0 +1,379 @@
+// Package docgen is the mock DocGen worker: it validates document plans and
+// pretends to render them, as the DocGen OpenAPI spec describes.
+package docgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"crosscut-contracts"
+	"crosscut-contracts/chaos"
+	"github.com/gin-gonic/gin"
+)
+
+// Wire types of the DocGen API, shared through the contracts module so the
+// BPO and this mock cannot drift apart (per OpenAPI spec)
+type (
+	DocumentPlan       = contracts.DocumentPlan
+	DocProps           = contracts.DocProps
+	ComponentInstance  = contracts.ComponentInstance
+	GenerateResponse   = contracts.GenerateResponse
+	ValidationResponse = contracts.ValidationResponse
+	ValidationError    = contracts.ValidationError
+	ComponentsResponse = contracts.ComponentsResponse
+	ErrorResponse      = contracts.ErrorResponse
+)
+
+// HealthResponse represents health check response
+type HealthResponse struct {
+	Status               string   `json:"status"`
+	Service              string   `json:"service"`
+	Version              string   `json:"version"`
+	UptimeSeconds        int      `json:"uptime_seconds"`
+	ComponentsLoaded     int      `json:"components_loaded"`
+	AvailableComponents  []string `json:"available_components"`
+}
+
+// Service handles document generation operations
+type Service struct {
+	startTime           time.Time
+	availableComponents []string
+
+	// Generated documents by filename, so they can be deleted again
+	documentsMu sync.Mutex
+	documents   map[string]GenerateResponse
+
+	// Faults injected into requests, off unless configured
+	chaos *chaos.Injector
+}
+
+// NewService creates a DocGen service instance
+func NewService() *Service {
+	return &Service{
+		startTime: time.Now(),
+		availableComponents: []string{
+			"DocumentTitle",
+			"TestBlock",
+			"AuthorBlock",
+			"DocumentSubject",
+		},
+		documents: make(map[string]GenerateResponse),
+		chaos:     chaos.New("DocGen", requestProduct),
+	}
+}
+
+// validatePlan validates a document plan, including the header component
+// and nested children
+func (s *Service) validatePlan(plan DocumentPlan) (bool, []ValidationError) {
+	var errors []ValidationError
+
+	if plan.DocProps != nil && plan.DocProps.HeaderComponent != "" {
+		if !s.isAvailable(plan.DocProps.HeaderComponent) {
+			errors = append(errors, ValidationError{
+				Field: "doc_props.header_component",
+				Issue: fmt.Sprintf("Unknown component type: %s", plan.DocProps.HeaderComponent),
+			})
+		}
+	} else if plan.DocProps != nil && len(plan.DocProps.HeaderProps) > 0 {
+		errors = append(errors, ValidationError{
+			Field: "doc_props.header_props",
+			Issue: "Header props require a header component",
+		})
+	}
+
+	for i, comp := range plan.Body {
+		errors = s.validateComponent(fmt.Sprintf("body[%d]", i), comp, errors)
+	}
+
+	return len(errors) == 0, errors
+}
+
+// validateComponent validates a component and its children, appending any
+// problems found under path
+func (s *Service) validateComponent(path string, comp ComponentInstance, errors []ValidationError) []ValidationError {
+	// Validate that the component is known
+	if !s.isAvailable(comp.Component) {
+		errors = append(errors, ValidationError{
+			Field: path + ".component",
+			Issue: fmt.Sprintf("Unknown component type: %s", comp.Component),
+		})
+	}
+
+	// Basic props validation
+	if len(comp.Props) == 0 {
+		errors = append(errors, ValidationError{
+			Field: path + ".props",
+			Issue: "Component props cannot be empty",
+		})
+	}
+
+	for i, child := range comp.Children {
+		errors = s.validateComponent(fmt.Sprintf("%s.children[%d]", path, i), child, errors)
+	}
+	return errors
+}
+
+// isAvailable reports whether a component type can be rendered
+func (s *Service) isAvailable(component string) bool {
+	for _, available := range s.availableComponents {
+		if component == available {
+			return true
+		}
+	}
+	return false
+}
+
+// countComponents counts components including nested children
+func countComponents(components []ComponentInstance) int {
+	count := len(components)
+	for _, comp := range components {
+		count += countComponents(comp.Children)
+	}
+	return count
+}
+
+// generateDocument simulates document generation
+func (s *Service) generateDocument(plan DocumentPlan) GenerateResponse {
+	startTime := time.Now()
+
+	// Extract key information for logging, from nested sections too
+	productName := "unknown"
+	voltage := "unknown"
+
+	var inspect func(components []ComponentInstance)
+	inspect = func(components []ComponentInstance) {
+		for _, comp := range components {
+			if product, ok := comp.Props["product_name"].(string); ok {
+				productName = product
+			}
+			if v, ok := comp.Props["voltage"].(string); ok {
+				voltage = v
+			}
+			inspect(comp.Children)
+		}
+	}
+	inspect(plan.Body)
+
+	// Log the received render job (this is what the MVP verification checks)
+	log.Printf("Received render job for %s with voltage %s", productName, voltage)
+
+	// Generate fake filename if not provided
+	filename := "generated-document.docx"
+	if plan.DocProps != nil && plan.DocProps.Filename != "" {
+		filename = plan.DocProps.Filename + ".docx"
+	}
+
+	// Generate fake GCS URL
+	timestamp := time.Now().Format("20060102-150405")
+	url := fmt.Sprintf("gcs://fake-bucket/%s-%s.docx",
+		filename[:len(filename)-5], // remove .docx
+		timestamp)
+
+	// Processing time is simulated by chaos latency, e.g.
+	// CHAOS_LATENCY=50ms-150ms
+	processingTime := time.Since(startTime)
+
+	return GenerateResponse{
+		Status:             "success",
+		URL:                url,
+		Filename:           filename,
+		GenerationTimeMs:   int(processingTime.Milliseconds()) + rand.Intn(200) + 100,
+		ComponentsRendered: countComponents(plan.Body),
+	}
+}
+
+// AvailableComponents lists the components the service can render
+func (s *Service) AvailableComponents() []string {
+	return s.availableComponents
+}
+
+// requestProduct names the product a DocGen request concerns: the first
+// product_name among the components of a document plan
+func requestProduct(r *http.Request, body []byte) string {
+	if r.Method != http.MethodPost {
+		return ""
+	}
+	var plan DocumentPlan
+	if json.Unmarshal(body, &plan) != nil {
+		return ""
+	}
+
+	var find func(components []ComponentInstance) string
+	find = func(components []ComponentInstance) string {
+		for _, comp := range components {
+			if product, ok := comp.Props["product_name"].(string); ok && product != "" {
+				return product
+			}
+			if product := find(comp.Children); product != "" {
+				return product
+			}
+		}
+		return ""
+	}
+	return find(plan.Body)
+}
+
+// Chaos returns the service's fault injector
+func (s *Service) Chaos() *chaos.Injector {
+	return s.chaos
+}
+
+// Handler returns the routes with faults injected as the chaos
+// configuration says
+func (s *Service) Handler() http.Handler {
+	return s.chaos.Wrap(s.SetupRoutes())
+}
+
+// SetupRoutes configures the HTTP routes
+func (s *Service) SetupRoutes() *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+
+	// Middleware for logging
+	router.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		return fmt.Sprintf("[DocGen] %s - %s %s %d %s\n",
+			param.TimeStamp.Format("2006/01/02 15:04:05"),
+			param.ClientIP,
+			param.Method,
+			param.StatusCode,
+			param.Path,
+		)
+	}))
+
+	// Health check endpoint
+	router.GET("/health", func(c *gin.Context) {
+		uptime := int(time.Since(s.startTime).Seconds())
+		response := HealthResponse{
+			Status:              "healthy",
+			Service:             "mock-docgen-service",
+			Version:             "1.0.0",
+			UptimeSeconds:       uptime,
+			ComponentsLoaded:    len(s.availableComponents),
+			AvailableComponents: s.availableComponents,
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// List available components
+	router.GET("/components", func(c *gin.Context) {
+		response := ComponentsResponse{
+			Components: s.availableComponents,
+			Count:      len(s.availableComponents),
+			Note:       "Mock components for MVP testing",
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Validate document plan
+	router.POST("/validate-plan", func(c *gin.Context) {
+		var plan DocumentPlan
+		if err := c.ShouldBindJSON(&plan); err != nil {
+			log.Printf("Failed to bind JSON for validation: %v", err)
+			response := ValidationResponse{
+				Valid:   false,
+				Message: "Invalid document plan format",
+				Errors: []ValidationError{{
+					Field: "request",
+					Issue: err.Error(),
+				}},
+			}
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+
+		valid, errors := s.validatePlan(plan)
+
+		if valid {
+			componentsValidated := countComponents(plan.Body)
+			response := ValidationResponse{
+				Valid:               true,
+				Message:             "Document plan is valid",
+				ComponentsValidated: &componentsValidated,
+			}
+			c.JSON(http.StatusOK, response)
+		} else {
+			response := ValidationResponse{
+				Valid:   false,
+				Message: "Document plan validation failed",
+				Errors:  errors,
+			}
+			c.JSON(http.StatusBadRequest, response)
+		}
+	})
+
+	// Fault injection configuration
+	router.Any(chaos.AdminPath, gin.WrapH(s.chaos))
+
+	// Main document generation endpoint
+	router.POST("/generate", func(c *gin.Context) {
+		var plan DocumentPlan
+		if err := c.ShouldBindJSON(&plan); err != nil {
+			log.Printf("Failed to bind JSON for generation: %v", err)
+			errorResponse := ErrorResponse{
+				Error:   "validation_failed",
+				Message: "Invalid document plan format",
+				Details: []ValidationError{{
+					Field: "request",
+					Issue: err.Error(),
+				}},
+			}
+			c.JSON(http.StatusBadRequest, errorResponse)
+			return
+		}
+
+		// Validate the plan
+		valid, validationErrors := s.validatePlan(plan)
+		if !valid {
+			errorResponse := ErrorResponse{
+				Error:   "validation_failed",
+				Message: "Document plan validation failed",
+				Details: validationErrors,
+			}
+			c.JSON(http.StatusBadRequest, errorResponse)
+			return
+		}
+
+		// Generate the document
+		response := s.generateDocument(plan)
+		log.Printf("Successfully generated document: %s (%d components)",
+			response.Filename, response.ComponentsRendered)
+
+		s.documentsMu.Lock()
+		s.documents[response.Filename] = response
+		s.documentsMu.Unlock()
+
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Delete a generated document (used to compensate failed workflows)
+	router.DELETE("/documents/:filename", func(c *gin.Context) {
+		filename := c.Param("filename")
+
+		s.documentsMu.Lock()
+		document, ok := s.documents[filename]
+		delete(s.documents, filename)
+		s.documentsMu.Unlock()
+
+		if !ok {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "document_not_found",
+				Message: fmt.Sprintf("Document %s not found", filename),
+			})
+			return
+		}
+
+		log.Printf("Deleted document: %s", filename)
+		c.JSON(http.StatusOK, gin.H{
+			"status":   "deleted",
+			"filename": filename,
+			"url":      document.URL,
+		})
+	})
+
+	return router
+}
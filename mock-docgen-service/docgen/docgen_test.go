@@ -0,0 +1,241 @@
+package docgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"crosscut-contracts/chaos"
+	"crosscut-contracts/interactions"
+	"crosscut-contracts/openapi"
+)
+
+// sectionedPlanFixture is a document plan rendered by the BPO, with a header
+// component and nested children
+const sectionedPlanFixture = "../../crosscut-bpo/testdata/sectioned-plan.json"
+
+// docgenSpec is the API this mock implements
+const docgenSpec = "../../docs/mock-docgen-openapi.yaml"
+
+// serve sends a request to the mock's router and returns the recorded response
+func serve(method, path string, body []byte) *httptest.ResponseRecorder {
+	router := NewService().SetupRoutes()
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// post sends body to the mock's router and decodes the JSON response
+func post(t *testing.T, path string, body []byte, out interface{}) int {
+	t.Helper()
+	rec := serve(http.MethodPost, path, body)
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		t.Fatalf("decoding %s response %q: %v", path, rec.Body.String(), err)
+	}
+	return rec.Code
+}
+
+func readFixture(t *testing.T) []byte {
+	t.Helper()
+	fixture, err := os.ReadFile(sectionedPlanFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fixture
+}
+
+func TestDocumentPlanRoundTrip(t *testing.T) {
+	fixture := readFixture(t)
+
+	var plan DocumentPlan
+	if err := json.Unmarshal(fixture, &plan); err != nil {
+		t.Fatalf("decoding fixture: %v", err)
+	}
+	encoded, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got, want interface{}
+	json.Unmarshal(encoded, &got)
+	json.Unmarshal(fixture, &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON differs\ngot:  %s\nwant: %s", encoded, fixture)
+	}
+}
+
+func TestValidatePlanAcceptsSectionedPlan(t *testing.T) {
+	var response ValidationResponse
+	code := post(t, "/validate-plan", readFixture(t), &response)
+
+	if code != http.StatusOK || !response.Valid {
+		t.Fatalf("status %d, response %+v; want a valid plan", code, response)
+	}
+	// Title, section and the section's two test blocks
+	if response.ComponentsValidated == nil || *response.ComponentsValidated != 4 {
+		t.Errorf("components_validated = %v, want 4", response.ComponentsValidated)
+	}
+}
+
+func TestGenerateRendersNestedComponents(t *testing.T) {
+	var response GenerateResponse
+	code := post(t, "/generate", readFixture(t), &response)
+
+	if code != http.StatusOK {
+		t.Fatalf("status %d, response %+v", code, response)
+	}
+	if response.ComponentsRendered != 4 {
+		t.Errorf("components_rendered = %d, want 4", response.ComponentsRendered)
+	}
+	if response.Filename != "ROUTER-100-Sectioned-DVT-Rev-C.docx" {
+		t.Errorf("filename = %q", response.Filename)
+	}
+}
+
+func TestValidatePlanReportsNestedErrors(t *testing.T) {
+	plan := []byte(`{
+		"doc_props": {"header_component": "Letterhead", "header_props": {"author": "qa"}},
+		"body": [
+			{
+				"component": "DocumentSubject",
+				"props": {"subject": "Tests"},
+				"children": [
+					{"component": "TestBlock", "props": {"test_name": "PowerTest"}},
+					{"component": "ThermalChart", "props": {}}
+				]
+			}
+		]
+	}`)
+
+	var response ValidationResponse
+	code := post(t, "/validate-plan", plan, &response)
+
+	if code != http.StatusBadRequest || response.Valid {
+		t.Fatalf("status %d, response %+v; want an invalid plan", code, response)
+	}
+	want := []ValidationError{
+		{Field: "doc_props.header_component", Issue: "Unknown component type: Letterhead"},
+		{Field: "body[0].children[1].component", Issue: "Unknown component type: ThermalChart"},
+		{Field: "body[0].children[1].props", Issue: "Component props cannot be empty"},
+	}
+	if !reflect.DeepEqual(response.Errors, want) {
+		t.Errorf("errors = %+v, want %+v", response.Errors, want)
+	}
+}
+
+// TestResponsesMatchSpec checks the JSON the mock actually sends against the
+// response schemas in the spec, rejecting fields the spec does not declare
+func TestResponsesMatchSpec(t *testing.T) {
+	spec, err := openapi.Load(docgenSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalidPlan := []byte(`{"body": [{"component": "ThermalChart", "props": {}}]}`)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   []byte
+		status int
+	}{
+		{"health", http.MethodGet, "/health", nil, http.StatusOK},
+		{"components", http.MethodGet, "/components", nil, http.StatusOK},
+		{"valid plan", http.MethodPost, "/validate-plan", readFixture(t), http.StatusOK},
+		{"invalid plan", http.MethodPost, "/validate-plan", invalidPlan, http.StatusBadRequest},
+		{"malformed plan", http.MethodPost, "/validate-plan", []byte(`{"body": []}`), http.StatusBadRequest},
+		{"generate", http.MethodPost, "/generate", readFixture(t), http.StatusOK},
+		{"generate invalid plan", http.MethodPost, "/generate", invalidPlan, http.StatusBadRequest},
+		{"generate malformed plan", http.MethodPost, "/generate", []byte(`{}`), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.method, tt.path, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			schema, err := spec.ResponseSchema(tt.method, tt.path, tt.status)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := spec.ValidateJSON(rec.Body.Bytes(), schema, openapi.Options{Strict: true}); err != nil {
+				t.Errorf("response does not match the spec: %v\n%s", err, rec.Body)
+			}
+		})
+	}
+}
+
+// bpoContract lists the requests the BPO sends to DocGen, recorded by the
+// BPO's tests
+const bpoContract = "../../crosscut-bpo/testdata/contracts/mock-docgen-service.json"
+
+// TestBPOContract replays every request the BPO relies on against the
+// mock's router
+func TestBPOContract(t *testing.T) {
+	contract, err := interactions.Load(bpoContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Provider states set up the data an interaction assumes
+	states := map[string]func(*Service){
+		"": func(*Service) {},
+		"document ROUTER-100-DVT-Procedure-Rev-C.docx was generated": func(s *Service) {
+			s.documents["ROUTER-100-DVT-Procedure-Rev-C.docx"] = GenerateResponse{
+				Status:   "success",
+				URL:      "gcs://fake-bucket/ROUTER-100-DVT-Procedure-Rev-C.docx",
+				Filename: "ROUTER-100-DVT-Procedure-Rev-C.docx",
+			}
+		},
+	}
+
+	for _, interaction := range contract.Interactions {
+		t.Run(interaction.Description, func(t *testing.T) {
+			setUp, ok := states[interaction.ProviderState]
+			if !ok {
+				t.Fatalf("unknown provider state %q", interaction.ProviderState)
+			}
+			service := NewService()
+			setUp(service)
+			if err := interactions.Verify(service.SetupRoutes(), interaction); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestChaosFailsChosenProduct checks that a plan is attributed to the
+// product named in its nested components
+func TestChaosFailsChosenProduct(t *testing.T) {
+	fixture := readFixture(t)
+	generate := func(handler http.Handler) int {
+		req := httptest.NewRequest(http.MethodPost, "/generate", bytes.NewReader(fixture))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for product, want := range map[string]int{
+		"ROUTER-100": http.StatusBadGateway,
+		"SWITCH-200": http.StatusOK,
+	} {
+		service := NewService()
+		err := service.Chaos().Configure(chaos.Config{
+			Seed:     1,
+			Products: map[string]chaos.ProductFailure{product: {Rate: 1, Status: http.StatusBadGateway}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := generate(service.Handler()); got != want {
+			t.Errorf("generating the ROUTER-100 plan with %s failing = %d, want %d", product, got, want)
+		}
+	}
+}
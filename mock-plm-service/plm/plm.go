@@ -0,0 +1,421 @@
+// Package plm is the mock PLM service: products loaded from a JSON file and
+// the HTTP API the BPO consults to resolve template plans.
+package plm
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"crosscut-contracts"
+	"crosscut-contracts/chaos"
+	"github.com/gin-gonic/gin"
+)
+
+// PLMProduct represents a product in the PLM system. Voltage and
+// Components belong to the current revision, Revision; earlier revisions
+// keep their own.
+type PLMProduct struct {
+	Name        string        `json:"name"`
+	Voltage     string        `json:"voltage"`
+	Description string        `json:"description"`
+	Revision    string        `json:"revision"`
+	Components  []Component   `json:"components"`
+	Revisions   []PLMRevision `json:"revisions,omitempty"`
+}
+
+// PLMRevision is an earlier revision of a product
+type PLMRevision struct {
+	Revision   string      `json:"revision"`
+	Voltage    string      `json:"voltage"`
+	Components []Component `json:"components"`
+}
+
+// revision returns a revision of the product with its voltage and
+// components; "" is the current revision
+func (p *PLMProduct) revision(rev string) (ProductRevision, bool) {
+	if rev == "" || rev == p.Revision {
+		return ProductRevision{
+			Product:    p.Name,
+			Revision:   p.Revision,
+			Current:    true,
+			Voltage:    p.Voltage,
+			Components: p.Components,
+		}, true
+	}
+	for _, earlier := range p.Revisions {
+		if earlier.Revision == rev {
+			return ProductRevision{
+				Product:    p.Name,
+				Revision:   earlier.Revision,
+				Voltage:    earlier.Voltage,
+				Components: earlier.Components,
+			}, true
+		}
+	}
+	return ProductRevision{}, false
+}
+
+// PLMData represents the structure of plm-data.json
+type PLMData struct {
+	Products []PLMProduct `json:"products"`
+}
+
+// Wire types of the PLM API, shared through the contracts module so the BPO
+// and this mock cannot drift apart
+type (
+	Component         = contracts.ProductComponent
+	TemplatePlan      = contracts.TemplatePlan
+	ComponentTemplate = contracts.ComponentTemplate
+	EnrichedPlan      = contracts.EnrichedPlan
+	EnrichedComponent = contracts.EnrichedComponent
+	ProductComponents = contracts.ProductComponents
+	ProductRevision   = contracts.ProductRevision
+	ReleaseStatus     = contracts.ReleaseStatus
+)
+
+// Service handles PLM operations
+type Service struct {
+	dataPath string
+
+	// Products, changed through the API and saved back to dataPath
+	dataMu sync.RWMutex
+	data   *PLMData
+
+	// Release status per product, set by orchestration workflows
+	statusMu sync.Mutex
+	statuses map[string]ReleaseStatus
+
+	// Faults injected into requests, off unless configured
+	chaos *chaos.Injector
+}
+
+// NewService creates a PLM service serving the products in dataPath
+func NewService(dataPath string) (*Service, error) {
+	service := &Service{
+		dataPath: dataPath,
+		statuses: make(map[string]ReleaseStatus),
+		chaos:    chaos.New("PLM", requestProduct),
+	}
+
+	if err := service.loadData(); err != nil {
+		return nil, fmt.Errorf("failed to load PLM data: %w", err)
+	}
+
+	return service, nil
+}
+
+// loadData loads PLM data from the JSON file
+func (s *Service) loadData() error {
+	absPath, err := filepath.Abs(s.dataPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return fmt.Errorf("failed to read PLM data file: %w", err)
+	}
+
+	s.data = &PLMData{}
+	if err := json.Unmarshal(data, s.data); err != nil {
+		return fmt.Errorf("failed to unmarshal PLM data: %w", err)
+	}
+
+	log.Printf("Loaded PLM data with %d products from %s", len(s.data.Products), absPath)
+	return nil
+}
+
+// findProduct finds a product by name
+func (s *Service) findProduct(productName string) (*PLMProduct, error) {
+	s.dataMu.RLock()
+	defer s.dataMu.RUnlock()
+	for _, product := range s.data.Products {
+		if product.Name == productName {
+			return &product, nil
+		}
+	}
+	return nil, fmt.Errorf("product %s not found", productName)
+}
+
+// notFoundError is a product or revision PLM does not hold, answered with
+// 404 and the error code
+type notFoundError struct {
+	code    string
+	message string
+}
+
+func (e *notFoundError) Error() string {
+	return e.message
+}
+
+// findRevision finds a revision of a product; "" is the current revision
+func (s *Service) findRevision(productName, rev string) (ProductRevision, error) {
+	product, err := s.findProduct(productName)
+	if err != nil {
+		return ProductRevision{}, &notFoundError{"product_not_found", fmt.Sprintf("Product %s not found in PLM system", productName)}
+	}
+	revision, ok := product.revision(rev)
+	if !ok {
+		return ProductRevision{}, &notFoundError{"revision_not_found", fmt.Sprintf("Product %s has no revision %s", productName, rev)}
+	}
+	if revision.Components == nil {
+		revision.Components = []Component{}
+	}
+	return revision, nil
+}
+
+// respondNotFound answers a request for a product or revision PLM does not
+// hold
+func respondNotFound(c *gin.Context, err error) {
+	code, message := "product_not_found", err.Error()
+	if notFound, ok := err.(*notFoundError); ok {
+		code = notFound.code
+	}
+	c.JSON(http.StatusNotFound, gin.H{
+		"error":   code,
+		"message": message,
+	})
+}
+
+// productCount returns how many products PLM holds
+func (s *Service) productCount() int {
+	s.dataMu.RLock()
+	defer s.dataMu.RUnlock()
+	return len(s.data.Products)
+}
+
+// enrichPlan enriches a template plan with the actual voltage values of the
+// requested revision
+func (s *Service) enrichPlan(template TemplatePlan) (*EnrichedPlan, error) {
+	product, err := s.findRevision(template.Product, template.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	enriched := &EnrichedPlan{
+		Product:    template.Product,
+		Revision:   product.Revision,
+		Components: make([]EnrichedComponent, len(template.Components)),
+	}
+
+	for i, templateComp := range template.Components {
+		// Find the corresponding component in the product
+		voltage := templateComp.Voltage // Default to template value
+		testType := ""
+
+		for _, productComp := range product.Components {
+			if productComp.Name == templateComp.Name {
+				voltage = productComp.Voltage
+				testType = productComp.TestType
+				break
+			}
+		}
+
+		// Components PLM does not describe have no known test type
+		if testType == "" {
+			testType = "unknown"
+		}
+
+		// If voltage is still unresolved, use the product's default voltage
+		if voltage == "UNRESOLVED" || voltage == "" {
+			voltage = product.Voltage
+		}
+
+		enriched.Components[i] = EnrichedComponent{
+			Name:     templateComp.Name,
+			Voltage:  voltage,
+			TestType: testType,
+		}
+	}
+
+	return enriched, nil
+}
+
+// requestProduct names the product a PLM request concerns, from its path or
+// the product of a template plan
+func requestProduct(r *http.Request, body []byte) string {
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/products/"); ok {
+		name, _, _ := strings.Cut(rest, "/")
+		return name
+	}
+	if r.URL.Path == "/enrich-plan" {
+		var template TemplatePlan
+		json.Unmarshal(body, &template)
+		return template.Product
+	}
+	return ""
+}
+
+// Chaos returns the service's fault injector
+func (s *Service) Chaos() *chaos.Injector {
+	return s.chaos
+}
+
+// Handler returns the routes with faults injected as the chaos
+// configuration says
+func (s *Service) Handler() http.Handler {
+	return s.chaos.Wrap(s.SetupRoutes())
+}
+
+// SetupRoutes configures the HTTP routes
+func (s *Service) SetupRoutes() *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+
+	// Middleware for logging
+	router.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		return fmt.Sprintf("[PLM] %s - %s %s %d %s\n",
+			param.TimeStamp.Format("2006/01/02 15:04:05"),
+			param.ClientIP,
+			param.Method,
+			param.StatusCode,
+			param.Path,
+		)
+	}))
+
+	// Health check endpoint
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "healthy",
+			"service": "mock-plm-service",
+			"products_loaded": s.productCount(),
+		})
+	})
+
+	// Main enrichment endpoint
+	router.POST("/enrich-plan", func(c *gin.Context) {
+		var template TemplatePlan
+		if err := c.ShouldBindJSON(&template); err != nil {
+			log.Printf("Failed to bind JSON: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid_request",
+				"message": "Invalid template plan format",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		log.Printf("Enriching plan for product: %s rev %q", template.Product, template.Revision)
+
+		enriched, err := s.enrichPlan(template)
+		if err != nil {
+			log.Printf("Failed to enrich plan: %v", err)
+			respondNotFound(c, err)
+			return
+		}
+
+		log.Printf("Successfully enriched plan for %s rev %s with %d components",
+			enriched.Product, enriched.Revision, len(enriched.Components))
+
+		c.JSON(http.StatusOK, enriched)
+	})
+
+	// Test components of a product, from which plan templates are built,
+	// of the current revision unless ?revision= names another
+	router.GET("/products/:name/components", func(c *gin.Context) {
+		name := c.Param("name")
+		revision, err := s.findRevision(name, c.Query("revision"))
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+
+		log.Printf("Listing %d component(s) of %s rev %s", len(revision.Components), name, revision.Revision)
+		c.JSON(http.StatusOK, ProductComponents{
+			Product:    revision.Product,
+			Revision:   revision.Revision,
+			Components: revision.Components,
+		})
+	})
+
+	// One revision of a product with its voltage and test components
+	router.GET("/products/:name/revisions/:rev", func(c *gin.Context) {
+		revision, err := s.findRevision(c.Param("name"), c.Param("rev"))
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, revision)
+	})
+
+	// Release status of a product, e.g. reverted by a compensating workflow
+	router.GET("/products/:name/release-status", func(c *gin.Context) {
+		name := c.Param("name")
+		s.statusMu.Lock()
+		status, ok := s.statuses[name]
+		s.statusMu.Unlock()
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "status_not_found",
+				"message": fmt.Sprintf("No release status recorded for %s", name),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+
+	router.POST("/products/:name/release-status", func(c *gin.Context) {
+		name := c.Param("name")
+		if _, err := s.findProduct(name); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "product_not_found",
+				"message": fmt.Sprintf("Product %s not found in PLM system", name),
+			})
+			return
+		}
+
+		var update contracts.ReleaseStatusUpdate
+		if err := c.ShouldBindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_request",
+				"message": "Invalid release status format",
+				"details": err.Error(),
+			})
+			return
+		}
+		status := ReleaseStatus{
+			Product:             name,
+			ReleaseStatusUpdate: update,
+			UpdatedAt:           time.Now(),
+		}
+
+		s.statusMu.Lock()
+		s.statuses[name] = status
+		s.statusMu.Unlock()
+
+		log.Printf("Release status of %s rev %s set to %s (%s)", name, status.Revision, status.Status, status.Reason)
+		c.JSON(http.StatusOK, status)
+	})
+
+	// Fault injection configuration
+	router.Any(chaos.AdminPath, gin.WrapH(s.chaos))
+
+	// Products, managed so test fixtures can be set up over HTTP
+	router.GET("/products/:name", s.handleGetProduct)
+	router.POST("/products/:name", s.handleCreateProduct)
+	router.PUT("/products/:name", s.handleUpdateProduct)
+	router.DELETE("/products/:name", s.handleDeleteProduct)
+
+	// List all products endpoint (for debugging)
+	router.GET("/products", func(c *gin.Context) {
+		s.dataMu.RLock()
+		products := make([]string, len(s.data.Products))
+		for i, product := range s.data.Products {
+			products[i] = product.Name
+		}
+		s.dataMu.RUnlock()
+		c.JSON(http.StatusOK, gin.H{
+			"products": products,
+			"count": len(products),
+		})
+	})
+
+	return router
+}
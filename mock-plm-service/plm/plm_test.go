@@ -0,0 +1,279 @@
+package plm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"crosscut-contracts/chaos"
+	"crosscut-contracts/interactions"
+)
+
+// bpoContract lists the requests the BPO sends to PLM, recorded by the
+// BPO's tests
+const bpoContract = "../../crosscut-bpo/testdata/contracts/mock-plm-service.json"
+
+// plmData holds the products the mock serves in the MVP
+const plmData = "../../data/plm-data.json"
+
+// TestBPOContract replays every request the BPO relies on against the
+// mock's router
+func TestBPOContract(t *testing.T) {
+	contract, err := interactions.Load(bpoContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Provider states set up the data an interaction assumes
+	states := map[string]func(*Service) error{
+		"": func(*Service) error { return nil },
+		"product ROUTER-100 has revision C": func(s *Service) error {
+			_, err := s.findRevision("ROUTER-100", "C")
+			return err
+		},
+	}
+
+	for _, interaction := range contract.Interactions {
+		t.Run(interaction.Description, func(t *testing.T) {
+			service, err := NewService(plmData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setUp, ok := states[interaction.ProviderState]
+			if !ok {
+				t.Fatalf("unknown provider state %q", interaction.ProviderState)
+			}
+			if err := setUp(service); err != nil {
+				t.Fatalf("provider state %q: %v", interaction.ProviderState, err)
+			}
+			if err := interactions.Verify(service.SetupRoutes(), interaction); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestChaosFailsChosenProduct checks that requests are attributed to the
+// product in their path or template plan
+func TestChaosFailsChosenProduct(t *testing.T) {
+	service, err := NewService(plmData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := service.Handler()
+
+	// Chaos is configured through the admin endpoint of the wrapped router
+	rec := serve(handler, http.MethodPut, chaos.AdminPath,
+		`{"seed": 1, "products": {"SWITCH-200": {"rate": 1, "status": 503}}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("configuring chaos: %d %s", rec.Code, rec.Body)
+	}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/products/SWITCH-200/components", "", http.StatusServiceUnavailable},
+		{http.MethodPost, "/enrich-plan", `{"product": "SWITCH-200", "components": [{"name": "TestBlock"}]}`, http.StatusServiceUnavailable},
+		{http.MethodGet, "/products/ROUTER-100/components", "", http.StatusOK},
+		{http.MethodPost, "/enrich-plan", `{"product": "ROUTER-100", "components": [{"name": "TestBlock"}]}`, http.StatusOK},
+		{http.MethodGet, "/health", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := serve(handler, tt.method, tt.path, tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s %s = %d, want %d: %s", tt.method, tt.path, tt.body, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
+
+// newTestService returns a service over its own copy of the MVP products
+func newTestService(t *testing.T) (*Service, string) {
+	t.Helper()
+	data, err := os.ReadFile(plmData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "plm-data.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	service, err := NewService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service, path
+}
+
+// serve sends a request to a router and returns the recorded response
+func serve(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProductCRUD(t *testing.T) {
+	service, path := newTestService(t)
+	router := service.SetupRoutes()
+	product := `{
+		"voltage": "5V",
+		"description": "Wireless access point",
+		"revision": "A",
+		"components": [{"name": "PowerTest", "voltage": "5V", "test_type": "power_supply_validation"}]
+	}`
+
+	steps := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/products/AP-300", "", http.StatusNotFound},
+		{http.MethodPost, "/products/AP-300", product, http.StatusCreated},
+		{http.MethodPost, "/products/AP-300", product, http.StatusConflict},
+		{http.MethodGet, "/products/AP-300", "", http.StatusOK},
+		{http.MethodGet, "/products/AP-300/components", "", http.StatusOK},
+		{http.MethodPut, "/products/AP-300", strings.Replace(product, `"revision": "A"`, `"revision": "B"`, 1), http.StatusOK},
+		{http.MethodPut, "/products/AP-400", product, http.StatusNotFound},
+		{http.MethodDelete, "/products/ROUTER-100", "", http.StatusOK},
+		{http.MethodDelete, "/products/ROUTER-100", "", http.StatusNotFound},
+	}
+	for _, step := range steps {
+		if rec := serve(router, step.method, step.path, step.body); rec.Code != step.want {
+			t.Fatalf("%s %s = %d, want %d: %s", step.method, step.path, rec.Code, step.want, rec.Body)
+		}
+	}
+
+	var got PLMProduct
+	if err := json.Unmarshal(serve(router, http.MethodGet, "/products/AP-300", "").Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "AP-300" || got.Revision != "B" || len(got.Components) != 1 {
+		t.Errorf("AP-300 = %+v", got)
+	}
+
+	// The changes are in the data file, which is replaced whole
+	reloaded, err := NewService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, product := range reloaded.data.Products {
+		names = append(names, product.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"SWITCH-200", "AP-300"}) {
+		t.Errorf("products saved = %v, want SWITCH-200 and AP-300", names)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("data directory holds %d files, want only the data file", len(entries))
+	}
+}
+
+func TestProductRevisions(t *testing.T) {
+	service, err := NewService(plmData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := service.SetupRoutes()
+
+	var revision ProductRevision
+	rec := serve(router, http.MethodGet, "/products/ROUTER-100/revisions/B", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &revision); err != nil {
+		t.Fatalf("%d %s: %v", rec.Code, rec.Body, err)
+	}
+	if revision.Revision != "B" || revision.Current || len(revision.Components) != 3 {
+		t.Errorf("ROUTER-100 rev B = %+v", revision)
+	}
+
+	// Enrichment resolves voltages from the revision asked for
+	template := `{"product": "ROUTER-100", "revision": "%s", "components": [{"name": "EthernetPortTest", "voltage": "UNRESOLVED"}]}`
+	var enriched EnrichedPlan
+	rec = serve(router, http.MethodPost, "/enrich-plan", fmt.Sprintf(template, "B"))
+	if err := json.Unmarshal(rec.Body.Bytes(), &enriched); err != nil {
+		t.Fatalf("%d %s: %v", rec.Code, rec.Body, err)
+	}
+	if enriched.Revision != "B" || enriched.Components[0].Voltage != "5V" {
+		t.Errorf("plan enriched for rev B = %+v", enriched)
+	}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+		code               string
+	}{
+		{http.MethodGet, "/products/ROUTER-100/revisions/C", "", http.StatusOK, `"current":true`},
+		{http.MethodGet, "/products/ROUTER-100/revisions/Z", "", http.StatusNotFound, "revision_not_found"},
+		{http.MethodGet, "/products/ROUTER-999/revisions/A", "", http.StatusNotFound, "product_not_found"},
+		{http.MethodGet, "/products/ROUTER-100/components?revision=A", "", http.StatusOK, `"revision":"A"`},
+		{http.MethodPost, "/enrich-plan", fmt.Sprintf(template, "Z"), http.StatusNotFound, "revision_not_found"},
+	}
+	for _, tt := range tests {
+		if rec := serve(router, tt.method, tt.path, tt.body); rec.Code != tt.want || !strings.Contains(rec.Body.String(), tt.code) {
+			t.Errorf("%s %s = %d %s, want %d %s", tt.method, tt.path, rec.Code, rec.Body, tt.want, tt.code)
+		}
+	}
+}
+
+func TestInvalidProductsAreRejected(t *testing.T) {
+	service, path := newTestService(t)
+	router := service.SetupRoutes()
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, body, want string
+	}{
+		{"not JSON", `{"voltage":`, "invalid_request"},
+		{"name differs from path", `{"name": "AP-400", "voltage": "5V"}`, "does not match"},
+		{"missing voltage", `{"description": "No voltage"}`, `voltage: \"\" is not a voltage`},
+		{"bad component voltage", `{"voltage": "5V", "components": [{"name": "PowerTest", "voltage": "five"}]}`, "components[0].voltage"},
+		{"duplicate component", `{"voltage": "5V", "components": [{"name": "PowerTest"}, {"name": "PowerTest"}]}`, "components[1].name"},
+		{"earlier revision repeats current", `{"voltage": "5V", "revision": "B", "revisions": [{"revision": "B", "voltage": "5V"}]}`, "revisions[0].revision"},
+		{"bad revision component", `{"voltage": "5V", "revision": "B", "revisions": [{"revision": "A", "voltage": "5V", "components": [{"name": ""}]}]}`, "revisions[0].components[0].name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(router, http.MethodPost, "/products/AP-300", tt.body)
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("response = %d %s, want 400 mentioning %s", rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("a rejected product changed the data file")
+	}
+}
+
+func TestFailedSaveKeepsProducts(t *testing.T) {
+	service, path := newTestService(t)
+	router := service.SetupRoutes()
+
+	// The data file cannot be replaced once its directory is gone
+	if err := os.RemoveAll(filepath.Dir(path)); err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(router, http.MethodDelete, "/products/ROUTER-100", "")
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "persistence_failed") {
+		t.Errorf("response = %d %s, want 500 persistence_failed", rec.Code, rec.Body)
+	}
+	if rec := serve(router, http.MethodGet, "/products/ROUTER-100", ""); rec.Code != http.StatusOK {
+		t.Errorf("ROUTER-100 after a failed delete = %d, want 200", rec.Code)
+	}
+}
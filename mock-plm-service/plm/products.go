@@ -0,0 +1,288 @@
+package plm
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// voltagePattern matches voltages as the BPO parses them, e.g. "12V" or
+// "3.3V"
+var voltagePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?V$`)
+
+// validateProduct lists the problems with a product sent to the API
+func validateProduct(product PLMProduct) []string {
+	var problems []string
+	if product.Name == "" {
+		problems = append(problems, "name: must not be empty")
+	}
+	if !voltagePattern.MatchString(product.Voltage) {
+		problems = append(problems, fmt.Sprintf("voltage: %q is not a voltage such as 12V", product.Voltage))
+	}
+	problems = append(problems, validateComponents("components", product.Components)...)
+
+	revisions := map[string]bool{product.Revision: true}
+	for i, revision := range product.Revisions {
+		path := fmt.Sprintf("revisions[%d]", i)
+		switch {
+		case revision.Revision == "":
+			problems = append(problems, path+".revision: must not be empty")
+		case revisions[revision.Revision]:
+			problems = append(problems, fmt.Sprintf("%s.revision: %q is used more than once", path, revision.Revision))
+		}
+		revisions[revision.Revision] = true
+		if !voltagePattern.MatchString(revision.Voltage) {
+			problems = append(problems, fmt.Sprintf("%s.voltage: %q is not a voltage such as 12V", path, revision.Voltage))
+		}
+		problems = append(problems, validateComponents(path+".components", revision.Components)...)
+	}
+	return problems
+}
+
+// validateComponents lists the problems with the components of a revision
+func validateComponents(path string, components []Component) []string {
+	var problems []string
+	seen := make(map[string]bool)
+	for i, comp := range components {
+		at := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case comp.Name == "":
+			problems = append(problems, at+".name: must not be empty")
+		case seen[comp.Name]:
+			problems = append(problems, fmt.Sprintf("%s.name: %q is used more than once", at, comp.Name))
+		}
+		seen[comp.Name] = true
+		if comp.Voltage != "" && !voltagePattern.MatchString(comp.Voltage) {
+			problems = append(problems, fmt.Sprintf("%s.voltage: %q is not a voltage such as 12V", at, comp.Voltage))
+		}
+	}
+	return problems
+}
+
+// saveData writes products to the data file atomically: a temporary file in
+// the same directory is written in full, synced and renamed over the data
+// file, so a crash leaves either the old or the new data
+func (s *Service) saveData(products []PLMProduct) error {
+	absPath, err := filepath.Abs(s.dataPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	data, err := json.MarshalIndent(PLMData{Products: products}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal PLM data: %w", err)
+	}
+
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(absPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(absPath), "."+filepath.Base(absPath)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary PLM data file: %w", err)
+	}
+	// Removing fails harmlessly once the rename has happened
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write PLM data: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync PLM data: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write PLM data: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("failed to set PLM data permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), absPath); err != nil {
+		return fmt.Errorf("failed to replace PLM data file: %w", err)
+	}
+	return nil
+}
+
+// productError is a refused change to the products, answered with status
+// and the error code and message
+type productError struct {
+	status  int
+	code    string
+	message string
+}
+
+// respond answers the request with the error
+func (e *productError) respond(c *gin.Context) {
+	c.JSON(e.status, gin.H{
+		"error":   e.code,
+		"message": e.message,
+	})
+}
+
+// notFound refuses a change to a product PLM does not hold
+func notFound(name string) *productError {
+	return &productError{http.StatusNotFound, "product_not_found", fmt.Sprintf("Product %s not found in PLM system", name)}
+}
+
+// updateProducts applies change to a copy of the products and saves the
+// result, replacing the products served only once the file is written
+func (s *Service) updateProducts(change func(products []PLMProduct) ([]PLMProduct, *productError)) *productError {
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	products, refused := change(append([]PLMProduct(nil), s.data.Products...))
+	if refused != nil {
+		return refused
+	}
+	if err := s.saveData(products); err != nil {
+		log.Printf("Failed to save PLM data: %v", err)
+		return &productError{http.StatusInternalServerError, "persistence_failed", err.Error()}
+	}
+	s.data.Products = products
+	return nil
+}
+
+// productIndex returns the position of the named product, or -1
+func productIndex(products []PLMProduct, name string) int {
+	for i, product := range products {
+		if product.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// bindProduct decodes a product from the request body for the product
+// named in the path, answering the request if it is invalid
+func bindProduct(c *gin.Context) (PLMProduct, bool) {
+	name := c.Param("name")
+	var product PLMProduct
+	if err := c.ShouldBindJSON(&product); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid product format",
+			"details": err.Error(),
+		})
+		return product, false
+	}
+	if product.Name == "" {
+		product.Name = name
+	}
+	if product.Name != name {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_product",
+			"message": fmt.Sprintf("Product name %s does not match %s in the path", product.Name, name),
+		})
+		return product, false
+	}
+	if problems := validateProduct(product); len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_product",
+			"message": fmt.Sprintf("Product %s is invalid", name),
+			"details": strings.Join(problems, "; "),
+		})
+		return product, false
+	}
+	if product.Components == nil {
+		product.Components = []Component{}
+	}
+	for i := range product.Revisions {
+		if product.Revisions[i].Components == nil {
+			product.Revisions[i].Components = []Component{}
+		}
+	}
+	return product, true
+}
+
+// handleGetProduct returns a product with its components and earlier
+// revisions
+func (s *Service) handleGetProduct(c *gin.Context) {
+	name := c.Param("name")
+	product, err := s.findProduct(name)
+	if err != nil {
+		notFound(name).respond(c)
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+// handleCreateProduct adds a product, refusing one that already exists
+func (s *Service) handleCreateProduct(c *gin.Context) {
+	product, ok := bindProduct(c)
+	if !ok {
+		return
+	}
+
+	refused := s.updateProducts(func(products []PLMProduct) ([]PLMProduct, *productError) {
+		if productIndex(products, product.Name) >= 0 {
+			return nil, &productError{http.StatusConflict, "product_exists", fmt.Sprintf("Product %s already exists", product.Name)}
+		}
+		return append(products, product), nil
+	})
+	if refused != nil {
+		refused.respond(c)
+		return
+	}
+
+	log.Printf("Created product %s with %d component(s)", product.Name, len(product.Components))
+	c.JSON(http.StatusCreated, product)
+}
+
+// handleUpdateProduct replaces an existing product
+func (s *Service) handleUpdateProduct(c *gin.Context) {
+	product, ok := bindProduct(c)
+	if !ok {
+		return
+	}
+
+	refused := s.updateProducts(func(products []PLMProduct) ([]PLMProduct, *productError) {
+		i := productIndex(products, product.Name)
+		if i < 0 {
+			return nil, notFound(product.Name)
+		}
+		products[i] = product
+		return products, nil
+	})
+	if refused != nil {
+		refused.respond(c)
+		return
+	}
+
+	log.Printf("Updated product %s with %d component(s)", product.Name, len(product.Components))
+	c.JSON(http.StatusOK, product)
+}
+
+// handleDeleteProduct removes a product and its release status
+func (s *Service) handleDeleteProduct(c *gin.Context) {
+	name := c.Param("name")
+
+	refused := s.updateProducts(func(products []PLMProduct) ([]PLMProduct, *productError) {
+		i := productIndex(products, name)
+		if i < 0 {
+			return nil, notFound(name)
+		}
+		return append(products[:i], products[i+1:]...), nil
+	})
+	if refused != nil {
+		refused.respond(c)
+		return
+	}
+
+	s.statusMu.Lock()
+	delete(s.statuses, name)
+	s.statusMu.Unlock()
+
+	log.Printf("Deleted product %s", name)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "deleted",
+		"product": name,
+	})
+}